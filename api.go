@@ -108,12 +108,16 @@ func (g *Git) CommonDir(ctx context.Context) (string, error) {
 
 // IsMerging reports whether the index has a pending merge commit.
 func (g *Git) IsMerging(ctx context.Context) (bool, error) {
-	const errPrefix = "check git merge"
+	return g.hasGitDirFile(ctx, "check git merge", "MERGE_HEAD")
+}
+
+// hasGitDirFile reports whether the named file exists in the Git directory.
+func (g *Git) hasGitDirFile(ctx context.Context, errPrefix string, name string) (bool, error) {
 	gitDir, err := g.GitDir(ctx)
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", errPrefix, err)
 	}
-	_, err = os.Stat(g.fs.Join(gitDir, "MERGE_HEAD"))
+	_, err = os.Stat(g.fs.Join(gitDir, name))
 	if os.IsNotExist(err) {
 		return false, nil
 	}
@@ -167,8 +171,9 @@ func (g *Git) IsAncestor(ctx context.Context, rev1, rev2 string) (bool, error) {
 // TreeEntry represents a single entry in a Git tree object.
 // It implements os.FileInfo.
 type TreeEntry struct {
-	size int64
-	raw  object.TreeEntry
+	size         int64
+	raw          object.TreeEntry
+	skipWorktree bool
 }
 
 // Name returns the base name of the file.
@@ -214,6 +219,11 @@ func (ent *TreeEntry) ObjectType() object.Type {
 // Object returns the hash of the file's Git object.
 func (ent *TreeEntry) Object() Hash { return ent.raw.ObjectID }
 
+// SkipWorktree reports whether the file's index entry has the skip-worktree
+// bit set, as it does for files outside the sparse checkout patterns. It is
+// only populated if ListTreeOptions.CheckSkipWorktree was set.
+func (ent *TreeEntry) SkipWorktree() bool { return ent.skipWorktree }
+
 // String formats the entry similar to `git ls-tree` output.
 func (ent *TreeEntry) String() string {
 	return fmt.Sprintf("%v %s %v %s", ent.raw.Mode, ent.ObjectType(), ent.raw.ObjectID, ent.raw.Name)
@@ -229,6 +239,9 @@ type ListTreeOptions struct {
 	// will be populated (the values will be nil). This can be more efficient if
 	// information beyond the name is not needed.
 	NameOnly bool
+	// If CheckSkipWorktree is true, then ListTree reads the index to fill in
+	// each entry's SkipWorktree flag. It has no effect if NameOnly is true.
+	CheckSkipWorktree bool
 }
 
 // ListTree returns the list of files at a given revision.
@@ -280,6 +293,17 @@ func (g *Git) ListTree(ctx context.Context, rev string, opts ListTreeOptions) (m
 			tree[TopPath(ent.raw.Name)] = ent
 			out = trail
 		}
+		if opts.CheckSkipWorktree {
+			skipped, err := g.listSkipWorktree(ctx, opts.Pathspecs)
+			if err != nil {
+				return tree, err
+			}
+			for path := range skipped {
+				if ent := tree[path]; ent != nil {
+					ent.skipWorktree = true
+				}
+			}
+		}
 	}
 	return tree, nil
 }
@@ -0,0 +1,613 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	slashpath "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gg-scm.io/pkg/git/object"
+)
+
+// ArchiveFormat is the file format of an archive.
+type ArchiveFormat int
+
+// Archive formats.
+const (
+	// ArchiveTar is an uncompressed tar file.
+	ArchiveTar ArchiveFormat = iota
+	// ArchiveTarGzip is a gzip-compressed tar file.
+	ArchiveTarGzip
+	// ArchiveZip is a zip file.
+	ArchiveZip
+)
+
+// String returns the Go constant name of the format.
+func (format ArchiveFormat) String() string {
+	switch format {
+	case ArchiveTar:
+		return "ArchiveTar"
+	case ArchiveTarGzip:
+		return "ArchiveTarGzip"
+	case ArchiveZip:
+		return "ArchiveZip"
+	default:
+		return fmt.Sprintf("ArchiveFormat(%d)", int(format))
+	}
+}
+
+// flag returns the argument to `git archive --format`.
+func (format ArchiveFormat) flag() string {
+	switch format {
+	case ArchiveTar:
+		return "tar"
+	case ArchiveTarGzip:
+		return "tar.gz"
+	case ArchiveZip:
+		return "zip"
+	default:
+		return ""
+	}
+}
+
+// ArchiveOptions specifies the command-line options for `git archive`.
+type ArchiveOptions struct {
+	// Format is the archive's file format. The default is ArchiveTar.
+	Format ArchiveFormat
+	// Prefix is prepended to the path of every file in the archive.
+	// To place the files in a directory, end Prefix with a slash,
+	// like "project-1.0/".
+	Prefix string
+	// If Pathspecs is not empty, then only the files that match are included.
+	// Pathspecs are interpreted relative to the top of the repository.
+	Pathspecs []Pathspec
+}
+
+// Archive returns an archive of the files in the given commit or tree.
+// Files with the export-ignore attribute are omitted and files with the
+// export-subst attribute have their placeholders expanded, as described in
+// https://git-scm.com/docs/gitattributes#_creating_an_archive.
+// It is the caller's responsibility to close the returned io.ReadCloser
+// if the returned error is nil.
+//
+// If the Git object's Runner implements Piper, then the archive is streamed
+// from `git archive`. Otherwise, Archive builds the archive in the current
+// process from ListTree and an ObjectReader. Either way, attributes are read
+// from the .gitattributes files in the given revision.
+func (g *Git) Archive(ctx context.Context, rev string, opts ArchiveOptions) (io.ReadCloser, error) {
+	errPrefix := fmt.Sprintf("git archive %q", rev)
+	if err := validateRev(rev); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if strings.HasPrefix(rev, "^") || strings.Contains(rev, "..") {
+		return nil, fmt.Errorf("%s: revision must be a single commit or tree", errPrefix)
+	}
+	if opts.Format.flag() == "" {
+		return nil, fmt.Errorf("%s: unknown format %v", errPrefix, opts.Format)
+	}
+	// `git archive` interprets paths relative to the working directory,
+	// so run it from the top of the working tree.
+	top, err := g.top(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+
+	if _, ok := g.runner.(Piper); !ok {
+		pr, pw := io.Pipe()
+		go func() {
+			err := top.buildArchive(ctx, pw, rev, opts)
+			if err != nil {
+				err = fmt.Errorf("%s: %w", errPrefix, err)
+			}
+			pw.CloseWithError(err)
+		}()
+		return pr, nil
+	}
+
+	args := []string{"archive", "--format=" + opts.Format.flag()}
+	if opts.Prefix != "" {
+		args = append(args, "--prefix="+opts.Prefix)
+	}
+	args = append(args, rev, "--")
+	for _, spec := range opts.Pathspecs {
+		args = append(args, spec.String())
+	}
+	stderr := new(bytes.Buffer)
+	stdout, err := StartPipe(ctx, g.runner, &Invocation{
+		Args:   args,
+		Dir:    top.dir,
+		Stderr: &limitWriter{w: stderr, n: errorOutputLimit},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+
+	// Archives are never empty, so if Git reports an error,
+	// stdout will be empty and stderr will contain the error message.
+	first := make([]byte, 2048)
+	readLen, readErr := io.ReadAtLeast(stdout, first, 1)
+	if readErr != nil {
+		err := stdout.Close()
+		if err == nil {
+			err = readErr
+		}
+		return nil, commandError(errPrefix, err, stderr.Bytes())
+	}
+	return &catReader{
+		errPrefix: errPrefix,
+		first:     first[:readLen],
+		pipe:      stdout,
+		stderr:    stderr,
+	}, nil
+}
+
+// top returns a Git object that runs commands from the top of the working
+// tree. For bare repositories, top returns g.
+func (g *Git) top(ctx context.Context) (*Git, error) {
+	out, err := g.output(ctx, "find git work tree root", []string{"rev-parse", "--show-cdup"})
+	if err != nil {
+		return nil, err
+	}
+	cdup := strings.TrimSuffix(out, "\n")
+	if cdup == "" {
+		return g, nil
+	}
+	return g.WithDir(cdup), nil
+}
+
+// buildArchive writes an archive of the files in the given revision to w
+// without using `git archive`. g must be run from the top of the working tree.
+func (g *Git) buildArchive(ctx context.Context, w io.Writer, rev string, opts ArchiveOptions) error {
+	objects, err := g.OpenObjectReader(ctx)
+	if err != nil {
+		return err
+	}
+	defer objects.Close()
+
+	// Only commits have a timestamp and can expand export-subst placeholders.
+	// Like Git, use the current time for trees.
+	info, err := objects.Stat(ctx, rev+"^{}")
+	if err != nil {
+		return err
+	}
+	var commit *object.Commit
+	mtime := time.Now()
+	switch info.Type {
+	case object.TypeCommit:
+		commit, err = objects.Commit(ctx, info.ID.String())
+		if err != nil {
+			return err
+		}
+		mtime = commit.CommitTime
+	case object.TypeTree:
+	default:
+		return fmt.Errorf("%s is a %v, not a commit or tree", rev, info.Type)
+	}
+	tree, err := g.ListTree(ctx, info.ID.String(), ListTreeOptions{
+		Pathspecs: opts.Pathspecs,
+		Recursive: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Attributes apply to directories too, so check every ancestor directory.
+	paths := make([]TopPath, 0, len(tree))
+	queried := make(map[TopPath]struct{}, len(tree))
+	for path := range tree {
+		for p := path; p != "." && p != "/"; p = TopPath(slashpath.Dir(string(p))) {
+			if _, ok := queried[p]; ok {
+				break
+			}
+			queried[p] = struct{}{}
+			paths = append(paths, p)
+		}
+	}
+	attrs, err := g.exportAttributes(ctx, info.ID.String(), paths)
+	if err != nil {
+		return err
+	}
+
+	// Only write directories that contain files, as Git does.
+	entries := make(map[TopPath]*TreeEntry)
+	for path, ent := range tree {
+		if isExportIgnored(attrs, path) {
+			continue
+		}
+		entries[path] = ent
+		for dir := TopPath(slashpath.Dir(string(path))); dir != "."; dir = TopPath(slashpath.Dir(string(dir))) {
+			if _, ok := entries[dir]; ok {
+				break
+			}
+			entries[dir] = nil
+		}
+	}
+	sortedPaths := make([]TopPath, 0, len(entries))
+	for path := range entries {
+		sortedPaths = append(sortedPaths, path)
+	}
+	// Sort directories as if they had a trailing slash so that they appear
+	// before their contents.
+	sortKey := func(path TopPath) string {
+		if ent := entries[path]; ent == nil || ent.IsDir() || ent.ObjectType() == object.TypeCommit {
+			return string(path) + "/"
+		}
+		return string(path)
+	}
+	sort.Slice(sortedPaths, func(i, j int) bool {
+		return sortKey(sortedPaths[i]) < sortKey(sortedPaths[j])
+	})
+
+	var aw archiveWriter
+	switch opts.Format {
+	case ArchiveTar:
+		aw = newTarArchiveWriter(w, nil, commit)
+	case ArchiveTarGzip:
+		zw := gzip.NewWriter(w)
+		aw = newTarArchiveWriter(zw, zw, commit)
+	case ArchiveZip:
+		aw = newZipArchiveWriter(w, commit)
+	default:
+		return fmt.Errorf("unknown format %v", opts.Format)
+	}
+	if strings.HasSuffix(opts.Prefix, "/") {
+		if err := aw.writeDir(opts.Prefix, mtime); err != nil {
+			return err
+		}
+	}
+	for _, path := range sortedPaths {
+		ent := entries[path]
+		name := opts.Prefix + string(path)
+		if ent == nil || ent.ObjectType() == object.TypeCommit {
+			// Submodules are written as empty directories.
+			if err := aw.writeDir(name+"/", mtime); err != nil {
+				return err
+			}
+			continue
+		}
+		blob, content, err := objects.Open(ctx, ent.Object().String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		var r io.Reader = content
+		size := blob.Size
+		if attrs[path].subst && commit != nil {
+			data, err := ioutil.ReadAll(content)
+			if err != nil {
+				content.Close()
+				return err
+			}
+			data, err = g.expandExportSubst(ctx, commit.SHA1(), data)
+			if err != nil {
+				content.Close()
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			r = bytes.NewReader(data)
+			size = int64(len(data))
+		}
+		err = aw.writeFile(name, ent.Mode(), mtime, size, r)
+		closeErr := content.Close()
+		if err != nil {
+			return err
+		}
+		if closeErr != nil {
+			return closeErr
+		}
+	}
+	return aw.Close()
+}
+
+// exportAttrs is the set of export attributes for a single path.
+type exportAttrs struct {
+	ignore bool
+	subst  bool
+}
+
+// exportAttributes returns the export-ignore and export-subst attributes
+// for the given paths. Paths without either attribute set are omitted.
+func (g *Git) exportAttributes(ctx context.Context, rev string, paths []TopPath) (map[TopPath]exportAttrs, error) {
+	const errPrefix = "git check-attr"
+	attrs := make(map[TopPath]exportAttrs)
+	if len(paths) == 0 {
+		return attrs, nil
+	}
+	args := []string{"check-attr", "-z", "--stdin"}
+	var env []string
+	if version, err := g.getVersion(ctx); err == nil && versionAtLeast(version, 2, 40) {
+		args = append(args, "--source="+rev)
+	} else {
+		// Older versions of Git can only read attributes from the working
+		// tree or the index, so read rev's tree into a temporary index.
+		dir, err := ioutil.TempDir("", "gg-archive-index")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		defer os.RemoveAll(dir)
+		env = []string{"GIT_INDEX_FILE=" + filepath.Join(dir, "index")}
+		stderr := new(bytes.Buffer)
+		err = g.runner.RunGit(ctx, &Invocation{
+			Args:   []string{"read-tree", rev},
+			Dir:    g.dir,
+			Env:    env,
+			Stderr: &limitWriter{w: stderr, n: errorOutputLimit},
+		})
+		if err != nil {
+			return nil, commandError("git read-tree", err, stderr.Bytes())
+		}
+		args = append(args, "--cached")
+	}
+	args = append(args, "export-ignore", "export-subst")
+	stdin := new(strings.Builder)
+	for _, path := range paths {
+		stdin.WriteString(path.String())
+		stdin.WriteByte(0)
+	}
+	stdout := new(strings.Builder)
+	stderr := new(bytes.Buffer)
+	err := g.runner.RunGit(ctx, &Invocation{
+		Args:   args,
+		Dir:    g.dir,
+		Env:    env,
+		Stdin:  strings.NewReader(stdin.String()),
+		Stdout: &limitWriter{w: stdout, n: dataOutputLimit},
+		Stderr: &limitWriter{w: stderr, n: errorOutputLimit},
+	})
+	if err != nil {
+		return nil, commandError(errPrefix, err, stderr.Bytes())
+	}
+	// Output is a sequence of "<path> NUL <attribute> NUL <info> NUL".
+	fields := strings.Split(stdout.String(), "\x00")
+	if len(fields)%3 != 1 || fields[len(fields)-1] != "" {
+		return nil, fmt.Errorf("%s: %w", errPrefix, io.ErrUnexpectedEOF)
+	}
+	for i := 0; i+3 <= len(fields); i += 3 {
+		path, attr, info := TopPath(fields[i]), fields[i+1], fields[i+2]
+		if info != "set" {
+			continue
+		}
+		a := attrs[path]
+		switch attr {
+		case "export-ignore":
+			a.ignore = true
+		case "export-subst":
+			a.subst = true
+		}
+		attrs[path] = a
+	}
+	return attrs, nil
+}
+
+// isExportIgnored reports whether path or any of its parent directories
+// has the export-ignore attribute.
+func isExportIgnored(attrs map[TopPath]exportAttrs, path TopPath) bool {
+	for p := path; p != "." && p != "/"; p = TopPath(slashpath.Dir(string(p))) {
+		if attrs[p].ignore {
+			return true
+		}
+	}
+	return false
+}
+
+// expandExportSubst replaces "$Format:...$" placeholders in data with the
+// given commit formatted by `git log`. All of the placeholders are expanded
+// by a single `git log` invocation.
+func (g *Git) expandExportSubst(ctx context.Context, commit Hash, data []byte) ([]byte, error) {
+	const start = "$Format:"
+	type placeholder struct {
+		start, end int
+	}
+	var placeholders []placeholder
+	format := new(strings.Builder)
+	for off := 0; ; {
+		i := bytes.Index(data[off:], []byte(start))
+		if i == -1 {
+			break
+		}
+		i += off
+		end := bytes.IndexByte(data[i+len(start):], '$')
+		if end == -1 {
+			break
+		}
+		end += i + len(start)
+		if len(placeholders) > 0 {
+			format.WriteString("%x00")
+		}
+		format.Write(data[i+len(start) : end])
+		placeholders = append(placeholders, placeholder{i, end + 1})
+		off = end + 1
+	}
+	if len(placeholders) == 0 {
+		return data, nil
+	}
+	out, err := g.output(ctx, "expand export-subst", logArgs(
+		"-1",
+		"--no-walk",
+		"--format="+format.String(),
+		commit.String(),
+		"--",
+	))
+	if err != nil {
+		return nil, err
+	}
+	values := strings.Split(strings.TrimSuffix(out, "\n"), "\x00")
+	if len(values) != len(placeholders) {
+		return nil, fmt.Errorf("expand export-subst: got %d values for %d placeholders", len(values), len(placeholders))
+	}
+	var buf []byte
+	prev := 0
+	for i, p := range placeholders {
+		buf = append(buf, data[prev:p.start]...)
+		buf = append(buf, values[i]...)
+		prev = p.end
+	}
+	return append(buf, data[prev:]...), nil
+}
+
+// An archiveWriter writes entries to an archive file.
+type archiveWriter interface {
+	// writeDir writes a directory. name ends with a slash.
+	writeDir(name string, mtime time.Time) error
+	// writeFile writes a regular file or symlink.
+	writeFile(name string, mode os.FileMode, mtime time.Time, size int64, r io.Reader) error
+	// Close finishes writing the archive.
+	Close() error
+}
+
+// tarArchiveWriter writes entries with the same permissions as `git archive`.
+type tarArchiveWriter struct {
+	tw *tar.Writer
+	// c is closed after tw, if not nil.
+	c io.Closer
+	// err is the error from writing the global header, if any.
+	err error
+}
+
+func newTarArchiveWriter(w io.Writer, c io.Closer, commit *object.Commit) *tarArchiveWriter {
+	aw := &tarArchiveWriter{tw: tar.NewWriter(w), c: c}
+	if commit != nil {
+		aw.err = aw.tw.WriteHeader(&tar.Header{
+			Typeflag:   tar.TypeXGlobalHeader,
+			Name:       "pax_global_header",
+			PAXRecords: map[string]string{"comment": commit.SHA1().String()},
+		})
+	}
+	return aw
+}
+
+func (aw *tarArchiveWriter) writeDir(name string, mtime time.Time) error {
+	if aw.err != nil {
+		return aw.err
+	}
+	return aw.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name,
+		Mode:     0775,
+		ModTime:  mtime,
+		Uname:    "root",
+		Gname:    "root",
+	})
+}
+
+func (aw *tarArchiveWriter) writeFile(name string, mode os.FileMode, mtime time.Time, size int64, r io.Reader) error {
+	if aw.err != nil {
+		return aw.err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0664,
+		Size:     size,
+		ModTime:  mtime,
+		Uname:    "root",
+		Gname:    "root",
+	}
+	if mode&os.ModeSymlink != 0 {
+		target, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = string(target)
+		hdr.Mode = 0777
+		hdr.Size = 0
+		return aw.tw.WriteHeader(hdr)
+	}
+	if mode&0100 != 0 {
+		hdr.Mode = 0775
+	}
+	if err := aw.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(aw.tw, r)
+	return err
+}
+
+func (aw *tarArchiveWriter) Close() error {
+	if aw.err != nil {
+		return aw.err
+	}
+	err := aw.tw.Close()
+	if aw.c != nil {
+		if cerr := aw.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func newZipArchiveWriter(w io.Writer, commit *object.Commit) *zipArchiveWriter {
+	zw := zip.NewWriter(w)
+	if commit != nil {
+		// Can only fail if the comment is too long.
+		zw.SetComment(commit.SHA1().String())
+	}
+	return &zipArchiveWriter{zw: zw}
+}
+
+func (aw *zipArchiveWriter) writeDir(name string, mtime time.Time) error {
+	hdr := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: mtime,
+	}
+	hdr.SetMode(os.ModeDir | 0775)
+	_, err := aw.zw.CreateHeader(hdr)
+	return err
+}
+
+func (aw *zipArchiveWriter) writeFile(name string, mode os.FileMode, mtime time.Time, size int64, r io.Reader) error {
+	hdr := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: mtime,
+	}
+	switch {
+	case mode&os.ModeSymlink != 0:
+		hdr.Method = zip.Store
+		hdr.SetMode(os.ModeSymlink | 0777)
+	case mode&0100 != 0:
+		hdr.SetMode(0775)
+	default:
+		hdr.SetMode(0664)
+	}
+	w, err := aw.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (aw *zipArchiveWriter) Close() error {
+	return aw.zw.Close()
+}
@@ -0,0 +1,282 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestArchive(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	err = env.root.Apply(
+		filesystem.Write(".gitattributes", "ignored export-ignore\nversion.txt export-subst\n"),
+		filesystem.Write("foo.txt", dummyContent),
+		filesystem.Write("dir/bar.txt", "bar\n"),
+		filesystem.Write("ignored/secret.txt", "secret\n"),
+		filesystem.Write("version.txt", "$Format:%H$\n$Format:%s$ ($Format:%an$)\n"),
+		filesystem.Symlink("foo.txt", "link"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"."}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	rev, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fallback := Custom(env.root.String(), struct{ Runner }{env.g.Runner()}, env.g.FileSystem())
+	tests := []struct {
+		name string
+		dir  string
+		rev  string
+		opts ArchiveOptions
+		want []archiveTestEntry
+	}{
+		{
+			name: "All",
+			rev:  "HEAD",
+			opts: ArchiveOptions{Prefix: "proj/"},
+			want: []archiveTestEntry{
+				{Name: "proj/", Dir: true},
+				{Name: "proj/.gitattributes", Content: "ignored export-ignore\nversion.txt export-subst\n"},
+				{Name: "proj/dir/", Dir: true},
+				{Name: "proj/dir/bar.txt", Content: "bar\n"},
+				{Name: "proj/foo.txt", Content: dummyContent},
+				{Name: "proj/link", Content: "foo.txt", Symlink: true},
+				{Name: "proj/version.txt", Content: rev.Commit.String() + "\nfirst (User)\n"},
+			},
+		},
+		{
+			name: "Tree",
+			rev:  "HEAD^{tree}",
+			opts: ArchiveOptions{Pathspecs: []Pathspec{"version.txt"}},
+			want: []archiveTestEntry{
+				{Name: "version.txt", Content: "$Format:%H$\n$Format:%s$ ($Format:%an$)\n"},
+			},
+		},
+		{
+			name: "Pathspecs",
+			dir:  "dir",
+			rev:  "HEAD",
+			opts: ArchiveOptions{Pathspecs: []Pathspec{"dir", "foo.txt"}},
+			want: []archiveTestEntry{
+				{Name: "dir/", Dir: true},
+				{Name: "dir/bar.txt", Content: "bar\n"},
+				{Name: "foo.txt", Content: dummyContent},
+			},
+		},
+	}
+	for _, test := range tests {
+		for _, format := range []ArchiveFormat{ArchiveTar, ArchiveTarGzip, ArchiveZip} {
+			for _, g := range []*Git{env.g, fallback} {
+				_, piped := g.Runner().(Piper)
+				t.Run(fmt.Sprintf("%s/%v/Piper=%t", test.name, format, piped), func(t *testing.T) {
+					if test.dir != "" {
+						g = g.WithDir(test.dir)
+					}
+					opts := test.opts
+					opts.Format = format
+					rc, err := g.Archive(ctx, test.rev, opts)
+					if err != nil {
+						t.Fatal("Archive:", err)
+					}
+					data, err := ioutil.ReadAll(rc)
+					closeErr := rc.Close()
+					if err != nil {
+						t.Fatal("Archive:", err)
+					}
+					if closeErr != nil {
+						t.Fatal("Archive:", closeErr)
+					}
+					got, err := readTestArchive(format, data)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if diff := cmp.Diff(test.want, got); diff != "" {
+						t.Errorf("Archive(ctx, %q, %+v) (-want +got):\n%s", test.rev, opts, diff)
+					}
+				})
+			}
+		}
+	}
+
+	t.Run("BadRev", func(t *testing.T) {
+		for _, rev := range []string{"nonexistent", "HEAD:foo.txt"} {
+			for _, g := range []*Git{env.g, fallback} {
+				rc, err := g.Archive(ctx, rev, ArchiveOptions{})
+				if err != nil {
+					continue
+				}
+				_, err = ioutil.ReadAll(rc)
+				if closeErr := rc.Close(); err == nil {
+					err = closeErr
+				}
+				if err == nil {
+					t.Errorf("Archive(ctx, %q, {}) did not return an error", rev)
+				}
+			}
+		}
+	})
+
+	t.Run("OlderAttributes", func(t *testing.T) {
+		// Archiving an older commit should use that commit's .gitattributes,
+		// not the ones in the index or the working copy.
+		err := env.root.Apply(
+			filesystem.Write(".gitattributes", "foo.txt export-ignore\n"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.Add(ctx, []Pathspec{".gitattributes"}, AddOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.Commit(ctx, "second", CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		want := []archiveTestEntry{
+			{Name: "foo.txt", Content: dummyContent},
+			{Name: "version.txt", Content: rev.Commit.String() + "\nfirst (User)\n"},
+		}
+		for _, g := range []*Git{env.g, fallback} {
+			rc, err := g.Archive(ctx, "HEAD~1", ArchiveOptions{Pathspecs: []Pathspec{"foo.txt", "ignored", "version.txt"}})
+			if err != nil {
+				t.Fatal("Archive:", err)
+			}
+			data, err := ioutil.ReadAll(rc)
+			closeErr := rc.Close()
+			if err != nil {
+				t.Fatal("Archive:", err)
+			}
+			if closeErr != nil {
+				t.Fatal("Archive:", closeErr)
+			}
+			got, err := readTestArchive(ArchiveTar, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, piped := g.Runner().(Piper)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Archive(ctx, \"HEAD~1\", ...) with Piper=%t (-want +got):\n%s", piped, diff)
+			}
+		}
+	})
+}
+
+type archiveTestEntry struct {
+	Name    string
+	Content string
+	Dir     bool
+	Symlink bool
+}
+
+func readTestArchive(format ArchiveFormat, data []byte) ([]archiveTestEntry, error) {
+	var entries []archiveTestEntry
+	switch format {
+	case ArchiveTar, ArchiveTarGzip:
+		var r io.Reader = bytes.NewReader(data)
+		if format == ArchiveTarGzip {
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			r = zr
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return entries, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			ent := archiveTestEntry{Name: hdr.Name}
+			switch hdr.Typeflag {
+			case tar.TypeXGlobalHeader:
+				continue
+			case tar.TypeDir:
+				ent.Dir = true
+			case tar.TypeSymlink:
+				ent.Symlink = true
+				ent.Content = hdr.Linkname
+			default:
+				content, err := ioutil.ReadAll(tr)
+				if err != nil {
+					return nil, err
+				}
+				ent.Content = string(content)
+			}
+			entries = append(entries, ent)
+		}
+	case ArchiveZip:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			ent := archiveTestEntry{Name: f.Name}
+			if ent.Dir = f.Name[len(f.Name)-1] == '/'; !ent.Dir {
+				ent.Symlink = f.Mode()&os.ModeSymlink != 0
+				r, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				content, err := ioutil.ReadAll(r)
+				r.Close()
+				if err != nil {
+					return nil, err
+				}
+				ent.Content = string(content)
+			}
+			entries = append(entries, ent)
+		}
+		return entries, nil
+	default:
+		return nil, fmt.Errorf("unknown format %v", format)
+	}
+}
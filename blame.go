@@ -0,0 +1,297 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gg-scm.io/pkg/git/object"
+)
+
+// BlameOptions specifies the command-line options for `git blame`.
+type BlameOptions struct {
+	// Lines restricts the blame to the given line ranges.
+	// If empty, the whole file is annotated.
+	Lines []LineRange
+
+	// IgnoreRevs is a list of revisions to ignore when assigning blame.
+	// Lines changed by an ignored revision are blamed on the previous
+	// commit that changed them.
+	IgnoreRevs []string
+	// IgnoreRevsFiles is a list of files (like .git-blame-ignore-revs) that
+	// contain revisions to ignore, one per line. Relative paths are
+	// interpreted relative to the Git object's directory.
+	IgnoreRevsFiles []string
+
+	// If DetectMoves is true, then lines moved or copied within the same
+	// file are blamed on their original commit.
+	DetectMoves bool
+	// DetectCopies controls the detection of lines moved or copied from
+	// other files. It is the number of times the -C flag is passed to
+	// `git blame`, so it must be between 0 and 3. Higher levels search more
+	// commits at the cost of speed.
+	DetectCopies int
+}
+
+// A LineRange is an inclusive range of 1-based line numbers.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// String formats the range as used by `git blame -L`.
+func (r LineRange) String() string {
+	return fmt.Sprintf("%d,%d", r.Start, r.End)
+}
+
+// A BlameRange is a contiguous group of lines in a file that originate from
+// the same commit.
+type BlameRange struct {
+	// Commit is the commit that introduced the lines.
+	// It is zero for lines that have not been committed yet.
+	Commit Hash
+	// OrigPath is the path of the file in Commit.
+	OrigPath TopPath
+	// OrigLine is the 1-based line number of the first line in the
+	// range in OrigPath at Commit.
+	OrigLine int
+	// FinalLine is the 1-based line number of the first line in the
+	// range in the annotated file.
+	FinalLine int
+	// NumLines is the number of lines in the range.
+	NumLines int
+
+	Author     object.User
+	AuthorTime time.Time
+	Committer  object.User
+	CommitTime time.Time
+	// Summary is the first line of Commit's message.
+	Summary string
+	// Boundary is true if Commit is a boundary commit, meaning the blame
+	// did not traverse its history any further.
+	Boundary bool
+}
+
+// Blame annotates each line of the file at the given path with the commit
+// that introduced it. If rev is empty, then the working copy's version of
+// the file is annotated. The returned ranges are sorted by FinalLine.
+func (g *Git) Blame(ctx context.Context, rev string, path TopPath, opts BlameOptions) ([]*BlameRange, error) {
+	errPrefix := fmt.Sprintf("git blame %q", path)
+	if rev != "" {
+		errPrefix += fmt.Sprintf(" @ %q", rev)
+		if err := validateRev(rev); err != nil {
+			return nil, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%s: empty path", errPrefix)
+	}
+	if opts.DetectCopies < 0 || opts.DetectCopies > 3 {
+		return nil, fmt.Errorf("%s: DetectCopies must be between 0 and 3", errPrefix)
+	}
+	args := []string{"blame", "--incremental"}
+	for _, r := range opts.Lines {
+		if r.Start < 1 || r.End < r.Start {
+			return nil, fmt.Errorf("%s: invalid line range %v", errPrefix, r)
+		}
+		args = append(args, "-L", r.String())
+	}
+	for _, ignore := range opts.IgnoreRevs {
+		if err := validateRev(ignore); err != nil {
+			return nil, fmt.Errorf("%s: ignore revision: %w", errPrefix, err)
+		}
+		args = append(args, "--ignore-rev="+ignore)
+	}
+	for _, f := range opts.IgnoreRevsFiles {
+		// Blame runs from the top of the working tree (see below),
+		// so resolve the file relative to the caller's directory first.
+		args = append(args, "--ignore-revs-file="+g.abs(f))
+	}
+	if opts.DetectMoves {
+		args = append(args, "-M")
+	}
+	for i := 0; i < opts.DetectCopies; i++ {
+		args = append(args, "-C")
+	}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	args = append(args, "--", path.String())
+
+	// Paths given to blame are relative to the working directory,
+	// so run from the top of the working tree.
+	prefix, err := g.prefix(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if prefix != "" {
+		workTree, err := g.WorkTree(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		g = g.WithDir(workTree)
+	}
+	out, err := g.output(ctx, errPrefix, args)
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := parseBlameIncremental(out)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return ranges, nil
+}
+
+// parseBlameIncremental parses the output of `git blame --incremental`.
+// Commit information headers are only present the first time a commit
+// appears in the output.
+//
+// See https://git-scm.com/docs/git-blame#_the_porcelain_format
+func parseBlameIncremental(out string) ([]*BlameRange, error) {
+	type commitInfo struct {
+		author     string
+		authorMail string
+		authorTime time.Time
+		committer  string
+		commitMail string
+		commitTime time.Time
+		summary    string
+		boundary   bool
+	}
+	commits := make(map[Hash]*commitInfo)
+	var ranges []*BlameRange
+	var curr *BlameRange
+	var info *commitInfo
+	var authorUnix, commitUnix int64
+	for len(out) > 0 {
+		eol := strings.IndexByte(out, '\n')
+		if eol == -1 {
+			return nil, errors.New("unexpected EOF")
+		}
+		line := out[:eol]
+		out = out[eol+1:]
+
+		if curr == nil {
+			// Start of a group: "<hash> <orig line> <final line> <num lines>".
+			fields := strings.Fields(line)
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("invalid group header %q", line)
+			}
+			curr = new(BlameRange)
+			var err error
+			curr.Commit, err = ParseHash(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid group header %q: %v", line, err)
+			}
+			nums := make([]int, 3)
+			for i := range nums {
+				nums[i], err = strconv.Atoi(fields[i+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid group header %q: %v", line, err)
+				}
+			}
+			curr.OrigLine, curr.FinalLine, curr.NumLines = nums[0], nums[1], nums[2]
+			info = commits[curr.Commit]
+			if info == nil {
+				info = new(commitInfo)
+				commits[curr.Commit] = info
+			}
+			continue
+		}
+
+		key, value := line, ""
+		if i := strings.IndexByte(line, ' '); i != -1 {
+			key, value = line[:i], line[i+1:]
+		}
+		var err error
+		switch key {
+		case "author":
+			info.author = value
+		case "author-mail":
+			info.authorMail = value
+		case "author-time":
+			authorUnix, err = strconv.ParseInt(value, 10, 64)
+		case "author-tz":
+			info.authorTime, err = blameTime(authorUnix, value)
+		case "committer":
+			info.committer = value
+		case "committer-mail":
+			info.commitMail = value
+		case "committer-time":
+			commitUnix, err = strconv.ParseInt(value, 10, 64)
+		case "committer-tz":
+			info.commitTime, err = blameTime(commitUnix, value)
+		case "summary":
+			info.summary = value
+		case "boundary":
+			info.boundary = true
+		case "filename":
+			// Last line of a group.
+			name := value
+			if strings.HasPrefix(name, `"`) {
+				name, err = unquoteCString(name)
+				if err != nil {
+					return nil, err
+				}
+			}
+			curr.OrigPath = TopPath(name)
+			curr.Author = object.User(strings.TrimSpace(info.author + " " + info.authorMail))
+			curr.AuthorTime = info.authorTime
+			curr.Committer = object.User(strings.TrimSpace(info.committer + " " + info.commitMail))
+			curr.CommitTime = info.commitTime
+			curr.Summary = info.summary
+			curr.Boundary = info.boundary
+			ranges = append(ranges, curr)
+			curr = nil
+			info = nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	if curr != nil {
+		return nil, errors.New("unexpected EOF")
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].FinalLine < ranges[j].FinalLine
+	})
+	return ranges, nil
+}
+
+// blameTime converts a Unix timestamp and a timezone offset like "-0800"
+// into a time.Time.
+func blameTime(unix int64, tz string) (time.Time, error) {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return time.Time{}, fmt.Errorf("invalid timezone %q", tz)
+	}
+	hours, err1 := strconv.Atoi(tz[1:3])
+	minutes, err2 := strconv.Atoi(tz[3:])
+	if err1 != nil || err2 != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone %q", tz)
+	}
+	offset := hours*60*60 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return time.Unix(unix, 0).In(time.FixedZone(tz, offset)), nil
+}
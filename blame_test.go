@@ -0,0 +1,191 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"gg-scm.io/pkg/git/object"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestBlame(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	const (
+		author1 object.User = "Lisbeth Salander <lisbeth@example.com>"
+		author2 object.User = "Octo Cat <noreply@github.com>"
+	)
+	time1 := time.Date(2018, time.February, 20, 15, 47, 42, 0, time.FixedZone("-0800", -8*60*60))
+	time2 := time.Date(2018, time.February, 21, 9, 0, 0, 0, time.FixedZone("+0100", 1*60*60))
+
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("sub/foo.txt", "a\nb\nc\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"sub/foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err = env.g.Commit(ctx, "first\n\ndetails", CommitOptions{
+		Author:     author1,
+		AuthorTime: time1,
+		Committer:  author1,
+		CommitTime: time1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev1, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("sub/foo.txt", "a\nB\nc\nd\n")); err != nil {
+		t.Fatal(err)
+	}
+	err = env.g.CommitAll(ctx, "second", CommitOptions{
+		Author:     author2,
+		AuthorTime: time2,
+		Committer:  author2,
+		CommitTime: time2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev2, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.root.Apply(filesystem.Write("sub/ignore-revs", rev2.Commit.String()+"\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	line1 := &BlameRange{
+		Commit:     rev1.Commit,
+		OrigPath:   "sub/foo.txt",
+		OrigLine:   1,
+		FinalLine:  1,
+		NumLines:   1,
+		Author:     author1,
+		AuthorTime: time1,
+		Committer:  author1,
+		CommitTime: time1,
+		Summary:    "first",
+		Boundary:   true,
+	}
+	line2 := &BlameRange{
+		Commit:     rev2.Commit,
+		OrigPath:   "sub/foo.txt",
+		OrigLine:   2,
+		FinalLine:  2,
+		NumLines:   1,
+		Author:     author2,
+		AuthorTime: time2,
+		Committer:  author2,
+		CommitTime: time2,
+		Summary:    "second",
+	}
+	line3 := &BlameRange{
+		Commit:     rev1.Commit,
+		OrigPath:   "sub/foo.txt",
+		OrigLine:   3,
+		FinalLine:  3,
+		NumLines:   1,
+		Author:     author1,
+		AuthorTime: time1,
+		Committer:  author1,
+		CommitTime: time1,
+		Summary:    "first",
+		Boundary:   true,
+	}
+	line4 := &BlameRange{
+		Commit:     rev2.Commit,
+		OrigPath:   "sub/foo.txt",
+		OrigLine:   4,
+		FinalLine:  4,
+		NumLines:   1,
+		Author:     author2,
+		AuthorTime: time2,
+		Committer:  author2,
+		CommitTime: time2,
+		Summary:    "second",
+	}
+	// Ignoring the second commit blames its changed line on the first.
+	line2Ignored := new(BlameRange)
+	*line2Ignored = *line1
+	line2Ignored.OrigLine = 2
+	line2Ignored.FinalLine = 2
+	tests := []struct {
+		name string
+		dir  string
+		opts BlameOptions
+		want []*BlameRange
+	}{
+		{
+			name: "WholeFile",
+			want: []*BlameRange{line1, line2, line3, line4},
+		},
+		{
+			name: "FromSubdirectory",
+			dir:  "sub",
+			want: []*BlameRange{line1, line2, line3, line4},
+		},
+		{
+			name: "IgnoreRevsFileFromSubdirectory",
+			dir:  "sub",
+			opts: BlameOptions{
+				Lines:           []LineRange{{Start: 2, End: 2}},
+				IgnoreRevsFiles: []string{"ignore-revs"},
+			},
+			want: []*BlameRange{line2Ignored},
+		},
+		{
+			name: "LineRanges",
+			opts: BlameOptions{Lines: []LineRange{{Start: 1, End: 1}, {Start: 4, End: 4}}},
+			want: []*BlameRange{line1, line4},
+		},
+	}
+	equateTime := cmp.Comparer(func(t1, t2 time.Time) bool {
+		return t1.Equal(t2)
+	})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := env.g.WithDir(test.dir).Blame(ctx, "HEAD", "sub/foo.txt", test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got, equateTime, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Blame(ctx, \"HEAD\", \"sub/foo.txt\", %+v) (-want +got):\n%s", test.opts, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CherryPickOptions specifies the command-line options for
+// `git cherry-pick` and `git revert`.
+type CherryPickOptions struct {
+	// Mainline is the 1-based parent number to diff against when a
+	// revision is a merge commit. It must be set to pick or revert
+	// merge commits.
+	Mainline int
+
+	// If NoCommit is true, then the changes are applied to the index and
+	// the working copy without creating any commits.
+	NoCommit bool
+
+	// CommitOptions overrides the metadata of the created commits.
+	// Cherry-picked commits always keep the original commits' authors,
+	// so CherryPick returns an error if Author or AuthorTime is set.
+	CommitOptions
+}
+
+// CherryPick applies the changes introduced by the named revisions to
+// HEAD, creating a new commit for each one unless opts.NoCommit is set.
+//
+// If a revision cannot be applied cleanly, CherryPick returns a
+// *ConflictError and leaves the cherry-pick in progress. IsCherryPicking
+// reports true until the caller resolves the conflicts and calls
+// ContinueCherryPick, or calls AbortCherryPick.
+func (g *Git) CherryPick(ctx context.Context, revs []string, opts CherryPickOptions) error {
+	if opts.Author != "" || !opts.AuthorTime.IsZero() {
+		return errors.New("git cherry-pick: cannot override author")
+	}
+	return g.pick(ctx, "cherry-pick", "CHERRY_PICK_HEAD", revs, opts)
+}
+
+// ContinueCherryPick resumes a cherry-pick that stopped because of
+// conflicts after the caller has resolved them and staged the result.
+func (g *Git) ContinueCherryPick(ctx context.Context) error {
+	return g.runSequencer(ctx, "git cherry-pick --continue", []string{"cherry-pick", "--continue"}, nil, "CHERRY_PICK_HEAD")
+}
+
+// AbortCherryPick stops the cherry-pick in progress and restores HEAD
+// and the working copy to their state before the cherry-pick started.
+func (g *Git) AbortCherryPick(ctx context.Context) error {
+	return g.run(ctx, "git cherry-pick --abort", []string{"cherry-pick", "--abort"})
+}
+
+// IsCherryPicking reports whether a cherry-pick stopped on a conflict
+// is in progress.
+func (g *Git) IsCherryPicking(ctx context.Context) (bool, error) {
+	return g.hasGitDirFile(ctx, "check git cherry-pick", "CHERRY_PICK_HEAD")
+}
+
+// Revert creates new commits that undo the changes introduced by the
+// named revisions, one for each revision unless opts.NoCommit is set.
+//
+// If a revision cannot be reverted cleanly, Revert returns a
+// *ConflictError and leaves the revert in progress. IsReverting reports
+// true until the caller resolves the conflicts and calls ContinueRevert,
+// or calls AbortRevert.
+func (g *Git) Revert(ctx context.Context, revs []string, opts CherryPickOptions) error {
+	return g.pick(ctx, "revert", "REVERT_HEAD", revs, opts)
+}
+
+// ContinueRevert resumes a revert that stopped because of conflicts
+// after the caller has resolved them and staged the result.
+func (g *Git) ContinueRevert(ctx context.Context) error {
+	return g.runSequencer(ctx, "git revert --continue", []string{"revert", "--continue"}, nil, "REVERT_HEAD")
+}
+
+// AbortRevert stops the revert in progress and restores HEAD and the
+// working copy to their state before the revert started.
+func (g *Git) AbortRevert(ctx context.Context) error {
+	return g.run(ctx, "git revert --abort", []string{"revert", "--abort"})
+}
+
+// IsReverting reports whether a revert stopped on a conflict is in progress.
+func (g *Git) IsReverting(ctx context.Context) (bool, error) {
+	return g.hasGitDirFile(ctx, "check git revert", "REVERT_HEAD")
+}
+
+// pick runs `git cherry-pick` or `git revert`.
+func (g *Git) pick(ctx context.Context, subcmd string, stoppedRef string, revs []string, opts CherryPickOptions) error {
+	errPrefix := "git " + subcmd
+	if len(revs) == 0 {
+		return errors.New(errPrefix + ": no revisions")
+	}
+	for _, rev := range revs {
+		if err := validateRev(rev); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	if len(revs) == 1 {
+		errPrefix += " " + revs[0]
+	}
+	if opts.Mainline < 0 {
+		return fmt.Errorf("%s: negative mainline", errPrefix)
+	}
+	args := []string{subcmd}
+	if subcmd == "revert" {
+		args = append(args, "--no-edit")
+	}
+	if opts.Mainline > 0 {
+		args = append(args, fmt.Sprintf("--mainline=%d", opts.Mainline))
+	}
+	if opts.NoCommit {
+		args = append(args, "--no-commit")
+	}
+	args = append(args, revs...)
+	args = append(args, "--")
+	return g.runSequencer(ctx, errPrefix, args, opts.CommitOptions.addToEnv(nil), stoppedRef)
+}
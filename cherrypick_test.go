@@ -0,0 +1,309 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"gg-scm.io/pkg/git/object"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCherryPick(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "base\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "base", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.NewBranch(ctx, "feature", BranchOptions{Checkout: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("bar.txt", "bar\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"bar.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "add bar", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "feature\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CommitAll(ctx, "change foo", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	changeFoo, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "checkout", "--quiet", "-b", "main2", "HEAD~2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "main\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CommitAll(ctx, "conflicting change", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	mainHead, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const committer object.User = "Octo Cat <noreply@github.com>"
+	commitTime := time.Date(2018, time.February, 21, 9, 0, 0, 0, time.UTC)
+	err = env.g.CherryPick(ctx, []string{"feature~"}, CherryPickOptions{
+		CommitOptions: CommitOptions{
+			Committer:  committer,
+			CommitTime: commitTime,
+		},
+	})
+	if err != nil {
+		t.Fatal("CherryPick:", err)
+	}
+	head, err := env.g.CommitInfo(ctx, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Message != "add bar" {
+		t.Errorf("HEAD message = %q; want \"add bar\"", head.Message)
+	}
+	if head.Committer != committer || !head.CommitTime.Equal(commitTime) {
+		t.Errorf("HEAD committer = %q @ %v; want %q @ %v", head.Committer, head.CommitTime, committer, commitTime)
+	}
+	if len(head.Parents) != 1 || head.Parents[0] != mainHead.Commit {
+		t.Errorf("HEAD parents = %v; want [%v]", head.Parents, mainHead.Commit)
+	}
+
+	err = env.g.CherryPick(ctx, []string{"feature"}, CherryPickOptions{})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("CherryPick(...) = %v; want *ConflictError", err)
+	}
+	if conflict.Commit != changeFoo.Commit {
+		t.Errorf("conflict.Commit = %v; want %v", conflict.Commit, changeFoo.Commit)
+	}
+	if diff := cmp.Diff([]TopPath{"foo.txt"}, conflict.Paths); diff != "" {
+		t.Errorf("conflict.Paths (-want +got):\n%s", diff)
+	}
+	if picking, err := env.g.IsCherryPicking(ctx); err != nil {
+		t.Error("IsCherryPicking:", err)
+	} else if !picking {
+		t.Error("IsCherryPicking(ctx) = false after conflict; want true")
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "resolved\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.ContinueCherryPick(ctx); err != nil {
+		t.Fatal("ContinueCherryPick:", err)
+	}
+	if picking, err := env.g.IsCherryPicking(ctx); err != nil {
+		t.Error("IsCherryPicking:", err)
+	} else if picking {
+		t.Error("IsCherryPicking(ctx) = true after ContinueCherryPick; want false")
+	}
+	picked, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Revert the resolved cherry-pick, then revert it again with a conflict.
+	if err := env.g.Revert(ctx, []string{"HEAD"}, CherryPickOptions{NoCommit: true}); err != nil {
+		t.Fatal("Revert with NoCommit:", err)
+	}
+	if got, err := env.root.ReadFile("foo.txt"); err != nil {
+		t.Error(err)
+	} else if got != "main\n" {
+		t.Errorf("after Revert, foo.txt = %q; want \"main\\n\"", got)
+	}
+	if head, err := env.g.Head(ctx); err != nil {
+		t.Error(err)
+	} else if head.Commit != picked.Commit {
+		t.Errorf("Revert with NoCommit moved HEAD to %v; want %v", head.Commit, picked.Commit)
+	}
+	if err := env.g.Run(ctx, "reset", "--quiet", "--hard"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "local\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CommitAll(ctx, "another change", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err = env.g.Revert(ctx, []string{picked.Commit.String()}, CherryPickOptions{})
+	if !errors.As(err, &conflict) {
+		t.Fatalf("Revert(...) = %v; want *ConflictError", err)
+	}
+	if conflict.Commit != picked.Commit {
+		t.Errorf("conflict.Commit = %v; want %v", conflict.Commit, picked.Commit)
+	}
+	if reverting, err := env.g.IsReverting(ctx); err != nil {
+		t.Error("IsReverting:", err)
+	} else if !reverting {
+		t.Error("IsReverting(ctx) = false after conflict; want true")
+	}
+	if err := env.g.AbortRevert(ctx); err != nil {
+		t.Fatal("AbortRevert:", err)
+	}
+	if got, err := env.root.ReadFile("foo.txt"); err != nil {
+		t.Error(err)
+	} else if got != "local\n" {
+		t.Errorf("after AbortRevert, foo.txt = %q; want \"local\\n\"", got)
+	}
+}
+
+func TestCherryPickMainline(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	// Create a merge of a branch that adds bar.txt onto a branch that adds
+	// baz.txt, then check out the base commit on a new branch.
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "base\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "base", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.NewBranch(ctx, "feature", BranchOptions{Checkout: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("bar.txt", "bar\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"bar.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "add bar", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "checkout", "--quiet", "-b", "main2", "HEAD~"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("baz.txt", "baz\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"baz.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "add baz", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Merge(ctx, []string{"feature"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "merge feature", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	merge, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "checkout", "--quiet", "-b", "other", "HEAD~2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.g.CherryPick(ctx, []string{merge.Commit.String()}, CherryPickOptions{}); err == nil {
+		t.Error("CherryPick of merge without Mainline did not return an error")
+	}
+	if err := env.g.CherryPick(ctx, []string{merge.Commit.String()}, CherryPickOptions{Mainline: 1}); err != nil {
+		t.Fatal("CherryPick:", err)
+	}
+	tree, err := env.g.ListTree(ctx, "HEAD", ListTreeOptions{NameOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[TopPath]*TreeEntry{"foo.txt": nil, "bar.txt": nil}
+	if diff := cmp.Diff(want, tree); diff != "" {
+		t.Errorf("after picking merge with Mainline 1, tree (-want +got):\n%s", diff)
+	}
+
+	// Reverting the merge against its second parent removes baz.txt.
+	// The author may be overridden for reverts, but not for cherry-picks.
+	if err := env.g.Run(ctx, "checkout", "--quiet", merge.Commit.String()); err != nil {
+		t.Fatal(err)
+	}
+	const author object.User = "Octo Cat <noreply@github.com>"
+	authorTime := time.Date(2018, time.February, 21, 9, 0, 0, 0, time.UTC)
+	opts := CherryPickOptions{
+		Mainline: 2,
+		CommitOptions: CommitOptions{
+			Author:     author,
+			AuthorTime: authorTime,
+		},
+	}
+	if err := env.g.CherryPick(ctx, []string{"feature"}, opts); err == nil {
+		t.Error("CherryPick with Author did not return an error")
+	}
+	if err := env.g.Revert(ctx, []string{merge.Commit.String()}, opts); err != nil {
+		t.Fatal("Revert:", err)
+	}
+	tree, err = env.g.ListTree(ctx, "HEAD", ListTreeOptions{NameOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[TopPath]*TreeEntry{"foo.txt": nil, "bar.txt": nil}
+	if diff := cmp.Diff(want, tree); diff != "" {
+		t.Errorf("after reverting merge with Mainline 2, tree (-want +got):\n%s", diff)
+	}
+	head, err := env.g.CommitInfo(ctx, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Author != author || !head.AuthorTime.Equal(authorTime) {
+		t.Errorf("HEAD author = %q @ %v; want %q @ %v", head.Author, head.AuthorTime, author, authorTime)
+	}
+}
@@ -20,33 +20,204 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 )
 
 // Config is a collection of configuration settings.
 type Config struct {
 	data []byte
+	// origins is parallel to the entries in data.
+	// It is nil if origins were not read.
+	origins []ConfigOrigin
+	// prefix is Git's installation prefix, used to expand "%(prefix)/"
+	// in path values. It is empty if unknown.
+	prefix string
+}
+
+// ConfigScope identifies a set of configuration files.
+//
+// When reading configuration, the zero value reads from all scopes.
+// When writing configuration, the zero value writes to the repository's
+// local configuration.
+type ConfigScope string
+
+// Configuration scopes.
+const (
+	// LocalConfig is the repository's configuration file.
+	LocalConfig ConfigScope = "local"
+	// GlobalConfig is the user's configuration file.
+	GlobalConfig ConfigScope = "global"
+	// SystemConfig is the system-wide configuration file.
+	SystemConfig ConfigScope = "system"
+	// WorktreeConfig is the configuration file for the current worktree.
+	// The repository must have the extensions.worktreeConfig setting
+	// enabled to write to it.
+	WorktreeConfig ConfigScope = "worktree"
+	// CommandLineConfig is the scope of settings passed on the command
+	// line or through the environment. It is only reported in origins and
+	// cannot be read from or written to directly.
+	CommandLineConfig ConfigScope = "command"
+)
+
+const configFileScopePrefix = "file:"
+
+// ConfigFile returns a scope that consists of only the configuration file
+// at the given path.
+func ConfigFile(path string) ConfigScope {
+	return ConfigScope(configFileScopePrefix + path)
+}
+
+// flag returns the `git config` option for the scope.
+func (scope ConfigScope) flag() (string, error) {
+	switch scope {
+	case "":
+		return "", nil
+	case LocalConfig, GlobalConfig, SystemConfig, WorktreeConfig:
+		return "--" + string(scope), nil
+	}
+	if path := strings.TrimPrefix(string(scope), configFileScopePrefix); len(path) < len(scope) {
+		if path == "" {
+			return "", errors.New("empty config file path")
+		}
+		return "--file=" + path, nil
+	}
+	return "", fmt.Errorf("invalid config scope %q", string(scope))
+}
+
+// ConfigOrigin describes where a configuration setting's value came from.
+type ConfigOrigin struct {
+	// Scope is the scope of the origin. It is empty if the Git version is
+	// older than 2.26, which added reporting of scopes.
+	Scope ConfigScope
+	// Origin is Git's description of the origin,
+	// like "file:.git/config" or "command line:".
+	Origin string
+}
+
+// File returns the path of the configuration file that the value was
+// read from or the empty string if the value did not come from a file.
+// Relative paths are relative to the Git process's working directory.
+func (origin ConfigOrigin) File() string {
+	if !strings.HasPrefix(origin.Origin, configFileScopePrefix) {
+		return ""
+	}
+	return origin.Origin[len(configFileScopePrefix):]
 }
 
 // ReadConfig reads all the configuration settings from Git.
 func (g *Git) ReadConfig(ctx context.Context) (*Config, error) {
+	return g.ReadConfigScope(ctx, "")
+}
+
+// ReadConfigScope reads the configuration settings in the given scope from
+// Git. The returned Config records the origin of each setting.
+func (g *Git) ReadConfigScope(ctx context.Context, scope ConfigScope) (*Config, error) {
+	const errPrefix = "read git config"
+	scopeFlag, err := scope.flag()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	args := []string{"config", "-z", "--list", "--show-origin"}
+	showScope := false
+	if version, err := g.getVersion(ctx); err == nil && versionAtLeast(version, 2, 26) {
+		args = append(args, "--show-scope")
+		showScope = true
+	}
+	if scopeFlag != "" {
+		args = append(args, scopeFlag)
+	}
 	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
-	err := g.runner.RunGit(ctx, &Invocation{
-		Args:   []string{"config", "-z", "--list"},
+	err = g.runner.RunGit(ctx, &Invocation{
+		Args:   args,
 		Dir:    g.dir,
 		Stdout: &limitWriter{w: stdout, n: dataOutputLimit},
-		Stderr: &limitWriter{w: stdout, n: errorOutputLimit},
+		Stderr: &limitWriter{w: stderr, n: errorOutputLimit},
 	})
 	if err != nil {
-		return nil, commandError("read git config", err, stderr.Bytes())
+		return nil, commandError(errPrefix, err, stderr.Bytes())
 	}
-	cfg, err := parseConfig(stdout.Bytes())
+	cfg, err := parseConfigWithOrigins(stdout.Bytes(), showScope)
 	if err != nil {
-		return nil, fmt.Errorf("read git config: %w", err)
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if bytes.Contains(cfg.data, []byte(configPrefixVar)) {
+		// Only ask for the exec path when a value could use it,
+		// since it's an extra subprocess.
+		if execPath, err := g.output(ctx, "git --exec-path", []string{"--exec-path"}); err == nil {
+			cfg.prefix = execPathPrefix(g.fs, strings.TrimSuffix(execPath, "\n"))
+		}
 	}
 	return cfg, nil
 }
 
+// execPathPrefix returns Git's installation prefix from the output of
+// `git --exec-path`, which is conventionally "PREFIX/libexec/git-core" or
+// "PREFIX/lib/git-core".
+func execPathPrefix(fs FileSystem, execPath string) string {
+	if execPath == "" || !fs.IsAbs(execPath) {
+		return ""
+	}
+	return fs.Join(execPath, "..", "..")
+}
+
+// SetConfig sets the configuration setting with the given name in the
+// given scope, replacing any existing values.
+func (g *Git) SetConfig(ctx context.Context, scope ConfigScope, name, value string) error {
+	errPrefix := fmt.Sprintf("git config %s", name)
+	return g.writeConfig(ctx, errPrefix, scope, []string{"--replace-all", "--", name, value})
+}
+
+// AddConfigValue adds a value to the multi-valued configuration setting with
+// the given name in the given scope. Existing values are kept.
+func (g *Git) AddConfigValue(ctx context.Context, scope ConfigScope, name, value string) error {
+	errPrefix := fmt.Sprintf("git config --add %s", name)
+	return g.writeConfig(ctx, errPrefix, scope, []string{"--add", "--", name, value})
+}
+
+// UnsetConfig removes all values of the configuration setting with the
+// given name from the given scope. It is not an error if the setting
+// is not present.
+func (g *Git) UnsetConfig(ctx context.Context, scope ConfigScope, name string) error {
+	errPrefix := fmt.Sprintf("git config --unset-all %s", name)
+	err := g.writeConfig(ctx, errPrefix, scope, []string{"--unset-all", "--", name})
+	if exitCode(err) == 5 {
+		// Exit code 5 means the setting was not present.
+		return nil
+	}
+	return err
+}
+
+// RenameConfigSection renames a configuration section, like
+// "remote.origin", in the given scope.
+func (g *Git) RenameConfigSection(ctx context.Context, scope ConfigScope, oldName, newName string) error {
+	errPrefix := fmt.Sprintf("git config --rename-section %s %s", oldName, newName)
+	return g.writeConfig(ctx, errPrefix, scope, []string{"--rename-section", "--", oldName, newName})
+}
+
+// RemoveConfigSection removes a configuration section, like
+// "remote.origin", and all of its settings from the given scope.
+func (g *Git) RemoveConfigSection(ctx context.Context, scope ConfigScope, name string) error {
+	errPrefix := fmt.Sprintf("git config --remove-section %s", name)
+	return g.writeConfig(ctx, errPrefix, scope, []string{"--remove-section", "--", name})
+}
+
+func (g *Git) writeConfig(ctx context.Context, errPrefix string, scope ConfigScope, args []string) error {
+	if scope == CommandLineConfig {
+		return fmt.Errorf("%s: cannot write to command line config", errPrefix)
+	}
+	scopeFlag, err := scope.flag()
+	if err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	fullArgs := []string{"config"}
+	if scopeFlag != "" {
+		fullArgs = append(fullArgs, scopeFlag)
+	}
+	fullArgs = append(fullArgs, args...)
+	return g.run(ctx, errPrefix, fullArgs)
+}
+
 func parseConfig(data []byte) (*Config, error) {
 	cfg := &Config{
 		data: data,
@@ -56,12 +227,56 @@ func parseConfig(data []byte) (*Config, error) {
 		if end == -1 {
 			return nil, io.ErrUnexpectedEOF
 		}
-		toLower(k)
+		normalizeConfigKey(k)
 		off += end
 	}
 	return cfg, nil
 }
 
+// parseConfigWithOrigins parses the output of
+// `git config -z --list --show-origin [--show-scope]`.
+// The origin fields are removed from the data in place.
+func parseConfigWithOrigins(data []byte, showScope bool) (*Config, error) {
+	cfg := &Config{
+		origins: []ConfigOrigin{},
+	}
+	nextField := func(b []byte) (string, int) {
+		i := bytes.IndexByte(b, 0)
+		if i == -1 {
+			return "", -1
+		}
+		return string(b[:i]), i + 1
+	}
+	n := 0
+	for off := 0; off < len(data); {
+		var origin ConfigOrigin
+		if showScope {
+			scope, end := nextField(data[off:])
+			if end == -1 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			origin.Scope = ConfigScope(scope)
+			off += end
+		}
+		var end int
+		origin.Origin, end = nextField(data[off:])
+		if end == -1 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		off += end
+		k, _, end := splitConfigEntry(data[off:])
+		if end == -1 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		normalizeConfigKey(k)
+		n += copy(data[n:], data[off:off+end])
+		off += end
+		cfg.origins = append(cfg.origins, origin)
+	}
+	cfg.data = data[:n]
+	return cfg, nil
+}
+
 // splitConfigEntry parses the next zero-terminated config entry, as in
 // output from git config -z --list. If v == nil, then the configuration
 // setting had no equals sign (usually means true for a boolean).
@@ -126,6 +341,30 @@ func (cfg *Config) Bool(name string) (bool, error) {
 	return b, nil
 }
 
+// Origin returns where the last value of the configuration setting with
+// the given name came from. It returns false if the setting is not present
+// or the Config was not read with origins.
+func (cfg *Config) Origin(name string) (_ ConfigOrigin, found bool) {
+	if cfg.origins == nil {
+		return ConfigOrigin{}, false
+	}
+	norm := []byte(name)
+	normalizeConfigKey(norm)
+	var origin ConfigOrigin
+	for i, off := 0, 0; off < len(cfg.data); i++ {
+		k, _, end := splitConfigEntry(cfg.data[off:])
+		if end == -1 {
+			break
+		}
+		if bytes.Equal(k, norm) {
+			origin = cfg.origins[i]
+			found = true
+		}
+		off += end
+	}
+	return origin, found
+}
+
 // Remote stores the configuration for a remote repository.
 type Remote struct {
 	Name     string
@@ -209,7 +448,7 @@ func (cfg *Config) ListRemotes() map[string]*Remote {
 
 func (cfg *Config) findLast(name string) (value []byte, found bool) {
 	norm := []byte(name)
-	toLower(norm)
+	normalizeConfigKey(norm)
 	for off := 0; off < len(cfg.data); {
 		k, v, end := splitConfigEntry(cfg.data[off:])
 		if end == -1 {
@@ -240,6 +479,20 @@ func parseBool(v []byte) (_ bool, ok bool) {
 	}
 }
 
+// normalizeConfigKey converts a configuration setting name to its canonical
+// form in place. Section and variable names are case-insensitive, but
+// subsection names (everything between the first and last dots) are not.
+func normalizeConfigKey(k []byte) {
+	i := bytes.IndexByte(k, '.')
+	j := bytes.LastIndexByte(k, '.')
+	if i == -1 || i == j {
+		toLower(k)
+		return
+	}
+	toLower(k[:i])
+	toLower(k[j+1:])
+}
+
 func toLower(b []byte) {
 	// Git case-sensitivity is only used in ASCII contexts (configuration
 	// setting names and booleans). Supporting Unicode could require
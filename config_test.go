@@ -302,6 +302,209 @@ func TestListRemotes(t *testing.T) {
 	}
 }
 
+func TestParseConfigWithOrigins(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		showScope bool
+		key       string
+		wantValue string
+		want      ConfigOrigin
+		wantFound bool
+	}{
+		{
+			name: "Empty",
+			data: "",
+			key:  "foo.bar",
+		},
+		{
+			name:      "NoScope",
+			data:      "file:.git/config\x00foo.bar\nbaz\x00",
+			key:       "foo.bar",
+			wantValue: "baz",
+			want:      ConfigOrigin{Origin: "file:.git/config"},
+			wantFound: true,
+		},
+		{
+			name:      "Scope",
+			data:      "global\x00file:/home/me/.gitconfig\x00foo.bar\nbaz\x00",
+			showScope: true,
+			key:       "FOO.BAR",
+			wantValue: "baz",
+			want:      ConfigOrigin{Scope: GlobalConfig, Origin: "file:/home/me/.gitconfig"},
+			wantFound: true,
+		},
+		{
+			name: "LastWins",
+			data: "global\x00file:/home/me/.gitconfig\x00foo.bar\nbaz\x00" +
+				"local\x00file:.git/config\x00foo.bar\nquux\x00" +
+				"command\x00command line:\x00foo.other\x00",
+			showScope: true,
+			key:       "foo.bar",
+			wantValue: "quux",
+			want:      ConfigOrigin{Scope: LocalConfig, Origin: "file:.git/config"},
+			wantFound: true,
+		},
+		{
+			name:      "Missing",
+			data:      "local\x00file:.git/config\x00foo.bar\nbaz\x00",
+			showScope: true,
+			key:       "foo.salad",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := parseConfigWithOrigins([]byte(test.data), test.showScope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cfg.Value(test.key); got != test.wantValue {
+				t.Errorf("cfg.Value(%q) = %q; want %q", test.key, got, test.wantValue)
+			}
+			got, found := cfg.Origin(test.key)
+			if got != test.want || found != test.wantFound {
+				t.Errorf("cfg.Origin(%q) = %+v, %t; want %+v, %t", test.key, got, found, test.want, test.wantFound)
+			}
+		})
+	}
+
+	t.Run("Truncated", func(t *testing.T) {
+		data := "local\x00file:.git/config\x00foo.bar\nbaz"
+		if _, err := parseConfigWithOrigins([]byte(data), true); err == nil {
+			t.Errorf("parseConfigWithOrigins(%q, true) did not return an error", data)
+		}
+	})
+}
+
+func TestConfigOriginFile(t *testing.T) {
+	tests := []struct {
+		origin ConfigOrigin
+		want   string
+	}{
+		{ConfigOrigin{}, ""},
+		{ConfigOrigin{Origin: "file:.git/config"}, ".git/config"},
+		{ConfigOrigin{Scope: GlobalConfig, Origin: "file:/home/me/.gitconfig"}, "/home/me/.gitconfig"},
+		{ConfigOrigin{Scope: CommandLineConfig, Origin: "command line:"}, ""},
+		{ConfigOrigin{Origin: "blob:abc123"}, ""},
+	}
+	for _, test := range tests {
+		if got := test.origin.File(); got != test.want {
+			t.Errorf("%+v.File() = %q; want %q", test.origin, got, test.want)
+		}
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.top.Apply(filesystem.Write(".gitconfig", "[foo]\n\tbar = global\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.g.SetConfig(ctx, LocalConfig, "foo.bar", "local"); err != nil {
+		t.Fatal("SetConfig:", err)
+	}
+	if err := env.g.AddConfigValue(ctx, LocalConfig, "foo.multi", "1"); err != nil {
+		t.Fatal("AddConfigValue:", err)
+	}
+	if err := env.g.AddConfigValue(ctx, LocalConfig, "foo.multi", "2"); err != nil {
+		t.Fatal("AddConfigValue:", err)
+	}
+	cfg, err := env.g.ReadConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.Value("foo.bar"), "local"; got != want {
+		t.Errorf("after SetConfig, cfg.Value(\"foo.bar\") = %q; want %q", got, want)
+	}
+	if origin, found := cfg.Origin("foo.bar"); !found {
+		t.Error("cfg.Origin(\"foo.bar\") not found")
+	} else if got, want := origin.File(), ".git/config"; got != want {
+		t.Errorf("cfg.Origin(\"foo.bar\").File() = %q; want %q", got, want)
+	}
+	multi, err := env.g.Output(ctx, "config", "--local", "--get-all", "foo.multi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1\n2\n"; multi != want {
+		t.Errorf("after AddConfigValue twice, foo.multi = %q; want %q", multi, want)
+	}
+
+	globalCfg, err := env.g.ReadConfigScope(ctx, GlobalConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := globalCfg.Value("foo.bar"), "global"; got != want {
+		t.Errorf("ReadConfigScope(ctx, GlobalConfig).Value(\"foo.bar\") = %q; want %q", got, want)
+	}
+	if got := globalCfg.Value("foo.multi"); got != "" {
+		t.Errorf("ReadConfigScope(ctx, GlobalConfig).Value(\"foo.multi\") = %q; want \"\"", got)
+	}
+
+	if err := env.g.SetConfig(ctx, ConfigFile("other.cfg"), "baz.quux", "xyzzy"); err != nil {
+		t.Fatal("SetConfig(ConfigFile):", err)
+	}
+	otherData, err := env.root.ReadFile("other.cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(otherData, "xyzzy") {
+		t.Errorf("other.cfg = %q; want to contain \"xyzzy\"", otherData)
+	}
+
+	if err := env.g.RenameConfigSection(ctx, LocalConfig, "foo", "renamed"); err != nil {
+		t.Fatal("RenameConfigSection:", err)
+	}
+	if err := env.g.UnsetConfig(ctx, LocalConfig, "renamed.multi"); err != nil {
+		t.Fatal("UnsetConfig:", err)
+	}
+	if err := env.g.UnsetConfig(ctx, LocalConfig, "renamed.multi"); err != nil {
+		t.Error("UnsetConfig on missing setting:", err)
+	}
+	cfg, err = env.g.ReadConfigScope(ctx, LocalConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.Value("renamed.bar"), "local"; got != want {
+		t.Errorf("after rename, cfg.Value(\"renamed.bar\") = %q; want %q", got, want)
+	}
+	if got := cfg.Value("renamed.multi"); got != "" {
+		t.Errorf("after UnsetConfig, cfg.Value(\"renamed.multi\") = %q; want \"\"", got)
+	}
+	if got := cfg.Value("foo.bar"); got != "" {
+		t.Errorf("after rename, local cfg.Value(\"foo.bar\") = %q; want \"\"", got)
+	}
+
+	if err := env.g.RemoveConfigSection(ctx, LocalConfig, "renamed"); err != nil {
+		t.Fatal("RemoveConfigSection:", err)
+	}
+	cfg, err = env.g.ReadConfigScope(ctx, LocalConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Value("renamed.bar"); got != "" {
+		t.Errorf("after RemoveConfigSection, cfg.Value(\"renamed.bar\") = %q; want \"\"", got)
+	}
+
+	if err := env.g.SetConfig(ctx, CommandLineConfig, "foo.bar", "x"); err == nil {
+		t.Error("SetConfig(ctx, CommandLineConfig, ...) did not return an error")
+	}
+	if err := env.g.SetConfig(ctx, "bogus", "foo.bar", "x"); err == nil {
+		t.Error("SetConfig(ctx, \"bogus\", ...) did not return an error")
+	}
+}
+
 func BenchmarkReadConfig(b *testing.B) {
 	gitPath, err := findGit()
 	if err != nil {
@@ -0,0 +1,327 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Int64 returns the integer configuration setting with the given name.
+// As in Git, the value may have a "k", "m", or "g" suffix (case-insensitive)
+// to scale it by 1024, 1024², or 1024³ respectively.
+func (cfg *Config) Int64(name string) (int64, error) {
+	v, ok := cfg.findLast(name)
+	if !ok {
+		return 0, fmt.Errorf("config %s: not found", name)
+	}
+	n, err := parseConfigInt(v)
+	if err != nil {
+		return 0, fmt.Errorf("config %s: %w", name, err)
+	}
+	return n, nil
+}
+
+func parseConfigInt(v []byte) (int64, error) {
+	if len(v) == 0 {
+		return 0, errors.New("missing integer value")
+	}
+	s := strings.TrimLeft(string(v), " \t\n\v\f\r")
+	numEnd := 0
+	if numEnd < len(s) && (s[numEnd] == '+' || s[numEnd] == '-') {
+		numEnd++
+	}
+	for numEnd < len(s) && '0' <= s[numEnd] && s[numEnd] <= '9' {
+		numEnd++
+	}
+	n, err := strconv.ParseInt(s[:numEnd], 10, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, fmt.Errorf("%q out of range", v)
+		}
+		return 0, fmt.Errorf("cannot parse %q as an integer", v)
+	}
+	var factor int64
+	switch s[numEnd:] {
+	case "":
+		factor = 1
+	case "k", "K":
+		factor = 1 << 10
+	case "m", "M":
+		factor = 1 << 20
+	case "g", "G":
+		factor = 1 << 30
+	default:
+		return 0, fmt.Errorf("cannot parse %q as an integer: unknown unit", v)
+	}
+	if n > math.MaxInt64/factor || n < math.MinInt64/factor {
+		return 0, fmt.Errorf("%q out of range", v)
+	}
+	return n * factor, nil
+}
+
+// configPrefixVar is the placeholder in path values that Git replaces with
+// its installation prefix.
+const configPrefixVar = "%(prefix)/"
+
+// Path returns the path configuration setting with the given name.
+// As in Git, a leading "~/" or "~user/" is replaced with the home directory
+// of the current user or the named user, respectively. A leading
+// "%(prefix)/" is replaced with Git's installation prefix, which is
+// only known if the Config was obtained from *Git.ReadConfig or
+// *Git.ReadConfigScope.
+func (cfg *Config) Path(name string) (string, error) {
+	v, ok := cfg.findLast(name)
+	if !ok {
+		return "", fmt.Errorf("config %s: not found", name)
+	}
+	if v == nil {
+		return "", fmt.Errorf("config %s: missing path value", name)
+	}
+	path, err := expandConfigPath(string(v), cfg.prefix)
+	if err != nil {
+		return "", fmt.Errorf("config %s: %w", name, err)
+	}
+	return path, nil
+}
+
+func expandConfigPath(path string, prefix string) (string, error) {
+	switch {
+	case strings.HasPrefix(path, configPrefixVar):
+		if prefix == "" {
+			return "", errors.New("expand " + configPrefixVar + ": Git installation prefix unknown")
+		}
+		return strings.TrimSuffix(prefix, "/") + path[len(configPrefixVar)-1:], nil
+	case strings.HasPrefix(path, "~"):
+		userEnd := strings.IndexByte(path, '/')
+		if userEnd == -1 {
+			userEnd = len(path)
+		}
+		var home string
+		if userEnd == 1 {
+			var err error
+			home, err = os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("expand ~: %w", err)
+			}
+		} else {
+			u, err := user.Lookup(path[1:userEnd])
+			if err != nil {
+				return "", fmt.Errorf("expand %s: %w", path[:userEnd], err)
+			}
+			home = u.HomeDir
+		}
+		return home + path[userEnd:], nil
+	default:
+		return path, nil
+	}
+}
+
+// All returns all the values of the configuration setting with the given
+// name in the order they were read. Settings without an equals sign are
+// returned as empty strings.
+func (cfg *Config) All(name string) []string {
+	norm := []byte(name)
+	normalizeConfigKey(norm)
+	var values []string
+	for off := 0; off < len(cfg.data); {
+		k, v, end := splitConfigEntry(cfg.data[off:])
+		if end == -1 {
+			break
+		}
+		if bytes.Equal(k, norm) {
+			values = append(values, string(v))
+		}
+		off += end
+	}
+	return values
+}
+
+// ExpiryDate returns the expiry date configuration setting with the given
+// name, like gc.reflogExpire. It understands relative dates like
+// "2.weeks.ago" and absolute dates like "2006-01-02 15:04:05 -0700".
+// Relative dates are computed from now. The values "now" and "all" return
+// now. The values "never" and "false" return the zero time.
+func (cfg *Config) ExpiryDate(name string, now time.Time) (time.Time, error) {
+	v, ok := cfg.findLast(name)
+	if !ok {
+		return time.Time{}, fmt.Errorf("config %s: not found", name)
+	}
+	if v == nil {
+		return time.Time{}, fmt.Errorf("config %s: missing date value", name)
+	}
+	t, err := parseExpiryDate(string(v), now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("config %s: %w", name, err)
+	}
+	return t, nil
+}
+
+func parseExpiryDate(s string, now time.Time) (time.Time, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "never", "false":
+		return time.Time{}, nil
+	case "now", "all":
+		return now, nil
+	}
+	if t, ok := parseAbsoluteDate(s, now.Location()); ok {
+		return t, nil
+	}
+	if t, ok := parseRelativeDate(s, now); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a date", s)
+}
+
+var absoluteDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	"Mon Jan 2 15:04:05 2006 -0700",
+}
+
+func parseAbsoluteDate(s string, loc *time.Location) (_ time.Time, ok bool) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "@") {
+		sec, err := strconv.ParseInt(s[1:], 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(sec, 0).In(loc), true
+	}
+	for _, layout := range absoluteDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseRelativeDate parses a sequence of quantities and units, like
+// "2.weeks.ago" or "1 year 3 months ago". As in Git, the trailing "ago"
+// is optional and relative dates always refer to the past.
+func parseRelativeDate(s string, now time.Time) (_ time.Time, ok bool) {
+	words := strings.FieldsFunc(strings.ToLower(s), func(c rune) bool {
+		return c == '.' || c == ' ' || c == '\t' || c == '_' || c == ','
+	})
+	if len(words) > 0 && words[len(words)-1] == "ago" {
+		words = words[:len(words)-1]
+	}
+	if len(words) == 0 {
+		return time.Time{}, false
+	}
+	t := now
+	for len(words) > 0 {
+		if words[0] == "yesterday" {
+			t = t.AddDate(0, 0, -1)
+			words = words[1:]
+			continue
+		}
+		if len(words) < 2 {
+			return time.Time{}, false
+		}
+		n, err := strconv.Atoi(words[0])
+		if err != nil || n < 0 {
+			return time.Time{}, false
+		}
+		switch strings.TrimSuffix(words[1], "s") {
+		case "second":
+			t = t.Add(-time.Duration(n) * time.Second)
+		case "minute":
+			t = t.Add(-time.Duration(n) * time.Minute)
+		case "hour":
+			t = t.Add(-time.Duration(n) * time.Hour)
+		case "day":
+			t = t.AddDate(0, 0, -n)
+		case "week":
+			t = t.AddDate(0, 0, -7*n)
+		case "fortnight":
+			t = t.AddDate(0, 0, -14*n)
+		case "month":
+			t = t.AddDate(0, -n, 0)
+		case "year":
+			t = t.AddDate(-n, 0, 0)
+		default:
+			return time.Time{}, false
+		}
+		words = words[2:]
+	}
+	return t, true
+}
+
+// Sections returns the names of all the sections in the configuration,
+// in the order they first appear. Section names are lowercased.
+func (cfg *Config) Sections() []string {
+	var sections []string
+	seen := make(map[string]struct{})
+	for off := 0; off < len(cfg.data); {
+		k, _, end := splitConfigEntry(cfg.data[off:])
+		if end == -1 {
+			break
+		}
+		off += end
+		i := bytes.IndexByte(k, '.')
+		if i == -1 {
+			continue
+		}
+		if _, dup := seen[string(k[:i])]; !dup {
+			section := string(k[:i])
+			seen[section] = struct{}{}
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// Subsections returns the names of all the subsections of the given section,
+// in the order they first appear. For example, cfg.Subsections("branch")
+// returns the names of every branch with configuration settings.
+// Subsection names are case-sensitive.
+func (cfg *Config) Subsections(section string) []string {
+	prefix := []byte(section + ".")
+	toLower(prefix)
+	var subsections []string
+	seen := make(map[string]struct{})
+	for off := 0; off < len(cfg.data); {
+		k, _, end := splitConfigEntry(cfg.data[off:])
+		if end == -1 {
+			break
+		}
+		off += end
+		if !bytes.HasPrefix(k, prefix) {
+			continue
+		}
+		i := bytes.LastIndexByte(k, '.')
+		if i < len(prefix) {
+			continue
+		}
+		sub := k[len(prefix):i]
+		if _, dup := seen[string(sub)]; !dup {
+			seen[string(sub)] = struct{}{}
+			subsections = append(subsections, string(sub))
+		}
+	}
+	return subsections
+}
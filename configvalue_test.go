@@ -0,0 +1,258 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfigInt64(t *testing.T) {
+	tests := []struct {
+		config string
+		name   string
+	}{
+		{"", "foo.bar"},
+		{"[foo]\n\tbar\n", "foo.bar"},
+		{"[foo]\n\tbar =\n", "foo.bar"},
+		{"[foo]\n\tbar = 0\n", "foo.bar"},
+		{"[foo]\n\tbar = 42\n", "foo.bar"},
+		{"[foo]\n\tbar = 42\n", "FOO.BAR"},
+		{"[foo]\n\tbar = -42\n", "foo.bar"},
+		{"[foo]\n\tbar = +42\n", "foo.bar"},
+		{"[foo]\n\tbar = 1k\n", "foo.bar"},
+		{"[foo]\n\tbar = 1K\n", "foo.bar"},
+		{"[foo]\n\tbar = 3m\n", "foo.bar"},
+		{"[foo]\n\tbar = 2G\n", "foo.bar"},
+		{"[foo]\n\tbar = -2g\n", "foo.bar"},
+		{"[foo]\n\tbar = 1x\n", "foo.bar"},
+		{"[foo]\n\tbar = 1kb\n", "foo.bar"},
+		{"[foo]\n\tbar = abc\n", "foo.bar"},
+		{"[foo]\n\tbar = 9223372036854775807\n", "foo.bar"},
+		{"[foo]\n\tbar = 9223372036854775808\n", "foo.bar"},
+		{"[foo]\n\tbar = 9007199254740992k\n", "foo.bar"},
+	}
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	for _, test := range tests {
+		if err := env.top.Apply(filesystem.Write(".gitconfig", test.config)); err != nil {
+			t.Error(err)
+			continue
+		}
+		cfg, err := env.g.ReadConfig(ctx)
+		if err != nil {
+			t.Errorf("For %q: %v", test.config, err)
+			continue
+		}
+		got, gotErr := cfg.Int64(test.name)
+		out, wantErr := env.g.Output(ctx, "config", "--int", test.name)
+		if wantErr != nil {
+			if gotErr == nil {
+				t.Errorf("For %q, cfg.Int64(%q) = %d, <nil>; want error", test.config, test.name, got)
+			}
+			continue
+		}
+		if gotErr != nil {
+			t.Errorf("For %q, cfg.Int64(%q): %v", test.config, test.name, gotErr)
+			continue
+		}
+		want, err := strconv.ParseInt(strings.TrimSuffix(out, "\n"), 10, 64)
+		if err != nil {
+			t.Errorf("For %q, `git config --int %s` printed unknown value %q", test.config, test.name, out)
+			continue
+		}
+		if got != want {
+			t.Errorf("For %q, cfg.Int64(%q) = %d; want %d", test.config, test.name, got, want)
+		}
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory:", err)
+	}
+	tests := []struct {
+		data    string
+		prefix  string
+		want    string
+		wantErr bool
+	}{
+		{data: "", wantErr: true},
+		{data: "foo.bar\x00", wantErr: true},
+		{data: "foo.bar\n\x00", want: ""},
+		{data: "foo.bar\n/abs/path\x00", want: "/abs/path"},
+		{data: "foo.bar\nrel/path\x00", want: "rel/path"},
+		{data: "foo.bar\n~\x00", want: home},
+		{data: "foo.bar\n~/x/y\x00", want: home + "/x/y"},
+		{data: "foo.bar\nfoo~/x\x00", want: "foo~/x"},
+		{data: "foo.bar\n%(prefix)/etc/gitconfig\x00", prefix: "/usr", want: "/usr/etc/gitconfig"},
+		{data: "foo.bar\n%(prefix)/etc/gitconfig\x00", prefix: "/usr/", want: "/usr/etc/gitconfig"},
+		{data: "foo.bar\n%(prefix)/etc/gitconfig\x00", wantErr: true},
+		{data: "foo.bar\n~nonexistent-user-for-gg-test/x\x00", wantErr: true},
+	}
+	for _, test := range tests {
+		cfg, err := parseConfig([]byte(test.data))
+		if err != nil {
+			t.Errorf("parseConfig(%q): %v", test.data, err)
+			continue
+		}
+		cfg.prefix = test.prefix
+		got, err := cfg.Path("foo.bar")
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("For %q (prefix %q), cfg.Path(\"foo.bar\"): %v", test.data, test.prefix, err)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("For %q (prefix %q), cfg.Path(\"foo.bar\") = %q, <nil>; want error", test.data, test.prefix, got)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("For %q (prefix %q), cfg.Path(\"foo.bar\") = %q; want %q", test.data, test.prefix, got, test.want)
+		}
+	}
+}
+
+func TestConfigAll(t *testing.T) {
+	const data = "foo.bar\n1\x00" +
+		"foo.baz\nx\x00" +
+		"FOO.BAR\n2\x00" +
+		"foo.bar\x00" +
+		"foo.bar\n3\x00"
+	cfg, err := parseConfig([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.All("Foo.Bar"), []string{"1", "2", "", "3"}; !cmp.Equal(want, got) {
+		t.Errorf("cfg.All(\"Foo.Bar\") = %q; want %q", got, want)
+	}
+	if got := cfg.All("foo.missing"); len(got) != 0 {
+		t.Errorf("cfg.All(\"foo.missing\") = %q; want []", got)
+	}
+}
+
+func TestParseExpiryDate(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	now := time.Date(2021, time.March, 31, 12, 0, 0, 0, loc)
+	tests := []struct {
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{s: "never", want: time.Time{}},
+		{s: "false", want: time.Time{}},
+		{s: "now", want: now},
+		{s: "all", want: now},
+		{s: "2.weeks.ago", want: time.Date(2021, time.March, 17, 12, 0, 0, 0, loc)},
+		{s: "2.weeks", want: time.Date(2021, time.March, 17, 12, 0, 0, 0, loc)},
+		{s: "1 week ago", want: time.Date(2021, time.March, 24, 12, 0, 0, 0, loc)},
+		{s: "90.days.ago", want: time.Date(2020, time.December, 31, 12, 0, 0, 0, loc)},
+		{s: "30_minutes_ago", want: time.Date(2021, time.March, 31, 11, 30, 0, 0, loc)},
+		{s: "1.year.3.months.ago", want: time.Date(2019, time.December, 31, 12, 0, 0, 0, loc)},
+		{s: "1.hour.30.seconds.ago", want: time.Date(2021, time.March, 31, 10, 59, 30, 0, loc)},
+		{s: "yesterday", want: time.Date(2021, time.March, 30, 12, 0, 0, 0, loc)},
+		{s: "1.fortnight.ago", want: time.Date(2021, time.March, 17, 12, 0, 0, 0, loc)},
+		{s: "2006-01-02", want: time.Date(2006, time.January, 2, 0, 0, 0, 0, loc)},
+		{s: "2006-01-02 15:04:05", want: time.Date(2006, time.January, 2, 15, 4, 5, 0, loc)},
+		{s: "2006-01-02 15:04:05 +0000", want: time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)},
+		{s: "2006-01-02T15:04:05Z", want: time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)},
+		{s: "@1136214245", want: time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)},
+		{s: "", wantErr: true},
+		{s: "ago", wantErr: true},
+		{s: "2.fortnights.weeks", wantErr: true},
+		{s: "2.lightyears.ago", wantErr: true},
+		{s: "soon", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseExpiryDate(test.s, now)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("parseExpiryDate(%q, now): %v", test.s, err)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("parseExpiryDate(%q, now) = %v, <nil>; want error", test.s, got)
+			continue
+		}
+		if !got.Equal(test.want) || got.IsZero() != test.want.IsZero() {
+			t.Errorf("parseExpiryDate(%q, now) = %v; want %v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestConfigSubsections(t *testing.T) {
+	const config = "[branch \"main\"]\n" +
+		"\tremote = origin\n" +
+		"\tmerge = refs/heads/main\n" +
+		"[Branch \"Feature/X.Y\"]\n" +
+		"\tremote = origin\n" +
+		"[branch]\n" +
+		"\tautoSetupMerge = always\n" +
+		"[remote \"origin\"]\n" +
+		"\turl = https://example.com/foo.git\n" +
+		"[core]\n" +
+		"\tbare = false\n"
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.top.Apply(filesystem.Write(".gitconfig", config)); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := env.g.ReadConfigScope(ctx, GlobalConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.Sections(), []string{"branch", "remote", "core"}; !cmp.Equal(want, got) {
+		t.Errorf("cfg.Sections() = %q; want %q", got, want)
+	}
+	if got, want := cfg.Subsections("BRANCH"), []string{"main", "Feature/X.Y"}; !cmp.Equal(want, got) {
+		t.Errorf("cfg.Subsections(\"BRANCH\") = %q; want %q", got, want)
+	}
+	if got := cfg.Subsections("core"); len(got) != 0 {
+		t.Errorf("cfg.Subsections(\"core\") = %q; want []", got)
+	}
+	if got, want := cfg.Value("branch.Feature/X.Y.REMOTE"), "origin"; got != want {
+		t.Errorf("cfg.Value(\"branch.Feature/X.Y.REMOTE\") = %q; want %q", got, want)
+	}
+	if got := cfg.Value("branch.feature/x.y.remote"); got != "" {
+		t.Errorf("cfg.Value(\"branch.feature/x.y.remote\") = %q; want \"\"", got)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ConflictError is returned by operations that stopped because of merge
+// conflicts. The index and working copy are left with the conflicted
+// files for the caller to resolve.
+type ConflictError struct {
+	// Commit is the commit that was being applied when the conflict
+	// occurred. It is zero if the operation does not apply commits,
+	// like applying a stash entry.
+	Commit Hash
+	// Paths is the list of files with unresolved conflicts.
+	Paths []TopPath
+
+	msg   string
+	cause error
+}
+
+// Error returns the command's error message.
+func (e *ConflictError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the error from running the Git subprocess.
+func (e *ConflictError) Unwrap() error {
+	return e.cause
+}
+
+// conflictError converts an error from a command that may have left
+// merge conflicts into a *ConflictError. If there are no unmerged files
+// in the working copy, runError is returned unchanged.
+func (g *Git) conflictError(ctx context.Context, commit Hash, runError error) error {
+	entries, err := g.Status(ctx, StatusOptions{})
+	if err != nil {
+		return runError
+	}
+	var paths []TopPath
+	for _, ent := range entries {
+		if ent.Code.IsUnmerged() {
+			paths = append(paths, ent.Name)
+		}
+	}
+	if len(paths) == 0 {
+		return runError
+	}
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		names[i] = p.String()
+	}
+	return &ConflictError{
+		Commit: commit,
+		Paths:  paths,
+		msg:    fmt.Sprintf("%v\nconflicts in: %s", runError, strings.Join(names, ", ")),
+		cause:  runError,
+	}
+}
+
+// runSequencer runs a command that applies commits and may stop on a
+// conflict, like rebase or cherry-pick. stoppedRef is the pseudo-ref Git
+// writes to name the commit being applied when the command stops.
+func (g *Git) runSequencer(ctx context.Context, errPrefix string, args []string, env []string, stoppedRef string) error {
+	// Accept the default commit messages instead of opening an editor.
+	env = append(env, "GIT_EDITOR=:")
+	output := new(bytes.Buffer)
+	w := &limitWriter{w: output, n: errorOutputLimit}
+	err := g.runner.RunGit(ctx, &Invocation{
+		Args:   args,
+		Dir:    g.dir,
+		Env:    env,
+		Stdout: w,
+		Stderr: w,
+	})
+	if err == nil {
+		return nil
+	}
+	err = commandError(errPrefix, err, output.Bytes())
+	var stopped Hash
+	if rev, revErr := g.ParseRev(ctx, stoppedRef); revErr == nil {
+		stopped = rev.Commit
+	}
+	return g.conflictError(ctx, stopped, err)
+}
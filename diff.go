@@ -0,0 +1,671 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gg-scm.io/pkg/git/object"
+)
+
+// DiffOptions specifies the command-line arguments for `git diff`.
+type DiffOptions struct {
+	// Commit1 specifies the earlier commit to compare with. If empty,
+	// then Diff compares against the index.
+	Commit1 string
+	// Commit2 specifies the later commit to compare with. If empty, then
+	// Diff compares against the working tree. Callers must not set
+	// Commit2 if Commit1 is empty.
+	Commit2 string
+	// Pathspecs filters the output to the given pathspecs.
+	Pathspecs []Pathspec
+	// DisableRenames will force Git to disable rename/copy detection.
+	DisableRenames bool
+}
+
+// Diff compares two commits, a commit and the working copy, or the index
+// and the working copy using `git diff` and returns the parsed patch.
+// Paths in the patch are always relative to the top of the working copy.
+func (g *Git) Diff(ctx context.Context, opts DiffOptions) ([]*FileDiff, error) {
+	const errPrefix = "git diff"
+	if opts.Commit1 != "" {
+		if err := validateRev(opts.Commit1); err != nil {
+			return nil, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	if opts.Commit2 != "" {
+		if opts.Commit1 == "" {
+			return nil, fmt.Errorf("%s: Commit2 set without Commit1 being set", errPrefix)
+		}
+		if err := validateRev(opts.Commit2); err != nil {
+			return nil, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	args := []string{
+		"diff",
+		"--no-color",
+		"--no-ext-diff",
+		"--no-textconv",
+		"--full-index",
+		"--src-prefix=a/",
+		"--dst-prefix=b/",
+	}
+	if version, err := g.getVersion(ctx); err == nil && versionAtLeast(version, 2, 28) {
+		// Override the diff.relative setting added in Git 2.28.
+		args = append(args, "--no-relative")
+	}
+	if opts.DisableRenames {
+		args = append(args, "--no-renames")
+	} else {
+		args = append(args, "--find-renames")
+	}
+	if opts.Commit1 != "" {
+		args = append(args, opts.Commit1)
+	}
+	if opts.Commit2 != "" {
+		args = append(args, opts.Commit2)
+	}
+	args = append(args, "--")
+	for _, p := range opts.Pathspecs {
+		args = append(args, string(p))
+	}
+
+	stderr := new(bytes.Buffer)
+	pipe, err := StartPipe(ctx, g.runner, &Invocation{
+		Args:   args,
+		Dir:    g.dir,
+		Stderr: &limitWriter{w: stderr, n: errorOutputLimit},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	files, parseErr := ParseDiff(pipe)
+	if err := pipe.Close(); err != nil {
+		return nil, commandError(errPrefix, err, stderr.Bytes())
+	}
+	if parseErr != nil {
+		return files, fmt.Errorf("%s: %w", errPrefix, parseErr)
+	}
+	return files, nil
+}
+
+// A FileDiff is the set of changes to a single file in a patch.
+type FileDiff struct {
+	// Code is the kind of change made to the file.
+	Code DiffStatusCode
+	// OldName is the path of the file before the change.
+	// It is empty if the file was added.
+	OldName TopPath
+	// NewName is the path of the file after the change.
+	// It is empty if the file was deleted.
+	NewName TopPath
+
+	// OldMode and NewMode are the file modes before and after the change.
+	// They are zero if the patch does not include them.
+	OldMode object.Mode
+	NewMode object.Mode
+
+	// OldHash and NewHash are the blob object IDs of the file before and
+	// after the change. They are zero if the patch does not include them or
+	// if the patch uses abbreviated object IDs.
+	OldHash Hash
+	NewHash Hash
+
+	// Similarity is the similarity index percentage for renames and copies.
+	Similarity int
+
+	// Binary is true if the file's content is binary. Binary files do not
+	// have hunks.
+	Binary bool
+
+	// Hunks is the list of changed regions in the file.
+	Hunks []*DiffHunk
+}
+
+// A DiffHunk is a contiguous region of changes in a file.
+type DiffHunk struct {
+	// OldStart and OldLines are the 1-based line number and the number of
+	// lines of the region in the original file.
+	OldStart int
+	OldLines int
+	// NewStart and NewLines are the 1-based line number and the number of
+	// lines of the region in the new file.
+	NewStart int
+	NewLines int
+	// Section is the text after the hunk range, usually the line of the
+	// enclosing function.
+	Section string
+	// Lines is the content of the hunk.
+	Lines []DiffLine
+}
+
+// A DiffLine is a single line in a hunk.
+type DiffLine struct {
+	Op DiffLineOp
+	// Text is the content of the line, not including the operation
+	// character or the trailing newline.
+	Text string
+	// NoNewline is true if the line is the last line in the file and it
+	// does not end with a newline.
+	NoNewline bool
+}
+
+// DiffLineOp is the operation character at the start of a line in a hunk.
+type DiffLineOp byte
+
+// Diff line operations.
+const (
+	DiffContext DiffLineOp = ' '
+	DiffAdded   DiffLineOp = '+'
+	DiffRemoved DiffLineOp = '-'
+)
+
+// String returns the operation character as a string.
+func (op DiffLineOp) String() string {
+	return string(op)
+}
+
+// ParseDiff parses a patch in unified diff format, as produced by
+// `git diff` or `git format-patch`. Paths have their first component
+// removed (like `patch -p1`). Any text before the first file header, such as
+// an email message, is ignored.
+func ParseDiff(r io.Reader) ([]*FileDiff, error) {
+	p := &diffParser{r: bufio.NewReader(r)}
+	if err := p.parse(); err != nil {
+		return p.files, fmt.Errorf("parse diff: %w", err)
+	}
+	return p.files, nil
+}
+
+type diffParser struct {
+	r      *bufio.Reader
+	lineno int
+	// peeked is a line that was read but not consumed.
+	peeked    string
+	hasPeeked bool
+	files     []*FileDiff
+}
+
+func (p *diffParser) readLine() (string, error) {
+	if p.hasPeeked {
+		p.hasPeeked = false
+		return p.peeked, nil
+	}
+	line, err := p.r.ReadString('\n')
+	if err != nil {
+		if !errors.Is(err, io.EOF) || line == "" {
+			return "", err
+		}
+	}
+	p.lineno++
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+func (p *diffParser) unreadLine(line string) {
+	p.peeked = line
+	p.hasPeeked = true
+}
+
+func (p *diffParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.lineno, fmt.Sprintf(format, args...))
+}
+
+func (p *diffParser) parse() error {
+	for {
+		line, err := p.readLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			f := new(FileDiff)
+			p.files = append(p.files, f)
+			if err := p.parseGitHeader(f, line); err != nil {
+				return err
+			}
+			if err := p.parseBody(f); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "--- "):
+			next, err := p.readLine()
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			if err != nil || !strings.HasPrefix(next, "+++ ") {
+				// Not a file header: probably a signature separator in an email.
+				if err == nil {
+					p.unreadLine(next)
+				}
+				continue
+			}
+			f := new(FileDiff)
+			p.files = append(p.files, f)
+			if err := p.parseFileNames(f, line, next); err != nil {
+				return err
+			}
+			if err := p.parseBody(f); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// parseGitHeader parses the "diff --git" line and the extended header lines
+// that follow it.
+//
+// See https://git-scm.com/docs/git-diff#_generating_patch_text_with_p
+func (p *diffParser) parseGitHeader(f *FileDiff, first string) error {
+	oldName, newName, err := splitGitDiffNames(first[len("diff --git "):])
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	f.OldName = oldName
+	f.NewName = newName
+	f.Code = DiffStatusModified
+	for {
+		line, err := p.readLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "old mode "):
+			f.OldMode, err = parseDiffMode(line[len("old mode "):])
+		case strings.HasPrefix(line, "new mode "):
+			f.NewMode, err = parseDiffMode(line[len("new mode "):])
+			if err == nil && f.OldMode&^0o777 != f.NewMode&^0o777 {
+				f.Code = DiffStatusChangedMode
+			}
+		case strings.HasPrefix(line, "deleted file mode "):
+			f.Code = DiffStatusDeleted
+			f.NewName = ""
+			f.OldMode, err = parseDiffMode(line[len("deleted file mode "):])
+		case strings.HasPrefix(line, "new file mode "):
+			f.Code = DiffStatusAdded
+			f.OldName = ""
+			f.NewMode, err = parseDiffMode(line[len("new file mode "):])
+		case strings.HasPrefix(line, "similarity index "):
+			f.Similarity, err = parseDiffPercent(line[len("similarity index "):])
+		case strings.HasPrefix(line, "dissimilarity index "):
+			// Only used for broken pairs. The file is otherwise a modification.
+			_, err = parseDiffPercent(line[len("dissimilarity index "):])
+		case strings.HasPrefix(line, "rename from "):
+			f.Code = DiffStatusRenamed
+			f.OldName, err = parseDiffPath(line[len("rename from "):], false)
+		case strings.HasPrefix(line, "rename to "):
+			f.Code = DiffStatusRenamed
+			f.NewName, err = parseDiffPath(line[len("rename to "):], false)
+		case strings.HasPrefix(line, "copy from "):
+			f.Code = DiffStatusCopied
+			f.OldName, err = parseDiffPath(line[len("copy from "):], false)
+		case strings.HasPrefix(line, "copy to "):
+			f.Code = DiffStatusCopied
+			f.NewName, err = parseDiffPath(line[len("copy to "):], false)
+		case strings.HasPrefix(line, "index "):
+			err = parseDiffIndexLine(f, line[len("index "):])
+		default:
+			p.unreadLine(line)
+			return nil
+		}
+		if err != nil {
+			return p.errorf("%v", err)
+		}
+	}
+}
+
+// parseBody parses the file names and hunks of a file diff.
+func (p *diffParser) parseBody(f *FileDiff) error {
+	for {
+		line, err := p.readLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			next, err := p.readLine()
+			if err != nil || !strings.HasPrefix(next, "+++ ") {
+				return p.errorf("expected \"+++\" line after \"---\" line")
+			}
+			if err := p.parseFileNames(f, line, next); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "@@ "):
+			h, err := parseHunkHeader(line)
+			if err != nil {
+				return p.errorf("%v", err)
+			}
+			if err := p.parseHunkLines(h); err != nil {
+				return err
+			}
+			f.Hunks = append(f.Hunks, h)
+		case strings.HasPrefix(line, "Binary files ") && strings.HasSuffix(line, " differ"):
+			f.Binary = true
+		case line == "GIT binary patch":
+			f.Binary = true
+			if err := p.skipBinaryPatch(); err != nil {
+				return err
+			}
+		default:
+			p.unreadLine(line)
+			return nil
+		}
+	}
+}
+
+// parseFileNames parses the "---" and "+++" lines.
+func (p *diffParser) parseFileNames(f *FileDiff, oldLine, newLine string) error {
+	oldName, err := parseDiffPath(oldLine[len("--- "):], true)
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	newName, err := parseDiffPath(newLine[len("+++ "):], true)
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	f.OldName = oldName
+	f.NewName = newName
+	if f.Code == 0 {
+		switch {
+		case oldName == "":
+			f.Code = DiffStatusAdded
+		case newName == "":
+			f.Code = DiffStatusDeleted
+		default:
+			f.Code = DiffStatusModified
+		}
+	}
+	return nil
+}
+
+// parseHunkLines reads the lines of a hunk, stopping once the line counts in
+// the hunk header are satisfied.
+func (p *diffParser) parseHunkLines(h *DiffHunk) error {
+	oldRemaining, newRemaining := h.OldLines, h.NewLines
+	for oldRemaining > 0 || newRemaining > 0 {
+		line, err := p.readLine()
+		if errors.Is(err, io.EOF) {
+			return p.errorf("unexpected EOF in hunk")
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			// Some tools strip trailing whitespace from context lines.
+			line = " "
+		}
+		switch op := DiffLineOp(line[0]); op {
+		case DiffContext:
+			oldRemaining--
+			newRemaining--
+			h.Lines = append(h.Lines, DiffLine{Op: op, Text: line[1:]})
+		case DiffRemoved:
+			oldRemaining--
+			h.Lines = append(h.Lines, DiffLine{Op: op, Text: line[1:]})
+		case DiffAdded:
+			newRemaining--
+			h.Lines = append(h.Lines, DiffLine{Op: op, Text: line[1:]})
+		case '\\':
+			if len(h.Lines) > 0 {
+				h.Lines[len(h.Lines)-1].NoNewline = true
+			}
+		default:
+			return p.errorf("invalid hunk line %q", line)
+		}
+		if oldRemaining < 0 || newRemaining < 0 {
+			return p.errorf("hunk has more lines than header specifies")
+		}
+	}
+	// The "\ No newline at end of file" marker follows the final line.
+	line, err := p.readLine()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(line, `\`) {
+		if len(h.Lines) > 0 {
+			h.Lines[len(h.Lines)-1].NoNewline = true
+		}
+	} else {
+		p.unreadLine(line)
+	}
+	return nil
+}
+
+// skipBinaryPatch consumes the data of a "GIT binary patch", which consists of
+// two base85-encoded blocks each terminated by a blank line.
+func (p *diffParser) skipBinaryPatch() error {
+	for blocks := 0; blocks < 2; {
+		line, err := p.readLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "diff --git ") {
+			p.unreadLine(line)
+			return nil
+		}
+		if line == "" {
+			blocks++
+		}
+	}
+	return nil
+}
+
+// parseHunkHeader parses a line of the form "@@ -1,2 +3,4 @@ section".
+func parseHunkHeader(line string) (*DiffHunk, error) {
+	rest := strings.TrimPrefix(line, "@@ ")
+	end := strings.Index(rest, " @@")
+	if end == -1 {
+		return nil, fmt.Errorf("invalid hunk header %q", line)
+	}
+	ranges := strings.Fields(rest[:end])
+	if len(ranges) != 2 || !strings.HasPrefix(ranges[0], "-") || !strings.HasPrefix(ranges[1], "+") {
+		return nil, fmt.Errorf("invalid hunk header %q", line)
+	}
+	h := new(DiffHunk)
+	var err error
+	h.OldStart, h.OldLines, err = parseHunkRange(ranges[0][1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid hunk header %q: %v", line, err)
+	}
+	h.NewStart, h.NewLines, err = parseHunkRange(ranges[1][1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid hunk header %q: %v", line, err)
+	}
+	h.Section = strings.TrimPrefix(rest[end+len(" @@"):], " ")
+	return h, nil
+}
+
+// parseHunkRange parses "start,count" or "start". The count defaults to 1.
+func parseHunkRange(s string) (start, count int, err error) {
+	count = 1
+	if i := strings.IndexByte(s, ','); i != -1 {
+		count, err = strconv.Atoi(s[i+1:])
+		if err != nil {
+			return 0, 0, err
+		}
+		s = s[:i]
+	}
+	start, err = strconv.Atoi(s)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start < 0 || count < 0 {
+		return 0, 0, errors.New("negative range")
+	}
+	return start, count, nil
+}
+
+// parseDiffIndexLine parses the part of an "index" line after "index ", like
+// "abc123..def456 100644".
+func parseDiffIndexLine(f *FileDiff, s string) error {
+	hashes := s
+	if i := strings.IndexByte(s, ' '); i != -1 {
+		hashes = s[:i]
+		mode, err := parseDiffMode(s[i+1:])
+		if err != nil {
+			return err
+		}
+		f.OldMode = mode
+		f.NewMode = mode
+	}
+	i := strings.Index(hashes, "..")
+	if i == -1 {
+		return fmt.Errorf("invalid index line %q", s)
+	}
+	// Abbreviated object IDs can't be represented as a Hash, so ignore them.
+	if h, err := ParseHash(hashes[:i]); err == nil {
+		f.OldHash = h
+	}
+	if h, err := ParseHash(hashes[i+2:]); err == nil {
+		f.NewHash = h
+	}
+	return nil
+}
+
+func parseDiffMode(s string) (object.Mode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("mode: %v", err)
+	}
+	return object.Mode(mode), nil
+}
+
+func parseDiffPercent(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil || n < 0 || n > 100 {
+		return 0, fmt.Errorf("invalid percentage %q", s)
+	}
+	return n, nil
+}
+
+// parseDiffPath parses a possibly-quoted path from a diff header line.
+// If stripPrefix is true, the first path component is removed and /dev/null
+// is returned as an empty path.
+func parseDiffPath(s string, stripPrefix bool) (TopPath, error) {
+	if strings.HasPrefix(s, `"`) {
+		end := closingQuote(s)
+		if end == -1 {
+			return "", fmt.Errorf("unterminated quoted path %s", s)
+		}
+		var err error
+		s, err = unquoteCString(s[:end+1])
+		if err != nil {
+			return "", err
+		}
+	} else if i := strings.IndexByte(s, '\t'); i != -1 {
+		// Non-Git diffs can include a timestamp after the name.
+		s = s[:i]
+	}
+	if !stripPrefix {
+		return TopPath(s), nil
+	}
+	if s == "/dev/null" {
+		return "", nil
+	}
+	if i := strings.IndexByte(s, '/'); i != -1 {
+		s = s[i+1:]
+	}
+	return TopPath(s), nil
+}
+
+// splitGitDiffNames splits the arguments of a "diff --git" line into the old
+// and new paths, with their prefixes removed. The names are ambiguous if they
+// contain spaces and differ, but in that case Git also emits "rename" or
+// "---"/"+++" lines that take precedence.
+func splitGitDiffNames(s string) (oldName, newName TopPath, err error) {
+	if strings.HasPrefix(s, `"`) {
+		end := closingQuote(s)
+		if end == -1 || end+1 >= len(s) || s[end+1] != ' ' {
+			return "", "", fmt.Errorf("invalid diff header %q", s)
+		}
+		oldName, err = parseDiffPath(s[:end+1], true)
+		if err != nil {
+			return "", "", err
+		}
+		newName, err = parseDiffPath(s[end+2:], true)
+		return oldName, newName, err
+	}
+	if strings.HasSuffix(s, `"`) {
+		i := strings.LastIndex(s, ` "`)
+		if i == -1 {
+			return "", "", fmt.Errorf("invalid diff header %q", s)
+		}
+		oldName, err = parseDiffPath(s[:i], true)
+		if err != nil {
+			return "", "", err
+		}
+		newName, err = parseDiffPath(s[i+1:], true)
+		return oldName, newName, err
+	}
+	// Unquoted: assume both names are the same length, which is true for
+	// everything but renames and copies.
+	if len(s)%2 == 1 {
+		mid := len(s) / 2
+		if s[mid] == ' ' {
+			oldName, _ = parseDiffPath(s[:mid], true)
+			newName, _ = parseDiffPath(s[mid+1:], true)
+			if oldName == newName {
+				return oldName, newName, nil
+			}
+		}
+	}
+	i := strings.Index(s, " b/")
+	if i == -1 {
+		i = strings.IndexByte(s, ' ')
+	}
+	if i == -1 {
+		return "", "", fmt.Errorf("invalid diff header %q", s)
+	}
+	oldName, _ = parseDiffPath(s[:i], true)
+	newName, _ = parseDiffPath(s[i+1:], true)
+	return oldName, newName, nil
+}
+
+// closingQuote returns the index of the double quote that ends the C-style
+// quoted string at the beginning of s or -1 if not found.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,297 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"gg-scm.io/pkg/git/object"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want []*FileDiff
+	}{
+		{
+			name: "Empty",
+			diff: "",
+			want: nil,
+		},
+		{
+			name: "Modified",
+			diff: "diff --git a/foo.txt b/foo.txt\n" +
+				"index 8ab686eafeb1f44702738c8b0f24f2567c36da6d..3b18e512dba79e4c8300dd08aeb37f8e728b8dad 100644\n" +
+				"--- a/foo.txt\n" +
+				"+++ b/foo.txt\n" +
+				"@@ -1,3 +1,3 @@ func main() {\n" +
+				" a\n" +
+				"-b\n" +
+				"+c\n" +
+				" d\n",
+			want: []*FileDiff{{
+				Code:    DiffStatusModified,
+				OldName: "foo.txt",
+				NewName: "foo.txt",
+				OldMode: object.ModePlain,
+				NewMode: object.ModePlain,
+				OldHash: hashLiteral("8ab686eafeb1f44702738c8b0f24f2567c36da6d"),
+				NewHash: hashLiteral("3b18e512dba79e4c8300dd08aeb37f8e728b8dad"),
+				Hunks: []*DiffHunk{{
+					OldStart: 1,
+					OldLines: 3,
+					NewStart: 1,
+					NewLines: 3,
+					Section:  "func main() {",
+					Lines: []DiffLine{
+						{Op: DiffContext, Text: "a"},
+						{Op: DiffRemoved, Text: "b"},
+						{Op: DiffAdded, Text: "c"},
+						{Op: DiffContext, Text: "d"},
+					},
+				}},
+			}},
+		},
+		{
+			name: "AddedNoNewline",
+			diff: "diff --git a/new.txt b/new.txt\n" +
+				"new file mode 100755\n" +
+				"index 0000000..e69de29\n" +
+				"--- /dev/null\n" +
+				"+++ b/new.txt\n" +
+				"@@ -0,0 +1 @@\n" +
+				"+hello\n" +
+				"\\ No newline at end of file\n",
+			want: []*FileDiff{{
+				Code:    DiffStatusAdded,
+				NewName: "new.txt",
+				NewMode: object.ModeExecutable,
+				Hunks: []*DiffHunk{{
+					OldStart: 0,
+					OldLines: 0,
+					NewStart: 1,
+					NewLines: 1,
+					Lines: []DiffLine{
+						{Op: DiffAdded, Text: "hello", NoNewline: true},
+					},
+				}},
+			}},
+		},
+		{
+			name: "RenameAndDelete",
+			diff: "diff --git a/old name.txt b/new name.txt\n" +
+				"similarity index 90%\n" +
+				"rename from old name.txt\n" +
+				"rename to new name.txt\n" +
+				"diff --git a/gone.txt b/gone.txt\n" +
+				"deleted file mode 100644\n" +
+				"Binary files a/gone.txt and /dev/null differ\n",
+			want: []*FileDiff{
+				{
+					Code:       DiffStatusRenamed,
+					OldName:    "old name.txt",
+					NewName:    "new name.txt",
+					Similarity: 90,
+				},
+				{
+					Code:    DiffStatusDeleted,
+					OldName: "gone.txt",
+					OldMode: object.ModePlain,
+					Binary:  true,
+				},
+			},
+		},
+		{
+			name: "QuotedPath",
+			diff: "diff --git \"a/tab\\there.txt\" \"b/tab\\there.txt\"\n" +
+				"old mode 100644\n" +
+				"new mode 100755\n",
+			want: []*FileDiff{{
+				Code:    DiffStatusModified,
+				OldName: "tab\there.txt",
+				NewName: "tab\there.txt",
+				OldMode: object.ModePlain,
+				NewMode: object.ModeExecutable,
+			}},
+		},
+		{
+			name: "Email",
+			diff: "From 1234 Mon Sep 17 00:00:00 2001\n" +
+				"Subject: [PATCH] Fix it\n" +
+				"\n" +
+				"---\n" +
+				" foo.txt | 2 +-\n" +
+				"\n" +
+				"--- a/foo.txt\t2021-01-01 00:00:00\n" +
+				"+++ b/foo.txt\t2021-01-02 00:00:00\n" +
+				"@@ -1 +1 @@\n" +
+				"-b\n" +
+				"+c\n" +
+				"-- \n" +
+				"2.30.0\n",
+			want: []*FileDiff{{
+				Code:    DiffStatusModified,
+				OldName: "foo.txt",
+				NewName: "foo.txt",
+				Hunks: []*DiffHunk{{
+					OldStart: 1,
+					OldLines: 1,
+					NewStart: 1,
+					NewLines: 1,
+					Lines: []DiffLine{
+						{Op: DiffRemoved, Text: "b"},
+						{Op: DiffAdded, Text: "c"},
+					},
+				}},
+			}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseDiff(strings.NewReader(test.diff))
+			if err != nil {
+				t.Fatal("ParseDiff:", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("ParseDiff(...) (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	const renameContent = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	err = env.root.Apply(
+		filesystem.Write("foo.txt", "a\nb\nc\n"),
+		filesystem.Write("old.txt", renameContent),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt", "old.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "a\nB\nc\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "mv", "old.txt", "new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CommitAll(ctx, "second", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := env.g.Diff(ctx, DiffOptions{Commit1: "HEAD~", Commit2: "HEAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Diff returned %d files; want 2", len(got))
+	}
+	foo := got[0]
+	if foo.Code != DiffStatusModified || foo.OldName != "foo.txt" || foo.NewName != "foo.txt" {
+		t.Errorf("got[0] = %v %q -> %q; want M foo.txt -> foo.txt", foo.Code, foo.OldName, foo.NewName)
+	}
+	if foo.OldHash == (Hash{}) || foo.NewHash == (Hash{}) {
+		t.Errorf("got[0] hashes = %v..%v; want non-zero", foo.OldHash, foo.NewHash)
+	}
+	wantHunks := []*DiffHunk{{
+		OldStart: 1,
+		OldLines: 3,
+		NewStart: 1,
+		NewLines: 3,
+		Lines: []DiffLine{
+			{Op: DiffContext, Text: "a"},
+			{Op: DiffRemoved, Text: "b"},
+			{Op: DiffAdded, Text: "B"},
+			{Op: DiffContext, Text: "c"},
+		},
+	}}
+	if diff := cmp.Diff(wantHunks, foo.Hunks); diff != "" {
+		t.Errorf("foo.txt hunks (-want +got):\n%s", diff)
+	}
+	renamed := got[1]
+	if renamed.Code != DiffStatusRenamed || renamed.OldName != "old.txt" || renamed.NewName != "new.txt" || renamed.Similarity != 100 {
+		t.Errorf("got[1] = %v %q -> %q (%d%%); want R old.txt -> new.txt (100%%)", renamed.Code, renamed.OldName, renamed.NewName, renamed.Similarity)
+	}
+
+	got, err = env.g.Diff(ctx, DiffOptions{Commit1: "HEAD~", Commit2: "HEAD", DisableRenames: true, Pathspecs: []Pathspec{"old.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Code != DiffStatusDeleted || got[0].OldName != "old.txt" {
+		t.Errorf("Diff(DisableRenames, old.txt) = %+v; want single deletion of old.txt", got)
+	}
+
+	// Configuration that changes the patch format should be ignored.
+	err = env.root.Apply(
+		filesystem.Write(".gitattributes", "*.txt diff=upper\n"),
+		filesystem.Write("dir/untracked.txt", dummyContent),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "config", "diff.upper.textconv", "tr a-z A-Z"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "config", "diff.relative", "true"); err != nil {
+		t.Fatal(err)
+	}
+	got, err = env.g.WithDir("dir").Diff(ctx, DiffOptions{Commit1: "HEAD~", Commit2: "HEAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Diff from subdirectory returned %d files; want 2", len(got))
+	}
+	if got[0].NewName != "foo.txt" {
+		t.Errorf("Diff from subdirectory got[0].NewName = %q; want \"foo.txt\"", got[0].NewName)
+	}
+	if diff := cmp.Diff(wantHunks, got[0].Hunks); diff != "" {
+		t.Errorf("foo.txt hunks with textconv (-want +got):\n%s", diff)
+	}
+}
+
+func hashLiteral(s string) Hash {
+	h, err := ParseHash(s)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
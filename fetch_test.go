@@ -0,0 +1,227 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"context"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseFetchPorcelain(t *testing.T) {
+	const (
+		hash1 = "0123456789abcdef0123456789abcdef01234567"
+		hash2 = "89abcdef0123456789abcdef0123456789abcdef"
+		zero  = "0000000000000000000000000000000000000000"
+	)
+	tests := []struct {
+		name    string
+		out     string
+		want    []*RefUpdate
+		wantErr bool
+	}{
+		{name: "Empty", out: ""},
+		{
+			name: "Mixed",
+			out: "* " + zero + " " + hash1 + " refs/remotes/origin/new\n" +
+				"  " + hash1 + " " + hash2 + " refs/remotes/origin/main\n" +
+				"+ " + hash2 + " " + hash1 + " refs/remotes/origin/forced\n" +
+				"- " + hash1 + " " + zero + " refs/remotes/origin/gone\n" +
+				"= " + hash1 + " " + hash1 + " refs/tags/v1\n",
+			want: []*RefUpdate{
+				{Ref: "refs/remotes/origin/new", NewHash: hashLiteral(hash1), Status: RefNew},
+				{Ref: "refs/remotes/origin/main", OldHash: hashLiteral(hash1), NewHash: hashLiteral(hash2), Status: RefFastForward},
+				{Ref: "refs/remotes/origin/forced", OldHash: hashLiteral(hash2), NewHash: hashLiteral(hash1), Status: RefForcedUpdate},
+				{Ref: "refs/remotes/origin/gone", OldHash: hashLiteral(hash1), Status: RefDeleted},
+				{Ref: "refs/tags/v1", OldHash: hashLiteral(hash1), NewHash: hashLiteral(hash1), Status: RefUpToDate},
+			},
+		},
+		{
+			name:    "MissingNewline",
+			out:     "* " + zero + " " + hash1 + " refs/remotes/origin/new",
+			wantErr: true,
+		},
+		{
+			name:    "BadFlag",
+			out:     "? " + zero + " " + hash1 + " refs/remotes/origin/new\n",
+			wantErr: true,
+		},
+		{
+			name:    "BadHash",
+			out:     "* xyzzy " + hash1 + " refs/remotes/origin/new\n",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseFetchPorcelain(test.out)
+			if err != nil {
+				if !test.wantErr {
+					t.Fatal(err)
+				}
+				return
+			}
+			if test.wantErr {
+				t.Fatal("parseFetchPorcelain did not return an error")
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("parseFetchPorcelain(...) (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	// Create repository A with a commit and clone it to B.
+	if err := env.g.Init(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	gitA := env.g.WithDir("a")
+	if err := env.root.Apply(filesystem.Write("a/foo.txt", dummyContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitA.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitA.Commit(ctx, "First commit", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	rev1, err := gitA.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Clone(ctx, URLFromPath("a"), CloneOptions{Dir: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	gitB := env.g.WithDir("b")
+
+	// Add a commit, a branch, and a tag to A.
+	if err := env.root.Apply(filesystem.Write("a/foo.txt", "Goodbye, World!\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitA.CommitAll(ctx, "Second commit", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	rev2, err := gitA.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gitA.Run(ctx, "branch", "feature", rev1.Commit.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitA.Run(ctx, "tag", "v1", rev2.Commit.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := gitB.Fetch(ctx, "origin", FetchOptions{Tags: FetchAllTags})
+	if err != nil {
+		t.Fatal("Fetch:", err)
+	}
+	want := []*RefUpdate{
+		{
+			Ref:     "refs/remotes/origin/feature",
+			NewHash: rev1.Commit,
+			Status:  RefNew,
+		},
+		{
+			Ref:     "refs/remotes/origin/" + Ref(rev2.Ref.Branch()),
+			OldHash: rev1.Commit,
+			NewHash: rev2.Commit,
+			Status:  RefFastForward,
+		},
+		{
+			Ref:     "refs/tags/v1",
+			NewHash: rev2.Commit,
+			Status:  RefNew,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("first Fetch (-want +got):\n%s", diff)
+	}
+
+	// Delete the feature branch and fetch again with pruning.
+	if err := gitA.Run(ctx, "branch", "-D", "feature"); err != nil {
+		t.Fatal(err)
+	}
+	got, err = gitB.Fetch(ctx, "origin", FetchOptions{Prune: true})
+	if err != nil {
+		t.Fatal("Fetch:", err)
+	}
+	want = []*RefUpdate{
+		{
+			Ref:     "refs/remotes/origin/feature",
+			OldHash: rev1.Commit,
+			Status:  RefDeleted,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("pruning Fetch (-want +got):\n%s", diff)
+	}
+
+	// Fetch into a local branch that can't be fast-forwarded alongside a new
+	// branch. The successful update should still be reported.
+	if err := gitA.Run(ctx, "branch", "feature", rev1.Commit.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitB.Run(ctx, "branch", "stale", rev2.Commit.String()); err != nil {
+		t.Fatal(err)
+	}
+	// Use a path instead of the remote name so that Git doesn't also update
+	// the remote-tracking branches.
+	got, err = gitB.Fetch(ctx, "../a", FetchOptions{
+		Refspecs: []FetchRefspec{
+			"refs/heads/feature:refs/heads/stale",
+			FetchRefspec(rev2.Ref.String() + ":refs/heads/copy"),
+		},
+		Tags: FetchNoTags,
+	})
+	if err == nil {
+		t.Error("Fetch with non-fast-forward update did not return an error")
+	}
+	// Newer versions of Git also report the rejected ref.
+	var accepted []*RefUpdate
+	for _, u := range got {
+		if u.Status == RefRejected {
+			if u.Ref != "refs/heads/stale" {
+				t.Errorf("Fetch rejected %s; want refs/heads/stale", u.Ref)
+			}
+			continue
+		}
+		accepted = append(accepted, u)
+	}
+	want = []*RefUpdate{
+		{
+			Ref:     "refs/heads/copy",
+			NewHash: rev2.Commit,
+			Status:  RefNew,
+		},
+	}
+	if diff := cmp.Diff(want, accepted); diff != "" {
+		t.Errorf("Fetch with non-fast-forward update (-want +got):\n%s", diff)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -126,6 +127,30 @@ func (g *Git) getVersion(ctx context.Context) (string, error) {
 	return v, nil
 }
 
+// versionAtLeast reports whether the output of `git --version` is for a
+// version of Git at or above major.minor. It returns false if the version
+// cannot be parsed.
+func versionAtLeast(version string, major, minor int) bool {
+	const prefix = "git version "
+	if !strings.HasPrefix(version, prefix) {
+		return false
+	}
+	version = strings.TrimSpace(version[len(prefix):])
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	gotMajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	gotMinor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	return gotMajor > major || (gotMajor == major && gotMinor >= minor)
+}
+
 // Exe returns the absolute path to the Git executable.
 // This method will panic if g's Runner is not of type *Local.
 //
@@ -302,7 +327,9 @@ func startPipeFallback(ctx context.Context, s Runner, invoke *Invocation) (io.Re
 	invoke2.Stdout = pw
 	e := make(chan error, 1)
 	go func() {
-		e <- s.RunGit(ctx, invoke2)
+		err := s.RunGit(ctx, invoke2)
+		pw.CloseWithError(err)
+		e <- err
 	}()
 	return localPipe{pr, func() error { return <-e }}, nil
 }
@@ -16,6 +16,8 @@ package git
 
 import (
 	"context"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -161,6 +163,51 @@ func TestOutput(t *testing.T) {
 	}
 }
 
+func TestStartPipeFallback(t *testing.T) {
+	ctx := context.Background()
+	errFake := errors.New("fake failure")
+	tests := []struct {
+		name    string
+		err     error
+		readErr error
+	}{
+		{name: "Success"},
+		{name: "Failure", err: errFake, readErr: errFake},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// runnerFunc does not implement Piper, so StartPipe must use the
+			// fallback implementation.
+			r := runnerFunc(func(ctx context.Context, invoke *Invocation) error {
+				if _, err := io.WriteString(invoke.Stdout, "Hello, World!\n"); err != nil {
+					return err
+				}
+				return test.err
+			})
+			pipe, err := StartPipe(ctx, r, &Invocation{Args: []string{"fake"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(pipe)
+			if want := "Hello, World!\n"; string(got) != want {
+				t.Errorf("read %q; want %q", got, want)
+			}
+			if err != test.readErr {
+				t.Errorf("read error = %v; want %v", err, test.readErr)
+			}
+			if err := pipe.Close(); err != test.err {
+				t.Errorf("Close() = %v; want %v", err, test.err)
+			}
+		})
+	}
+}
+
+type runnerFunc func(ctx context.Context, invoke *Invocation) error
+
+func (f runnerFunc) RunGit(ctx context.Context, invoke *Invocation) error {
+	return f(ctx, invoke)
+}
+
 func TestIndexCommand(t *testing.T) {
 	tests := []struct {
 		args []string
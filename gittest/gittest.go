@@ -0,0 +1,319 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package gittest provides a fake git.Runner for testing code that uses the
+// git package without starting Git subprocesses.
+package gittest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	slashpath "path"
+	"strings"
+	"sync"
+
+	"gg-scm.io/pkg/git"
+)
+
+// Runner is a git.Runner that replies to invocations with scripted responses
+// instead of running Git. Pass a Runner to git.Custom to use it. The zero value
+// is a Runner with no responses. A Runner is safe to use from multiple
+// goroutines.
+type Runner struct {
+	// If Strict is true, then RunGit returns an error for invocations that do
+	// not match any response. Otherwise, such invocations succeed with no output.
+	Strict bool
+
+	mu          sync.Mutex
+	handlers    []handler
+	invocations []*Invocation
+	unexpected  []*Invocation
+}
+
+// A Response is the scripted result of a Git invocation.
+type Response struct {
+	// Stdout and Stderr are written to the invocation's standard output
+	// and standard error.
+	Stdout string
+	Stderr string
+	// ExitCode is the exit code of the fake Git process. If ExitCode is not
+	// zero, then the invocation returns an *ExitError.
+	ExitCode int
+}
+
+// An Invocation is a record of a single call to RunGit or PipeGit.
+type Invocation struct {
+	Args []string
+	Dir  string
+	Env  []string
+	// Stdin is the content read from the invocation's standard input.
+	// Like a Git subprocess, the fake reads its standard input while it
+	// writes its output, so Stdin is only complete once the invocation
+	// has finished.
+	Stdin string
+}
+
+type handler struct {
+	pattern []string
+	resp    Response
+}
+
+// Handle adds a response for invocations whose arguments match pattern.
+// Each element of pattern must be equal to the argument at the same position,
+// except that "*" matches any single argument and a final "..." matches any
+// number of remaining arguments. If more than one response matches an
+// invocation, the one added first is used.
+func (r *Runner) Handle(pattern []string, resp Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = append(r.handlers, handler{
+		pattern: append([]string(nil), pattern...),
+		resp:    resp,
+	})
+}
+
+// RunGit records the invocation and writes the matching response's output.
+func (r *Runner) RunGit(ctx context.Context, invoke *git.Invocation) error {
+	resp, stdin, err := r.respond(ctx, invoke)
+	if err != nil {
+		return err
+	}
+	if invoke.Stdout != nil {
+		if _, err := io.WriteString(invoke.Stdout, resp.Stdout); err != nil {
+			return err
+		}
+	}
+	if invoke.Stderr != nil {
+		if _, err := io.WriteString(invoke.Stderr, resp.Stderr); err != nil {
+			return err
+		}
+	}
+	if err := stdin.wait(ctx); err != nil {
+		return err
+	}
+	if resp.ExitCode != 0 {
+		return &ExitError{Code: resp.ExitCode}
+	}
+	return nil
+}
+
+// respond records the invocation and finds its response. If the invocation
+// has a standard input, respond starts reading it in the background so that
+// callers can interleave writing input with reading output.
+func (r *Runner) respond(ctx context.Context, invoke *git.Invocation) (Response, *stdinReader, error) {
+	if err := ctx.Err(); err != nil {
+		return Response{}, nil, err
+	}
+	rec := &Invocation{
+		Args: append([]string(nil), invoke.Args...),
+		Dir:  invoke.Dir,
+		Env:  append([]string(nil), invoke.Env...),
+	}
+
+	r.mu.Lock()
+	r.invocations = append(r.invocations, rec)
+	resp, ok := r.match(invoke.Args)
+	if !ok {
+		r.unexpected = append(r.unexpected, rec)
+	}
+	r.mu.Unlock()
+	if !ok && r.Strict {
+		return Response{}, nil, fmt.Errorf("gittest: unexpected invocation: git %s", strings.Join(invoke.Args, " "))
+	}
+	if invoke.Stdin == nil {
+		return resp, nil, nil
+	}
+	stdin := &stdinReader{done: make(chan struct{})}
+	go func() {
+		defer close(stdin.done)
+		data, err := ioutil.ReadAll(invoke.Stdin)
+		stdin.err = err
+		r.mu.Lock()
+		rec.Stdin = string(data)
+		r.mu.Unlock()
+	}()
+	return resp, stdin, nil
+}
+
+// match returns the response of the first handler that matches args.
+// The caller must hold r.mu.
+func (r *Runner) match(args []string) (_ Response, ok bool) {
+	for _, h := range r.handlers {
+		if matchArgs(h.pattern, args) {
+			return h.resp, true
+		}
+	}
+	return Response{}, false
+}
+
+// stdinReader is a background read of an invocation's standard input.
+type stdinReader struct {
+	done chan struct{}
+	err  error
+}
+
+// wait waits for the standard input to be read until EOF. It is safe to call
+// on a nil *stdinReader.
+func (stdin *stdinReader) wait(ctx context.Context) error {
+	if stdin == nil {
+		return nil
+	}
+	select {
+	case <-stdin.done:
+		return stdin.err
+	default:
+	}
+	select {
+	case <-stdin.done:
+		return stdin.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// matchArgs reports whether args matches pattern as described in Handle.
+func matchArgs(pattern, args []string) bool {
+	for i, p := range pattern {
+		if p == "..." && i == len(pattern)-1 {
+			return true
+		}
+		if i >= len(args) || (p != "*" && p != args[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(args)
+}
+
+// Invocations returns the invocations received so far, in order.
+func (r *Runner) Invocations() []*Invocation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return copyInvocations(r.invocations)
+}
+
+// Unexpected returns the invocations received so far that did not match
+// any response, in order.
+func (r *Runner) Unexpected() []*Invocation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return copyInvocations(r.unexpected)
+}
+
+// copyInvocations returns copies of the given invocations, since their
+// Stdin fields may still be written to. The caller must hold r.mu.
+func copyInvocations(list []*Invocation) []*Invocation {
+	if len(list) == 0 {
+		return nil
+	}
+	copies := make([]*Invocation, len(list))
+	for i, rec := range list {
+		rec2 := new(Invocation)
+		*rec2 = *rec
+		copies[i] = rec2
+	}
+	return copies
+}
+
+// PipeRunner is a Runner that also implements git.Piper.
+type PipeRunner struct {
+	Runner
+}
+
+// PipeGit records the invocation and returns a pipe that reads the matching
+// response's standard output. The response's output is available before the
+// invocation's standard input has been read, so interactive commands like
+// `git cat-file --batch` can be scripted. The pipe's Close method waits for
+// the standard input to reach EOF and returns an *ExitError if the response
+// has a non-zero exit code.
+func (r *PipeRunner) PipeGit(ctx context.Context, invoke *git.Invocation) (io.ReadCloser, error) {
+	resp, stdin, err := r.respond(ctx, invoke)
+	if err != nil {
+		return nil, err
+	}
+	if invoke.Stderr != nil {
+		if _, err := io.WriteString(invoke.Stderr, resp.Stderr); err != nil {
+			return nil, err
+		}
+	}
+	return &pipe{
+		ctx:      ctx,
+		r:        strings.NewReader(resp.Stdout),
+		stdin:    stdin,
+		exitCode: resp.ExitCode,
+	}, nil
+}
+
+type pipe struct {
+	ctx      context.Context
+	r        *strings.Reader
+	stdin    *stdinReader
+	exitCode int
+}
+
+func (p *pipe) Read(b []byte) (int, error) {
+	return p.r.Read(b)
+}
+
+func (p *pipe) Close() error {
+	if err := p.stdin.wait(p.ctx); err != nil {
+		return err
+	}
+	if p.exitCode != 0 {
+		return &ExitError{Code: p.exitCode}
+	}
+	return nil
+}
+
+// ExitError is the error returned for a response with a non-zero exit code.
+type ExitError struct {
+	Code int
+}
+
+// Error returns a message like the one from *os/exec.ExitError.
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns e.Code.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// FileSystem is a git.FileSystem for slash-separated paths that does not
+// access the local filesystem. EvalSymlinks only cleans the path.
+type FileSystem struct{}
+
+// Join calls path.Join.
+func (FileSystem) Join(elem ...string) string {
+	return slashpath.Join(elem...)
+}
+
+// Clean calls path.Clean.
+func (FileSystem) Clean(path string) string {
+	return slashpath.Clean(path)
+}
+
+// IsAbs calls path.IsAbs.
+func (FileSystem) IsAbs(path string) bool {
+	return slashpath.IsAbs(path)
+}
+
+// EvalSymlinks returns the cleaned path.
+func (FileSystem) EvalSymlinks(path string) (string, error) {
+	return slashpath.Clean(path), nil
+}
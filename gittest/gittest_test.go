@@ -0,0 +1,250 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gittest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"gg-scm.io/pkg/git"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatchArgs(t *testing.T) {
+	tests := []struct {
+		pattern []string
+		args    []string
+		want    bool
+	}{
+		{pattern: nil, args: nil, want: true},
+		{pattern: nil, args: []string{"status"}, want: false},
+		{pattern: []string{"status"}, args: []string{"status"}, want: true},
+		{pattern: []string{"status"}, args: []string{"log"}, want: false},
+		{pattern: []string{"status"}, args: []string{"status", "-z"}, want: false},
+		{pattern: []string{"cat-file", "*", "HEAD"}, args: []string{"cat-file", "commit", "HEAD"}, want: true},
+		{pattern: []string{"cat-file", "*"}, args: []string{"cat-file"}, want: false},
+		{pattern: []string{"log", "..."}, args: []string{"log"}, want: true},
+		{pattern: []string{"log", "..."}, args: []string{"log", "-z", "HEAD"}, want: true},
+		{pattern: []string{"log", "..."}, args: []string{"status"}, want: false},
+		{pattern: []string{"...", "HEAD"}, args: []string{"...", "HEAD"}, want: true},
+		{pattern: []string{"...", "HEAD"}, args: []string{"log", "HEAD"}, want: false},
+	}
+	for _, test := range tests {
+		if got := matchArgs(test.pattern, test.args); got != test.want {
+			t.Errorf("matchArgs(%q, %q) = %t; want %t", test.pattern, test.args, got, test.want)
+		}
+	}
+}
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+	r := new(Runner)
+	r.Handle([]string{"rev-parse", "--show-toplevel"}, Response{Stdout: "/repo\n"})
+	r.Handle([]string{"rev-parse", "..."}, Response{
+		Stderr:   "fatal: bad revision\n",
+		ExitCode: 128,
+	})
+	g := git.Custom("/repo/sub", r, FileSystem{})
+
+	top, err := g.WorkTree(ctx)
+	if err != nil {
+		t.Error("WorkTree:", err)
+	} else if top != "/repo" {
+		t.Errorf("WorkTree(ctx) = %q; want \"/repo\"", top)
+	}
+
+	_, err = g.GitDir(ctx)
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 128 {
+		t.Errorf("GitDir(ctx) error = %v; want exit code 128", err)
+	} else if !strings.Contains(err.Error(), "fatal: bad revision") {
+		t.Errorf("GitDir(ctx) error = %q; want to contain stderr", err)
+	}
+
+	// Non-strict runners succeed for unexpected invocations.
+	if err := g.Run(ctx, "gc"); err != nil {
+		t.Error("Run(ctx, \"gc\"):", err)
+	}
+	if err := r.RunGit(ctx, &git.Invocation{
+		Args:  []string{"hash-object", "--stdin"},
+		Dir:   "/repo",
+		Env:   []string{"FOO=bar"},
+		Stdin: strings.NewReader("Hello\n"),
+	}); err != nil {
+		t.Error("RunGit:", err)
+	}
+
+	want := []*Invocation{
+		{Args: []string{"rev-parse", "--show-toplevel"}, Dir: "/repo/sub"},
+		{Args: []string{"rev-parse", "--absolute-git-dir"}, Dir: "/repo/sub"},
+		{Args: []string{"gc"}, Dir: "/repo/sub"},
+		{Args: []string{"hash-object", "--stdin"}, Dir: "/repo", Env: []string{"FOO=bar"}, Stdin: "Hello\n"},
+	}
+	if diff := cmp.Diff(want, r.Invocations()); diff != "" {
+		t.Errorf("Invocations() (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want[2:], r.Unexpected()); diff != "" {
+		t.Errorf("Unexpected() (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunner_Strict(t *testing.T) {
+	ctx := context.Background()
+	r := &Runner{Strict: true}
+	r.Handle([]string{"--version"}, Response{Stdout: "git version 2.30.0\n"})
+	g := git.Custom("/repo", r, FileSystem{})
+
+	if err := g.Run(ctx, "--version"); err != nil {
+		t.Error("Run(ctx, \"--version\"):", err)
+	}
+	if err := g.Run(ctx, "gc"); err == nil {
+		t.Error("Run(ctx, \"gc\") did not return an error")
+	}
+	if got := len(r.Unexpected()); got != 1 {
+		t.Errorf("len(Unexpected()) = %d; want 1", got)
+	}
+}
+
+func TestPipeRunner(t *testing.T) {
+	ctx := context.Background()
+	r := &PipeRunner{Runner: Runner{Strict: true}}
+	r.Handle([]string{"cat-file", "blob", "HEAD:foo.txt"}, Response{Stdout: "Hello, World!\n"})
+	r.Handle([]string{"cat-file", "blob", "HEAD:missing.txt"}, Response{
+		Stderr:   "fatal: path 'missing.txt' does not exist in 'HEAD'\n",
+		ExitCode: 128,
+	})
+	var _ git.Piper = r
+	g := git.Custom("/repo", r, FileSystem{})
+
+	rc, err := g.Cat(ctx, "HEAD", "foo.txt")
+	if err != nil {
+		t.Fatal("Cat:", err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Error("Cat:", err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Error("Cat:", err)
+	}
+	if want := "Hello, World!\n"; string(got) != want {
+		t.Errorf("Cat(ctx, \"HEAD\", \"foo.txt\") content = %q; want %q", got, want)
+	}
+
+	if rc, err := g.Cat(ctx, "HEAD", "missing.txt"); err == nil {
+		rc.Close()
+		t.Error("Cat(ctx, \"HEAD\", \"missing.txt\") did not return an error")
+	}
+}
+
+func TestObjectReader(t *testing.T) {
+	const (
+		commit1 = "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+			"author Octo Cat <noreply@github.com> 1519203600 +0000\n" +
+			"committer Octo Cat <noreply@github.com> 1519203600 +0000\n" +
+			"\n" +
+			"First\n"
+		commit2 = "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+			"parent 2c6a5b9fe9cd4e1dc4f1ec2c4fb4e3d9b8f4a4d7\n" +
+			"author Octo Cat <noreply@github.com> 1519203600 +0000\n" +
+			"committer Octo Cat <noreply@github.com> 1519203600 +0000\n" +
+			"\n" +
+			"Second\n"
+	)
+	batchOutput := fmt.Sprintf("f6a3ee2e3b3aa8b4c2c5c3fbd81b1cbf0c1fe0d1 commit %d\n%s\n", len(commit2), commit2) +
+		fmt.Sprintf("2c6a5b9fe9cd4e1dc4f1ec2c4fb4e3d9b8f4a4d7 commit %d\n%s\n", len(commit1), commit1)
+
+	tests := []struct {
+		name   string
+		runner interface {
+			git.Runner
+			Handle(pattern []string, resp Response)
+			Invocations() []*Invocation
+		}
+	}{
+		{name: "Runner", runner: &Runner{Strict: true}},
+		{name: "PipeRunner", runner: &PipeRunner{Runner: Runner{Strict: true}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			test.runner.Handle([]string{"cat-file", "--batch"}, Response{Stdout: batchOutput})
+			g := git.Custom("/repo", test.runner, FileSystem{})
+
+			// The ObjectReader writes each request to the subprocess's stdin and
+			// waits for the response before writing the next request.
+			r, err := g.OpenObjectReader(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := r.Commit(ctx, "HEAD")
+			if err != nil {
+				t.Error(err)
+			} else if c.Message != "Second\n" {
+				t.Errorf("Commit(ctx, \"HEAD\").Message = %q; want \"Second\\n\"", c.Message)
+			}
+			c, err = r.Commit(ctx, "HEAD~")
+			if err != nil {
+				t.Error(err)
+			} else if c.Message != "First\n" {
+				t.Errorf("Commit(ctx, \"HEAD~\").Message = %q; want \"First\\n\"", c.Message)
+			}
+			if err := r.Close(); err != nil {
+				t.Error("Close:", err)
+			}
+
+			invocations := test.runner.Invocations()
+			if len(invocations) != 1 {
+				t.Fatalf("len(Invocations()) = %d; want 1", len(invocations))
+			}
+			const wantStdin = "HEAD^{commit}\nHEAD~^{commit}\n"
+			if got := invocations[0].Stdin; got != wantStdin {
+				t.Errorf("Invocations()[0].Stdin = %q; want %q", got, wantStdin)
+			}
+		})
+	}
+}
+
+func ExampleRunner() {
+	ctx := context.Background()
+	r := &Runner{Strict: true}
+	r.Handle([]string{"rev-parse", "-q", "--verify", "--revs-only", "HEAD^0"}, Response{
+		Stdout: "2c6a5b9fe9cd4e1dc4f1ec2c4fb4e3d9b8f4a4d7\n",
+	})
+	r.Handle([]string{"rev-parse", "-q", "--verify", "--revs-only", "--symbolic-full-name", "HEAD"}, Response{
+		Stdout: "refs/heads/main\n",
+	})
+	g := git.Custom("/repo", r, FileSystem{})
+
+	head, err := g.Head(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Println(head.Commit)
+	fmt.Println(head.Ref)
+	fmt.Println(len(r.Invocations()), "invocations")
+	// Output:
+	// 2c6a5b9fe9cd4e1dc4f1ec2c4fb4e3d9b8f4a4d7
+	// refs/heads/main
+	// 2 invocations
+}
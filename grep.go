@@ -0,0 +1,344 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// GrepOptions specifies the command-line options for `git grep`.
+type GrepOptions struct {
+	// Patterns is the set of patterns to search for. A line matches if it
+	// matches any of the patterns. There must be at least one pattern.
+	Patterns []string
+	// Syntax specifies how Patterns are interpreted.
+	Syntax GrepSyntax
+	// If IgnoreCase is true, then differences in case are ignored
+	// when matching.
+	IgnoreCase bool
+
+	// Revs is the list of commits to search. If Revs is empty, then the
+	// tracked files in the working copy are searched. Revisions may not
+	// contain a colon, so trees like "HEAD:dir" are not allowed.
+	Revs []string
+	// If Cached is true, then the files in the index are searched
+	// instead of the working copy. Cached may not be combined with Revs.
+	Cached bool
+	// Pathspecs filters the files searched. If empty, then all files in
+	// the repository are searched.
+	Pathspecs []Pathspec
+
+	// BeforeContext and AfterContext are the number of non-matching lines
+	// to include before and after each matching line.
+	BeforeContext int
+	AfterContext  int
+}
+
+// GrepSyntax specifies how a grep pattern is interpreted.
+type GrepSyntax int
+
+// Grep pattern syntaxes.
+const (
+	// GrepBasicRegexp interprets patterns as POSIX basic regular expressions.
+	// This is the default.
+	GrepBasicRegexp GrepSyntax = iota
+	// GrepExtendedRegexp interprets patterns as POSIX extended regular expressions.
+	GrepExtendedRegexp
+	// GrepFixedStrings interprets patterns as literal strings.
+	GrepFixedStrings
+	// GrepPerlRegexp interprets patterns as Perl-compatible regular expressions.
+	// Git must be built with PCRE support.
+	GrepPerlRegexp
+)
+
+// String returns the Go constant name of the syntax.
+func (syntax GrepSyntax) String() string {
+	switch syntax {
+	case GrepBasicRegexp:
+		return "GrepBasicRegexp"
+	case GrepExtendedRegexp:
+		return "GrepExtendedRegexp"
+	case GrepFixedStrings:
+		return "GrepFixedStrings"
+	case GrepPerlRegexp:
+		return "GrepPerlRegexp"
+	default:
+		return fmt.Sprintf("GrepSyntax(%d)", int(syntax))
+	}
+}
+
+// A GrepMatch is a single line found by Grep.
+type GrepMatch struct {
+	// Rev is the revision the line was found in, as given in
+	// GrepOptions.Revs. It is empty if the working copy or index was searched.
+	Rev string
+	// Path is the path of the file the line was found in.
+	Path TopPath
+	// Line is the 1-based line number of the line in the file.
+	Line int
+	// Column is the 1-based byte offset of the first match in the line.
+	// It is zero for context lines.
+	Column int
+	// Text is the content of the line without its trailing newline.
+	Text string
+	// Context is true if the line did not match but is included because it
+	// is near a matching line.
+	Context bool
+}
+
+const grepErrPrefix = "git grep"
+
+// grepGroupSeparator is written between non-adjacent groups of lines
+// when context lines are requested.
+const grepGroupSeparator = "--\n"
+
+// Grep starts searching for lines matching the given patterns. Binary files
+// are not searched. It is the caller's responsibility to call Close on the
+// returned GrepMatches.
+func (g *Git) Grep(ctx context.Context, opts GrepOptions) (*GrepMatches, error) {
+	if len(opts.Patterns) == 0 {
+		return nil, fmt.Errorf("%s: no patterns", grepErrPrefix)
+	}
+	if opts.Cached && len(opts.Revs) > 0 {
+		return nil, fmt.Errorf("%s: Cached and Revs are mutually exclusive", grepErrPrefix)
+	}
+	if opts.BeforeContext < 0 || opts.AfterContext < 0 {
+		return nil, fmt.Errorf("%s: negative context", grepErrPrefix)
+	}
+	if version, err := g.getVersion(ctx); err == nil && !versionAtLeast(version, 2, 19) {
+		return nil, fmt.Errorf("%s: requires Git 2.19 or newer (using %s)", grepErrPrefix, version)
+	}
+	args := []string{
+		"grep",
+		"--null",
+		"--line-number",
+		"--column",
+		"--full-name",
+		"-I",
+		"--no-color",
+	}
+	switch opts.Syntax {
+	case GrepBasicRegexp:
+		args = append(args, "--basic-regexp")
+	case GrepExtendedRegexp:
+		args = append(args, "--extended-regexp")
+	case GrepFixedStrings:
+		args = append(args, "--fixed-strings")
+	case GrepPerlRegexp:
+		args = append(args, "--perl-regexp")
+	default:
+		return nil, fmt.Errorf("%s: unknown syntax %v", grepErrPrefix, opts.Syntax)
+	}
+	if opts.IgnoreCase {
+		args = append(args, "--ignore-case")
+	}
+	if opts.Cached {
+		args = append(args, "--cached")
+	}
+	if opts.BeforeContext > 0 {
+		args = append(args, fmt.Sprintf("--before-context=%d", opts.BeforeContext))
+	}
+	if opts.AfterContext > 0 {
+		args = append(args, fmt.Sprintf("--after-context=%d", opts.AfterContext))
+	}
+	for _, pattern := range opts.Patterns {
+		args = append(args, "-e", pattern)
+	}
+	for _, rev := range opts.Revs {
+		if err := validateRev(rev); err != nil {
+			return nil, fmt.Errorf("%s: %w", grepErrPrefix, err)
+		}
+		if strings.Contains(rev, ":") {
+			// Git would print paths relative to the tree, so the
+			// matches could not be reported as TopPaths.
+			return nil, fmt.Errorf("%s: revision %q is not a commit", grepErrPrefix, rev)
+		}
+		args = append(args, rev)
+	}
+	args = append(args, "--")
+	if len(opts.Pathspecs) == 0 {
+		// Search the whole repository, not just the current directory.
+		args = append(args, ":/")
+	}
+	for _, spec := range opts.Pathspecs {
+		args = append(args, spec.String())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stderr := new(bytes.Buffer)
+	pipe, err := StartPipe(ctx, g.runner, &Invocation{
+		Args:   args,
+		Dir:    g.dir,
+		Stderr: &limitWriter{w: stderr, n: errorOutputLimit},
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("%s: %w", grepErrPrefix, err)
+	}
+	return &GrepMatches{
+		revs:   opts.Revs,
+		r:      bufio.NewReader(pipe),
+		pipe:   pipe,
+		stderr: stderr,
+		cancel: cancel,
+	}, nil
+}
+
+// GrepMatches is an open handle to a `git grep` subprocess.
+// Closing the GrepMatches stops the subprocess.
+type GrepMatches struct {
+	revs   []string
+	r      *bufio.Reader
+	pipe   io.ReadCloser
+	stderr *bytes.Buffer
+	cancel context.CancelFunc
+
+	scanErr  error
+	scanDone bool
+	match    *GrepMatch
+}
+
+// Next attempts to scan the next line and returns whether there is a new line.
+func (gm *GrepMatches) Next() bool {
+	if gm.scanDone {
+		return false
+	}
+	err := gm.next()
+	if err != nil {
+		gm.scanErr = err
+		if errors.Is(err, io.EOF) {
+			gm.scanErr = nil
+		}
+		gm.scanDone = true
+		gm.match = nil
+		gm.cancel()
+		return false
+	}
+	return true
+}
+
+func (gm *GrepMatches) next() error {
+	// Each line is written as:
+	//
+	//	[<rev>:]<path> NUL <line> NUL <column> NUL <text> LF
+	//
+	// Context lines omit the column.
+	name, err := gm.r.ReadString(0)
+	if len(name) == 0 && err != nil {
+		// Reached end of output. Wait for subprocess to exit, since the read
+		// error may be from a pipe that reports the exit status.
+		if err := gm.close(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("%s: %w", grepErrPrefix, err)
+	}
+	name = strings.TrimPrefix(name[:len(name)-1], grepGroupSeparator)
+	match := new(GrepMatch)
+	match.Rev, match.Path = splitGrepName(gm.revs, name)
+	if match.Path == "" {
+		return fmt.Errorf("%s: invalid file name %q", grepErrPrefix, name)
+	}
+	lineno, err := gm.r.ReadString(0)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("%s: %w", grepErrPrefix, err)
+	}
+	match.Line, err = strconv.Atoi(lineno[:len(lineno)-1])
+	if err != nil {
+		return fmt.Errorf("%s: %s: invalid line number %q", grepErrPrefix, name, lineno[:len(lineno)-1])
+	}
+	rest, err := gm.r.ReadString('\n')
+	if err != nil && !(len(rest) > 0 && errors.Is(err, io.EOF)) {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("%s: %w", grepErrPrefix, err)
+	}
+	match.Text = strings.TrimSuffix(rest, "\n")
+	match.Context = true
+	if i := strings.IndexByte(match.Text, 0); i > 0 {
+		if col, err := strconv.Atoi(match.Text[:i]); err == nil {
+			match.Column = col
+			match.Text = match.Text[i+1:]
+			match.Context = false
+		}
+	}
+	gm.match = match
+	return nil
+}
+
+// splitGrepName splits a file name from `git grep` output into the revision
+// and the path. Git prefixes the path with the revision and a colon when
+// searching revisions.
+func splitGrepName(revs []string, name string) (rev string, path TopPath) {
+	if len(revs) == 0 {
+		return "", TopPath(name)
+	}
+	for _, r := range revs {
+		// One revision may be a prefix of another, so prefer the longest match.
+		if len(r) > len(rev) && strings.HasPrefix(name, r+":") {
+			rev = r
+		}
+	}
+	if rev == "" {
+		return "", ""
+	}
+	return rev, TopPath(name[len(rev)+1:])
+}
+
+// Match returns the most recently scanned line.
+// Next must be called at least once before calling Match.
+func (gm *GrepMatches) Match() *GrepMatch {
+	return gm.match
+}
+
+// Close ends the subprocess and waits for it to finish.
+// Close returns an error if Next returned false due to a parse failure.
+func (gm *GrepMatches) Close() error {
+	gm.cancel()
+	gm.close()         // Ignore error, since it's from interrupting.
+	gm.scanDone = true // Bail early for future calls to Next.
+	return gm.scanErr
+}
+
+func (gm *GrepMatches) close() error {
+	if gm.pipe == nil {
+		return nil
+	}
+	err := gm.pipe.Close()
+	gm.pipe = nil
+	if err != nil && exitCode(err) != 1 {
+		// Exit code 1 means no lines were found.
+		return commandError(grepErrPrefix, err, gm.stderr.Bytes())
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGrep(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if version, err := env.g.getVersion(ctx); err != nil {
+		t.Fatal(err)
+	} else if !versionAtLeast(version, 2, 19) {
+		t.Skipf("Git %s does not support --column", version)
+	}
+
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	err = env.root.Apply(
+		filesystem.Write("a.txt", "alpha\nbeta foo\ngamma\ndelta\nFoo epsilon\n"),
+		filesystem.Write("dir/we:ird.txt", "x:foo\n"),
+		filesystem.Write("bin.dat", "foo\x00bin"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"."}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("a.txt", "foo only in working copy\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		opts GrepOptions
+		want []*GrepMatch
+	}{
+		{
+			name: "WorkingCopy",
+			opts: GrepOptions{Patterns: []string{"foo"}},
+			want: []*GrepMatch{
+				{Path: "a.txt", Line: 1, Column: 1, Text: "foo only in working copy"},
+				{Path: "dir/we:ird.txt", Line: 1, Column: 3, Text: "x:foo"},
+			},
+		},
+		{
+			name: "Subdirectory",
+			dir:  "dir",
+			opts: GrepOptions{Patterns: []string{"foo"}},
+			want: []*GrepMatch{
+				{Path: "a.txt", Line: 1, Column: 1, Text: "foo only in working copy"},
+				{Path: "dir/we:ird.txt", Line: 1, Column: 3, Text: "x:foo"},
+			},
+		},
+		{
+			name: "Cached",
+			opts: GrepOptions{Patterns: []string{"foo"}, Cached: true, Pathspecs: []Pathspec{"a.txt"}},
+			want: []*GrepMatch{
+				{Path: "a.txt", Line: 2, Column: 6, Text: "beta foo"},
+			},
+		},
+		{
+			name: "Revs",
+			opts: GrepOptions{Patterns: []string{"foo"}, Revs: []string{"HEAD", "HEAD~0"}, Pathspecs: []Pathspec{"a.txt"}},
+			want: []*GrepMatch{
+				{Rev: "HEAD", Path: "a.txt", Line: 2, Column: 6, Text: "beta foo"},
+				{Rev: "HEAD~0", Path: "a.txt", Line: 2, Column: 6, Text: "beta foo"},
+			},
+		},
+		{
+			name: "IgnoreCase",
+			opts: GrepOptions{Patterns: []string{"foo"}, IgnoreCase: true, Revs: []string{"HEAD"}, Pathspecs: []Pathspec{"a.txt"}},
+			want: []*GrepMatch{
+				{Rev: "HEAD", Path: "a.txt", Line: 2, Column: 6, Text: "beta foo"},
+				{Rev: "HEAD", Path: "a.txt", Line: 5, Column: 1, Text: "Foo epsilon"},
+			},
+		},
+		{
+			name: "Extended",
+			opts: GrepOptions{Patterns: []string{"^(alpha|gamma)$"}, Syntax: GrepExtendedRegexp, Revs: []string{"HEAD"}},
+			want: []*GrepMatch{
+				{Rev: "HEAD", Path: "a.txt", Line: 1, Column: 1, Text: "alpha"},
+				{Rev: "HEAD", Path: "a.txt", Line: 3, Column: 1, Text: "gamma"},
+			},
+		},
+		{
+			name: "Fixed",
+			opts: GrepOptions{Patterns: []string{"x:f"}, Syntax: GrepFixedStrings, Revs: []string{"HEAD"}},
+			want: []*GrepMatch{
+				{Rev: "HEAD", Path: "dir/we:ird.txt", Line: 1, Column: 1, Text: "x:foo"},
+			},
+		},
+		{
+			name: "Context",
+			opts: GrepOptions{Patterns: []string{"alpha", "epsilon"}, Revs: []string{"HEAD"}, AfterContext: 1},
+			want: []*GrepMatch{
+				{Rev: "HEAD", Path: "a.txt", Line: 1, Column: 1, Text: "alpha"},
+				{Rev: "HEAD", Path: "a.txt", Line: 2, Text: "beta foo", Context: true},
+				{Rev: "HEAD", Path: "a.txt", Line: 5, Column: 5, Text: "Foo epsilon"},
+			},
+		},
+		{
+			name: "NoMatches",
+			opts: GrepOptions{Patterns: []string{"zeta"}, Revs: []string{"HEAD"}},
+			want: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := env.g
+			if test.dir != "" {
+				g = g.WithDir(env.root.FromSlash(test.dir))
+			}
+			matches, err := g.Grep(ctx, test.opts)
+			if err != nil {
+				t.Fatal("Grep:", err)
+			}
+			var got []*GrepMatch
+			for matches.Next() {
+				got = append(got, matches.Match())
+			}
+			if err := matches.Close(); err != nil {
+				t.Error("Grep:", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Grep(ctx, %+v) (-want +got):\n%s", test.opts, diff)
+			}
+		})
+	}
+
+	t.Run("NoMatchesWithoutPiper", func(t *testing.T) {
+		// Hide the Piper implementation so that the output is read through the
+		// StartPipe fallback, which reports the exit status to the reader.
+		fallback := Custom(env.root.String(), struct{ Runner }{env.g.Runner()}, env.g.FileSystem())
+		matches, err := fallback.Grep(ctx, GrepOptions{Patterns: []string{"zeta"}, Revs: []string{"HEAD"}})
+		if err != nil {
+			t.Fatal("Grep:", err)
+		}
+		for matches.Next() {
+			t.Errorf("Grep found %+v; want no matches", matches.Match())
+		}
+		if err := matches.Close(); err != nil {
+			t.Error("Grep:", err)
+		}
+	})
+
+	t.Run("BadPattern", func(t *testing.T) {
+		matches, err := env.g.Grep(ctx, GrepOptions{Patterns: []string{"("}, Syntax: GrepExtendedRegexp})
+		if err != nil {
+			return
+		}
+		for matches.Next() {
+		}
+		if err := matches.Close(); err == nil {
+			t.Error("Grep with invalid pattern did not return an error")
+		}
+	})
+
+	t.Run("TreeRev", func(t *testing.T) {
+		matches, err := env.g.Grep(ctx, GrepOptions{Patterns: []string{"foo"}, Revs: []string{"HEAD:"}})
+		if err == nil {
+			matches.Close()
+			t.Error("Grep with tree revision did not return an error")
+		}
+	})
+}
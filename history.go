@@ -0,0 +1,275 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gg-scm.io/pkg/git/object"
+)
+
+// FileHistoryOptions specifies filters on a file history listing.
+type FileHistoryOptions struct {
+	// Limit specifies the upper bound on the number of commits to return
+	// from FileHistory. Zero means no limit.
+	Limit int
+}
+
+// A FileHistoryEntry describes a change to a file in a single commit.
+type FileHistoryEntry struct {
+	// Commit is the commit that changed the file.
+	Commit *object.Commit
+	// CommitHash is the object ID of Commit.
+	CommitHash Hash
+
+	// DiffStatusEntry describes the change to the file relative to the
+	// commit's first parent. Name is the path of the file in the commit.
+	// If the file was renamed in the commit, then Code is
+	// DiffStatusRenamed and From is the path of the file in the parent.
+	DiffStatusEntry
+
+	// Blob is the object ID of the file's content in the commit.
+	// It is zero if the file was deleted.
+	Blob Hash
+}
+
+// FileHistory starts listing the commits reachable from rev that changed
+// the file at the given path, newest first. Unlike Log, FileHistory follows
+// the file across renames, so older entries may have a different path.
+// If rev is empty, then HEAD is used. The context's deadline and cancelation
+// will apply to the entire read from the FileHistory. It is the caller's
+// responsibility to call Close on the returned FileHistory.
+func (g *Git) FileHistory(ctx context.Context, rev string, path TopPath, opts FileHistoryOptions) (*FileHistory, error) {
+	if rev == "" {
+		rev = Head.String()
+	}
+	errPrefix := fmt.Sprintf("git log --follow %q -- %q", rev, path)
+	if err := validateRev(rev); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%s: empty path", errPrefix)
+	}
+	args := logArgs(
+		"--follow",
+		"-z",
+		"--name-status",
+		"--format="+logCommitPrefix+"%H",
+	)
+	// Limit is enforced while reading instead of with --max-count,
+	// since Git counts the merge commits that FileHistory skips.
+	args = append(args, rev, "--", path.Pathspec().String())
+
+	ctx, cancel := context.WithCancel(ctx)
+	stderr := new(bytes.Buffer)
+	pipe, err := StartPipe(ctx, g.runner, &Invocation{
+		Args:   args,
+		Dir:    g.dir,
+		Stderr: &limitWriter{w: stderr, n: errorOutputLimit},
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	objects, err := g.OpenObjectReader(ctx)
+	if err != nil {
+		cancel()
+		pipe.Close()
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return &FileHistory{
+		errPrefix: errPrefix,
+		ctx:       ctx,
+		tokens:    &nulTokenReader{r: bufio.NewReader(pipe)},
+		pipe:      pipe,
+		stderr:    stderr,
+		objects:   objects,
+		cancel:    cancel,
+		path:      path,
+		limit:     opts.Limit,
+	}, nil
+}
+
+// FileHistory is an open handle to a `git log --follow` subprocess.
+// Closing the FileHistory stops the subprocess.
+type FileHistory struct {
+	errPrefix string
+	ctx       context.Context
+	tokens    *nulTokenReader
+	pipe      io.ReadCloser
+	stderr    *bytes.Buffer
+	objects   *ObjectReader
+	cancel    context.CancelFunc
+
+	// path is the path of the file in the next commit to be read.
+	path TopPath
+	// limit is the maximum number of entries to return or zero if unlimited.
+	// count is the number of entries returned so far.
+	limit int
+	count int
+
+	scanErr  error
+	scanDone bool
+	entry    *FileHistoryEntry
+}
+
+// Next attempts to scan the next entry and returns whether there is a new entry.
+func (fh *FileHistory) Next() bool {
+	if fh.scanDone {
+		return false
+	}
+	err := fh.next()
+	if err != nil {
+		fh.scanErr = err
+		if errors.Is(err, io.EOF) {
+			fh.scanErr = nil
+		}
+		fh.scanDone = true
+		fh.entry = nil
+		fh.cancel()
+		return false
+	}
+	return true
+}
+
+func (fh *FileHistory) next() error {
+	if fh.limit > 0 && fh.count >= fh.limit {
+		// Close will stop the subprocess.
+		return io.EOF
+	}
+	for {
+		header, err := fh.tokens.next()
+		if errors.Is(err, io.EOF) {
+			// Reached successful end. Wait for subprocesses to exit.
+			if err := fh.close(); err != nil {
+				return err
+			}
+			return io.EOF
+		}
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(header, logCommitPrefix) {
+			return fmt.Errorf("%s: expected commit, got %q", fh.errPrefix, header)
+		}
+		commitHash, err := ParseHash(header[len(logCommitPrefix):])
+		if err != nil {
+			return fmt.Errorf("%s: %w", fh.errPrefix, err)
+		}
+		changes, err := fh.readChanges()
+		if err != nil {
+			return fmt.Errorf("%s: commit %v: %w", fh.errPrefix, commitHash, err)
+		}
+		ent := &FileHistoryEntry{CommitHash: commitHash}
+		found := false
+		for _, change := range changes {
+			if change.Name == fh.path || !found {
+				ent.DiffStatusEntry = change
+				found = true
+			}
+		}
+		if !found {
+			// Merge commits do not have a diff.
+			continue
+		}
+		ent.Commit, err = fh.objects.Commit(fh.ctx, commitHash.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", fh.errPrefix, err)
+		}
+		if ent.Code != DiffStatusDeleted {
+			info, err := fh.objects.Stat(fh.ctx, commitHash.String()+":"+ent.Name.String())
+			if err != nil {
+				return fmt.Errorf("%s: %w", fh.errPrefix, err)
+			}
+			ent.Blob = info.ID
+		}
+		if ent.From != "" {
+			fh.path = ent.From
+		} else {
+			fh.path = ent.Name
+		}
+		fh.entry = ent
+		fh.count++
+		return nil
+	}
+}
+
+// readChanges reads the `--name-status` entries for a single commit.
+func (fh *FileHistory) readChanges() ([]DiffStatusEntry, error) {
+	var changes []DiffStatusEntry
+	for {
+		tok, err := fh.tokens.next()
+		if errors.Is(err, io.EOF) {
+			return changes, nil
+		}
+		if err != nil {
+			return changes, err
+		}
+		// Git separates the commit line from the diff with a newline.
+		tok = strings.TrimPrefix(tok, "\n")
+		if tok == "" {
+			continue
+		}
+		if strings.HasPrefix(tok, logCommitPrefix) {
+			fh.tokens.unread(tok)
+			return changes, nil
+		}
+		names, err := readStatNames(fh.tokens, DiffStatusCode(tok[0]))
+		if err != nil {
+			return changes, err
+		}
+		ent, _, err := readDiffStatusEntry(tok + "\x00" + strings.Join(names, "\x00") + "\x00")
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, ent)
+	}
+}
+
+// Entry returns the most recently scanned entry.
+// Next must be called at least once before calling Entry.
+func (fh *FileHistory) Entry() *FileHistoryEntry {
+	return fh.entry
+}
+
+// Close ends the subprocess and waits for it to finish.
+// Close returns an error if Next returned false due to a parse failure.
+func (fh *FileHistory) Close() error {
+	fh.cancel()
+	fh.close()         // Ignore error, since it's from interrupting.
+	fh.scanDone = true // Bail early for future calls to Next.
+	return fh.scanErr
+}
+
+func (fh *FileHistory) close() error {
+	if fh.pipe == nil {
+		return nil
+	}
+	err := fh.pipe.Close()
+	fh.pipe = nil
+	objErr := fh.objects.Close()
+	if err != nil {
+		return commandError(fh.errPrefix, err, fh.stderr.Bytes())
+	}
+	return objErr
+}
@@ -0,0 +1,205 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFileHistory(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	const (
+		content1 = "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\n"
+		content2 = content1 + "line 9\n"
+		content3 = content2 + "line 10\n"
+	)
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	// Configuration that changes `git log` output should be ignored.
+	if err := env.g.Run(ctx, "config", "log.showRoot", "false"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("old.txt", content1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"old.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "add old.txt", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("old.txt", content2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CommitAll(ctx, "modify old.txt", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("unrelated.txt", dummyContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"unrelated.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "add unrelated.txt", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Mkdir("dir"), filesystem.Rename("old.txt", "dir/new.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("dir/new.txt", content3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"old.txt", "dir/new.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "rename to dir/new.txt", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	hist, err := env.g.FileHistory(ctx, "", "dir/new.txt", FileHistoryOptions{})
+	if err != nil {
+		t.Fatal("FileHistory:", err)
+	}
+	type result struct {
+		Message string
+		DiffStatusEntry
+		Blob Hash
+	}
+	var got []result
+	for hist.Next() {
+		ent := hist.Entry()
+		if ent.Commit.SHA1() != ent.CommitHash {
+			t.Errorf("entry for %q: Commit.SHA1() = %v; want %v", ent.Commit.Message, ent.Commit.SHA1(), ent.CommitHash)
+		}
+		got = append(got, result{
+			Message:         ent.Commit.Message,
+			DiffStatusEntry: ent.DiffStatusEntry,
+			Blob:            ent.Blob,
+		})
+	}
+	if err := hist.Close(); err != nil {
+		t.Error("FileHistory:", err)
+	}
+	want := []result{
+		{
+			Message: "rename to dir/new.txt",
+			DiffStatusEntry: DiffStatusEntry{
+				Code: DiffStatusRenamed,
+				Name: "dir/new.txt",
+				From: "old.txt",
+			},
+			Blob: blobSum(content3),
+		},
+		{
+			Message: "modify old.txt",
+			DiffStatusEntry: DiffStatusEntry{
+				Code: DiffStatusModified,
+				Name: "old.txt",
+			},
+			Blob: blobSum(content2),
+		},
+		{
+			Message: "add old.txt",
+			DiffStatusEntry: DiffStatusEntry{
+				Code: DiffStatusAdded,
+				Name: "old.txt",
+			},
+			Blob: blobSum(content1),
+		},
+	}
+	// Similarity depends on Git's heuristics, so only check that it's set.
+	if len(got) > 0 {
+		if got[0].Similarity <= 0 || got[0].Similarity > 100 {
+			t.Errorf("rename similarity = %d; want 1-100", got[0].Similarity)
+		}
+		got[0].Similarity = 0
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("FileHistory(...) (-want +got):\n%s", diff)
+	}
+
+	// Check Limit.
+	hist, err = env.g.FileHistory(ctx, "HEAD", "dir/new.txt", FileHistoryOptions{Limit: 1})
+	if err != nil {
+		t.Fatal("FileHistory:", err)
+	}
+	n := 0
+	for hist.Next() {
+		n++
+	}
+	if err := hist.Close(); err != nil {
+		t.Error("FileHistory:", err)
+	}
+	if n != 1 {
+		t.Errorf("FileHistory(..., {Limit: 1}) returned %d entries; want 1", n)
+	}
+
+	// Merge commits should not count toward Limit.
+	if err := env.g.NewBranch(ctx, "side", BranchOptions{Checkout: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("dir/new.txt", "side\n"+content3[len("line 1\n"):])); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CommitAll(ctx, "side change", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "checkout", "--quiet", "-b", "main2", "HEAD~"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("dir/new.txt", content3+"main\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CommitAll(ctx, "main change", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Merge(ctx, []string{"side"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "merge side", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	hist, err = env.g.FileHistory(ctx, "HEAD", "dir/new.txt", FileHistoryOptions{Limit: 2})
+	if err != nil {
+		t.Fatal("FileHistory:", err)
+	}
+	var messages []string
+	for hist.Next() {
+		messages = append(messages, hist.Entry().Commit.Message)
+	}
+	if err := hist.Close(); err != nil {
+		t.Error("FileHistory:", err)
+	}
+	if len(messages) != 2 {
+		t.Errorf("after merge, FileHistory(..., {Limit: 2}) returned %q; want 2 entries", messages)
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"gg-scm.io/pkg/git/githash"
+	"gg-scm.io/pkg/git/object"
+)
+
+// TreeEntry is a single entry in the cached tree extension. Entries are
+// listed in pre-order: each tree is followed by its subtrees.
+type TreeEntry struct {
+	// Path is the slash-separated path of the tree relative to the top of
+	// the working copy. The root tree has an empty path.
+	Path string
+	// EntryCount is the number of index entries covered by the tree, or -1
+	// if the tree has been invalidated.
+	EntryCount int
+	// SubtreeCount is the number of subtrees of the tree.
+	SubtreeCount int
+	// ObjectID is the hash of the tree object. It is zero if the tree has
+	// been invalidated.
+	ObjectID githash.SHA1
+}
+
+// IsValid reports whether the cached tree is up-to-date with the index.
+func (ent *TreeEntry) IsValid() bool {
+	return ent.EntryCount >= 0
+}
+
+// ResolveUndoEntry records the stages of a path that had a conflict before
+// it was resolved.
+type ResolveUndoEntry struct {
+	// Path is the slash-separated path of the file relative to the top of
+	// the working copy.
+	Path string
+	// Modes holds the mode of the file in stages 1, 2, and 3. A zero mode
+	// indicates that the path was not present in that stage.
+	Modes [3]object.Mode
+	// ObjectIDs holds the object ID of the file in stages 1, 2, and 3.
+	// It is zero for stages whose mode is zero.
+	ObjectIDs [3]githash.SHA1
+}
+
+// Link is the information from the split index link extension.
+// Entries in a split index are applied on top of the entries in the
+// shared index file, named "sharedindex.<SharedIndex>" in the Git directory.
+type Link struct {
+	// SharedIndex is the checksum of the shared index file.
+	SharedIndex githash.SHA1
+	// Delete lists the positions of entries in the shared index that are
+	// deleted by the split index.
+	Delete []int
+	// Replace lists the positions of entries in the shared index that are
+	// replaced by entries in the split index, in order.
+	Replace []int
+}
+
+func (idx *Index) parseExtensions(data []byte) error {
+	const headerSize = 8
+	for len(data) > 0 {
+		if len(data) < headerSize {
+			return io.ErrUnexpectedEOF
+		}
+		sig := string(data[:4])
+		size := binary.BigEndian.Uint32(data[4:])
+		if uint64(size) > uint64(len(data)-headerSize) {
+			return fmt.Errorf("%q extension: %w", sig, io.ErrUnexpectedEOF)
+		}
+		ext := data[headerSize : headerSize+int(size)]
+		data = data[headerSize+int(size):]
+
+		var err error
+		switch sig {
+		case "TREE":
+			idx.Tree, err = parseTreeExtension(ext)
+		case "REUC":
+			idx.ResolveUndo, err = parseResolveUndoExtension(ext)
+		case "link":
+			idx.Link, err = parseLinkExtension(ext)
+		case "sdir":
+			idx.Sparse = true
+		default:
+			// Extensions that start with an uppercase letter are optional.
+			// Others must be understood to interpret the index correctly.
+			if sig[0] < 'A' || sig[0] > 'Z' {
+				return fmt.Errorf("unsupported required extension %q", sig)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%q extension: %w", sig, err)
+		}
+	}
+	return nil
+}
+
+func parseTreeExtension(data []byte) ([]*TreeEntry, error) {
+	var entries []*TreeEntry
+	// The extension only stores each tree's name within its parent,
+	// so keep track of the ancestors whose subtrees haven't been read yet.
+	type ancestor struct {
+		path      string
+		remaining int
+	}
+	var stack []ancestor
+	for len(data) > 0 {
+		ent := new(TreeEntry)
+		name, tail, err := cutNUL(data)
+		if err != nil {
+			return entries, err
+		}
+		data = tail
+		for len(stack) > 0 && stack[len(stack)-1].remaining == 0 {
+			stack = stack[:len(stack)-1]
+		}
+		switch {
+		case len(stack) == 0 && len(entries) > 0:
+			return entries, errors.New("more trees than subtree counts")
+		case len(stack) == 0:
+			ent.Path = name
+		case stack[len(stack)-1].path == "":
+			ent.Path = name
+			stack[len(stack)-1].remaining--
+		default:
+			ent.Path = stack[len(stack)-1].path + "/" + name
+			stack[len(stack)-1].remaining--
+		}
+		var count string
+		count, data, err = cut(data, ' ')
+		if err != nil {
+			return entries, err
+		}
+		if ent.EntryCount, err = strconv.Atoi(count); err != nil || ent.EntryCount < -1 {
+			return entries, fmt.Errorf("invalid entry count %q", count)
+		}
+		var subtrees string
+		subtrees, data, err = cut(data, '\n')
+		if err != nil {
+			return entries, err
+		}
+		if ent.SubtreeCount, err = strconv.Atoi(subtrees); err != nil || ent.SubtreeCount < 0 {
+			return entries, fmt.Errorf("invalid subtree count %q", subtrees)
+		}
+		if ent.IsValid() {
+			if len(data) < githash.SHA1Size {
+				return entries, io.ErrUnexpectedEOF
+			}
+			copy(ent.ObjectID[:], data)
+			data = data[githash.SHA1Size:]
+		}
+		entries = append(entries, ent)
+		stack = append(stack, ancestor{path: ent.Path, remaining: ent.SubtreeCount})
+	}
+	return entries, nil
+}
+
+func parseResolveUndoExtension(data []byte) ([]*ResolveUndoEntry, error) {
+	var entries []*ResolveUndoEntry
+	for len(data) > 0 {
+		ent := new(ResolveUndoEntry)
+		var err error
+		ent.Path, data, err = cutNUL(data)
+		if err != nil {
+			return entries, err
+		}
+		for i := range ent.Modes {
+			var mode string
+			mode, data, err = cutNUL(data)
+			if err != nil {
+				return entries, err
+			}
+			m, err := strconv.ParseUint(mode, 8, 32)
+			if err != nil {
+				return entries, fmt.Errorf("invalid mode %q", mode)
+			}
+			ent.Modes[i] = object.Mode(m)
+		}
+		for i, mode := range ent.Modes {
+			if mode == 0 {
+				continue
+			}
+			if len(data) < githash.SHA1Size {
+				return entries, io.ErrUnexpectedEOF
+			}
+			copy(ent.ObjectIDs[i][:], data)
+			data = data[githash.SHA1Size:]
+		}
+		entries = append(entries, ent)
+	}
+	return entries, nil
+}
+
+func parseLinkExtension(data []byte) (*Link, error) {
+	if len(data) < githash.SHA1Size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	link := new(Link)
+	copy(link.SharedIndex[:], data)
+	data = data[githash.SHA1Size:]
+	if len(data) == 0 {
+		// Bitmaps are omitted when the split index is first created.
+		return link, nil
+	}
+	var err error
+	link.Delete, data, err = parseEWAH(data)
+	if err != nil {
+		return nil, fmt.Errorf("delete bitmap: %w", err)
+	}
+	link.Replace, data, err = parseEWAH(data)
+	if err != nil {
+		return nil, fmt.Errorf("replace bitmap: %w", err)
+	}
+	if len(data) > 0 {
+		return nil, errors.New("trailing data")
+	}
+	return link, nil
+}
+
+// parseEWAH decodes an EWAH-compressed bitmap into the positions of its
+// set bits.
+func parseEWAH(data []byte) (positions []int, rest []byte, err error) {
+	const headerSize = 8
+	if len(data) < headerSize {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	bitSize := binary.BigEndian.Uint32(data)
+	wordCount := binary.BigEndian.Uint32(data[4:])
+	data = data[headerSize:]
+	if uint64(wordCount)*8+4 > uint64(len(data)) {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	words := data[:wordCount*8]
+	rest = data[wordCount*8+4:]
+
+	bit := 0
+	for len(words) > 0 {
+		// Each run-length word is followed by its literal words.
+		rlw := binary.BigEndian.Uint64(words)
+		words = words[8:]
+		runBit := rlw&1 != 0
+		runLen := int(rlw >> 1 & 0xffffffff)
+		literalCount := int(rlw >> 33)
+		if runBit {
+			for i := bit; i < bit+runLen*64 && i < int(bitSize); i++ {
+				positions = append(positions, i)
+			}
+		}
+		bit += runLen * 64
+		if literalCount*8 > len(words) {
+			return nil, nil, errors.New("literal words past end of bitmap")
+		}
+		for i := 0; i < literalCount; i++ {
+			w := binary.BigEndian.Uint64(words)
+			words = words[8:]
+			for j := 0; j < 64; j++ {
+				if w&(1<<uint(j)) != 0 {
+					positions = append(positions, bit+j)
+				}
+			}
+			bit += 64
+		}
+	}
+	for len(positions) > 0 && positions[len(positions)-1] >= int(bitSize) {
+		positions = positions[:len(positions)-1]
+	}
+	return positions, rest, nil
+}
+
+func cutNUL(data []byte) (string, []byte, error) {
+	return cut(data, 0)
+}
+
+func cut(data []byte, sep byte) (string, []byte, error) {
+	i := bytes.IndexByte(data, sep)
+	if i == -1 {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	return string(data[:i]), data[i+1:], nil
+}
@@ -0,0 +1,292 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+Package index decodes the Git index file (also known as the "dircache" or
+staging area), usually stored at .git/index. The format is described in
+https://git-scm.com/docs/index-format.
+*/
+package index
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"gg-scm.io/pkg/git/githash"
+	"gg-scm.io/pkg/git/object"
+)
+
+// Index is a parsed Git index file.
+type Index struct {
+	// Version is the index format version: 2, 3, or 4.
+	Version uint32
+	// Entries is the list of entries in the index, sorted by path and then
+	// by stage. If the index has a split index link, entries that replace
+	// an entry in the shared index have empty paths.
+	Entries []*Entry
+
+	// Tree is the cached tree information from the TREE extension, or nil
+	// if the extension is not present.
+	Tree []*TreeEntry
+	// ResolveUndo is the information needed to recreate conflicts that have
+	// been resolved, from the REUC extension.
+	ResolveUndo []*ResolveUndoEntry
+	// Link is the split index information from the link extension, or nil
+	// if the extension is not present.
+	Link *Link
+	// Sparse is true if the index has the sdir extension, which means that
+	// some entries may be directories outside the sparse-checkout cone.
+	Sparse bool
+
+	// Checksum is the SHA-1 hash of the index file's contents.
+	// It is zero if the index was written with index.skipHash.
+	Checksum githash.SHA1
+}
+
+// Entry is a single file in the index.
+type Entry struct {
+	// Path is the slash-separated path of the file relative to the
+	// top of the working copy.
+	Path string
+	// ObjectID is the hash of the file's blob, or the commit of a submodule.
+	ObjectID githash.SHA1
+	// Mode is the file's type and permissions.
+	Mode object.Mode
+	// Stage is the merge stage of the entry: 0 for a normal entry, or
+	// 1 (base), 2 (ours), or 3 (theirs) for an unmerged entry.
+	Stage int
+
+	// Stat is the file system information recorded for the file at the
+	// time it was last updated.
+	Stat Stat
+
+	// AssumeValid is true if Git should assume that the file has not been
+	// modified in the working copy. See git-update-index(1)'s
+	// --assume-unchanged flag.
+	AssumeValid bool
+	// SkipWorktree is true if the file is not present in the working copy,
+	// as with sparse checkouts.
+	SkipWorktree bool
+	// IntentToAdd is true if the entry was added with `git add -N`.
+	IntentToAdd bool
+}
+
+// Stat is the file system information recorded in an index entry.
+// Git truncates each of these fields to 32 bits.
+type Stat struct {
+	CTime time.Time
+	MTime time.Time
+	Dev   uint32
+	Ino   uint32
+	UID   uint32
+	GID   uint32
+	Size  uint32
+}
+
+var indexSignature = []byte("DIRC")
+
+// Read parses an index file from r.
+func Read(r io.Reader) (*Index, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read git index: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses an index file's contents.
+func Parse(data []byte) (*Index, error) {
+	idx := new(Index)
+	if err := idx.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// UnmarshalBinary decodes the Git index file format into idx.
+func (idx *Index) UnmarshalBinary(data []byte) error {
+	*idx = Index{}
+	if err := idx.unmarshal(data); err != nil {
+		return fmt.Errorf("read git index: %w", err)
+	}
+	return nil
+}
+
+func (idx *Index) unmarshal(data []byte) error {
+	const headerSize = 12
+	if len(data) < headerSize+githash.SHA1Size {
+		return io.ErrUnexpectedEOF
+	}
+	if !bytes.Equal(data[:len(indexSignature)], indexSignature) {
+		return errors.New("invalid signature")
+	}
+	body := data[:len(data)-githash.SHA1Size]
+	copy(idx.Checksum[:], data[len(body):])
+	if idx.Checksum != (githash.SHA1{}) && sha1.Sum(body) != idx.Checksum {
+		return errors.New("checksum does not match")
+	}
+	idx.Version = binary.BigEndian.Uint32(body[4:])
+	if idx.Version < 2 || idx.Version > 4 {
+		return fmt.Errorf("unsupported version %d", idx.Version)
+	}
+	n := binary.BigEndian.Uint32(body[8:])
+
+	p := &entryParser{version: idx.Version}
+	rest := body[headerSize:]
+	// Don't trust the count for preallocation beyond what could fit.
+	if maxEntries := uint32(len(rest) / minEntrySize); n <= maxEntries {
+		idx.Entries = make([]*Entry, 0, int(n))
+	}
+	for i := uint32(0); i < n; i++ {
+		ent, tail, err := p.parse(rest)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+		idx.Entries = append(idx.Entries, ent)
+		rest = tail
+	}
+	return idx.parseExtensions(rest)
+}
+
+const (
+	// statDataSize is the size of the stat data, mode, object ID, and flags
+	// that start every entry.
+	statDataSize = 10*4 + githash.SHA1Size + 2
+	minEntrySize = statDataSize + 1
+
+	flagAssumeValid  = 0x8000
+	flagExtended     = 0x4000
+	flagStageMask    = 0x3000
+	flagStageShift   = 12
+	flagNameMask     = 0x0fff
+	extFlagReserved  = 0x8000
+	extFlagSkipWork  = 0x4000
+	extFlagIntentAdd = 0x2000
+	extFlagUnknown   = 0x1fff
+)
+
+// entryParser holds the state needed to parse consecutive entries.
+type entryParser struct {
+	version  uint32
+	prevPath []byte
+}
+
+func (p *entryParser) parse(data []byte) (_ *Entry, rest []byte, err error) {
+	if len(data) < statDataSize {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	ent := &Entry{
+		Stat: Stat{
+			CTime: unixTime(data[0:], data[4:]),
+			MTime: unixTime(data[8:], data[12:]),
+			Dev:   binary.BigEndian.Uint32(data[16:]),
+			Ino:   binary.BigEndian.Uint32(data[20:]),
+			UID:   binary.BigEndian.Uint32(data[28:]),
+			GID:   binary.BigEndian.Uint32(data[32:]),
+			Size:  binary.BigEndian.Uint32(data[36:]),
+		},
+		Mode: object.Mode(binary.BigEndian.Uint32(data[24:])),
+	}
+	copy(ent.ObjectID[:], data[40:])
+	flags := binary.BigEndian.Uint16(data[40+githash.SHA1Size:])
+	ent.AssumeValid = flags&flagAssumeValid != 0
+	ent.Stage = int(flags&flagStageMask) >> flagStageShift
+	nameLen := int(flags & flagNameMask)
+	pos := statDataSize
+	if flags&flagExtended != 0 {
+		if p.version < 3 {
+			return nil, nil, errors.New("extended flags in version 2 index")
+		}
+		if len(data) < pos+2 {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		extFlags := binary.BigEndian.Uint16(data[pos:])
+		if extFlags&(extFlagReserved|extFlagUnknown) != 0 {
+			return nil, nil, fmt.Errorf("unknown extended flags %#04x", extFlags)
+		}
+		ent.SkipWorktree = extFlags&extFlagSkipWork != 0
+		ent.IntentToAdd = extFlags&extFlagIntentAdd != 0
+		pos += 2
+	}
+
+	if p.version >= 4 {
+		strip, n := readOffsetVarint(data[pos:])
+		if n <= 0 {
+			return nil, nil, errors.New("invalid path prefix length")
+		}
+		pos += n
+		if strip > uint64(len(p.prevPath)) {
+			return nil, nil, errors.New("path prefix length longer than previous path")
+		}
+		end := bytes.IndexByte(data[pos:], 0)
+		if end == -1 {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		path := make([]byte, 0, len(p.prevPath)-int(strip)+end)
+		path = append(path, p.prevPath[:len(p.prevPath)-int(strip)]...)
+		path = append(path, data[pos:pos+end]...)
+		p.prevPath = path
+		ent.Path = string(path)
+		rest = data[pos+end+1:]
+	} else {
+		end := bytes.IndexByte(data[pos:], 0)
+		if end == -1 {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		ent.Path = string(data[pos : pos+end])
+		// Entries are padded with 1-8 NUL bytes to a multiple of 8 bytes.
+		entrySize := (pos + end + 8) &^ 7
+		if len(data) < entrySize {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		rest = data[entrySize:]
+	}
+	if nameLen != flagNameMask && nameLen != len(ent.Path) {
+		return nil, nil, fmt.Errorf("path %q length does not match flags", ent.Path)
+	}
+	return ent, rest, nil
+}
+
+func unixTime(sec, nsec []byte) time.Time {
+	return time.Unix(int64(binary.BigEndian.Uint32(sec)), int64(binary.BigEndian.Uint32(nsec)))
+}
+
+// readOffsetVarint decodes the variable-width integer used in version 4
+// path prefixes. This is the same encoding as packfile OFS_DELTA offsets.
+// It returns the number of bytes read or 0 if the data is truncated.
+func readOffsetVarint(data []byte) (_ uint64, n int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	c := data[0]
+	val := uint64(c & 0x7f)
+	n = 1
+	for c&0x80 != 0 {
+		if n >= len(data) || val >= 1<<56 {
+			return 0, 0
+		}
+		c = data[n]
+		n++
+		val = ((val + 1) << 7) | uint64(c&0x7f)
+	}
+	return val, n
+}
@@ -0,0 +1,384 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package index
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gg-scm.io/pkg/git/githash"
+	"gg-scm.io/pkg/git/object"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+var (
+	aTxtHash   = hashLiteral("78981922613b2afb6025042ff6bd878ac1994e85")
+	bTxtHash   = hashLiteral("61780798228d17af2d34fce4cfbdf35556832472")
+	cShHash    = hashLiteral("1a2485251c33a70432394c93fb89330ef214bfc9")
+	linkHash   = hashLiteral("8d14cbf983b3fad683171c9418998d9f68340823")
+	emptyHash  = hashLiteral("e69de29bb2d1d6434b8b29ae775ad8c2e48c5391")
+	oursHash   = hashLiteral("ba2906d0666cf726c7eaadd2cd3db615dedfdf3a")
+	theirsHash = hashLiteral("a7453f07505c42ea8d6fdda75fa91710c81c53d6")
+
+	rootTreeHash = hashLiteral("f4cc63c226b2a9cf29ee242c47a0111b5889fdc2")
+	dirTreeHash  = hashLiteral("0f96d6c0c0d1708b3fe94a2225dfcd3e08809d06")
+	subTreeHash  = hashLiteral("2dd2e9da4dcb0191f8f9627445fa2d330a3162c6")
+)
+
+func TestRead(t *testing.T) {
+	basicEntries := func() []*Entry {
+		return []*Entry{
+			{Path: "a.txt", ObjectID: aTxtHash, Mode: object.ModePlain, Stat: Stat{Size: 2}},
+			{Path: "dir/b.txt", ObjectID: bTxtHash, Mode: object.ModePlain, Stat: Stat{Size: 2}},
+			{Path: "dir/sub/c.sh", ObjectID: cShHash, Mode: object.ModeExecutable, Stat: Stat{Size: 10}},
+			{Path: "link", ObjectID: linkHash, Mode: object.ModeSymlink, Stat: Stat{Size: 5}},
+		}
+	}
+	basicTree := []*TreeEntry{
+		{Path: "", EntryCount: 4, SubtreeCount: 1, ObjectID: rootTreeHash},
+		{Path: "dir", EntryCount: 2, SubtreeCount: 1, ObjectID: dirTreeHash},
+		{Path: "dir/sub", EntryCount: 1, SubtreeCount: 0, ObjectID: subTreeHash},
+	}
+	invalidRootTree := []*TreeEntry{
+		{Path: "", EntryCount: -1, SubtreeCount: 1},
+		{Path: "dir", EntryCount: 2, SubtreeCount: 1, ObjectID: dirTreeHash},
+		{Path: "dir/sub", EntryCount: 1, SubtreeCount: 0, ObjectID: subTreeHash},
+	}
+
+	tests := []struct {
+		name string
+		want *Index
+	}{
+		{
+			name: "V2",
+			want: &Index{
+				Version: 2,
+				Entries: basicEntries(),
+				Tree:    basicTree,
+			},
+		},
+		{
+			name: "V4",
+			want: &Index{
+				Version: 4,
+				Entries: basicEntries(),
+				Tree:    basicTree,
+			},
+		},
+		{
+			name: "Flags",
+			want: &Index{
+				Version: 3,
+				Entries: func() []*Entry {
+					entries := basicEntries()
+					entries[0].AssumeValid = true
+					entries[1].SkipWorktree = true
+					return append(entries, &Entry{
+						Path:        "new.txt",
+						ObjectID:    emptyHash,
+						Mode:        object.ModePlain,
+						IntentToAdd: true,
+					})
+				}(),
+				Tree: []*TreeEntry{
+					{Path: "", EntryCount: -1, SubtreeCount: 1},
+					{Path: "dir", EntryCount: -1, SubtreeCount: 1},
+					{Path: "dir/sub", EntryCount: 1, SubtreeCount: 0, ObjectID: subTreeHash},
+				},
+			},
+		},
+		{
+			name: "Conflict",
+			want: &Index{
+				Version: 2,
+				Entries: append([]*Entry{
+					{Path: "a.txt", ObjectID: aTxtHash, Mode: object.ModePlain, Stage: 1},
+					{Path: "a.txt", ObjectID: oursHash, Mode: object.ModePlain, Stage: 2},
+					{Path: "a.txt", ObjectID: theirsHash, Mode: object.ModePlain, Stage: 3},
+				}, basicEntries()[1:]...),
+				Tree: invalidRootTree,
+			},
+		},
+		{
+			name: "ResolveUndo",
+			want: &Index{
+				Version: 2,
+				Entries: func() []*Entry {
+					entries := basicEntries()
+					entries[0].ObjectID = hashLiteral("2ab19ae607aabda796309682e0448237aab03047")
+					entries[0].Stat.Size = 9
+					return entries
+				}(),
+				Tree: invalidRootTree,
+				ResolveUndo: []*ResolveUndoEntry{{
+					Path:      "a.txt",
+					Modes:     [3]object.Mode{object.ModePlain, object.ModePlain, object.ModePlain},
+					ObjectIDs: [3]githash.SHA1{aTxtHash, oursHash, theirsHash},
+				}},
+			},
+		},
+		{
+			name: "Split",
+			want: &Index{
+				Version: 2,
+				Entries: func() []*Entry {
+					entries := basicEntries()
+					entries[0].ObjectID = hashLiteral("5ea2ed416fbd4a4cbe227b75fe255dd7fa6bd4d6")
+					entries[0].Stat.Size = 8
+					for _, ent := range entries {
+						ent.Path = ""
+					}
+					return entries
+				}(),
+				Tree: invalidRootTree,
+				Link: &Link{
+					Replace: []int{0, 1, 2, 3},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", test.name+".index"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			got, err := Read(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Checksum == (githash.SHA1{}) {
+				t.Error("Checksum is zero")
+			}
+			if got.Link != nil && got.Link.SharedIndex == (githash.SHA1{}) {
+				t.Error("Link.SharedIndex is zero")
+			}
+			for _, ent := range got.Entries {
+				// Unmerged and intent-to-add entries don't have stat data.
+				if ent.Stage != 0 || ent.IntentToAdd {
+					continue
+				}
+				if ent.Stat.MTime.Unix() == 0 {
+					t.Errorf("%q MTime = %v; want non-zero", ent.Path, ent.Stat.MTime)
+				}
+			}
+			diff := cmp.Diff(test.want, got,
+				cmpopts.EquateEmpty(),
+				cmpopts.IgnoreFields(Index{}, "Checksum"),
+				cmpopts.IgnoreFields(Link{}, "SharedIndex"),
+				cmpopts.IgnoreFields(Stat{}, "CTime", "MTime", "Dev", "Ino", "UID", "GID"),
+			)
+			if diff != "" {
+				t.Errorf("index (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	valid, err := ioutil.ReadFile(filepath.Join("testdata", "V2.index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// withChecksum replaces the trailing checksum of data with a valid one.
+	withChecksum := func(data []byte) []byte {
+		body := data[:len(data)-githash.SHA1Size]
+		sum := sha1.Sum(body)
+		return append(append([]byte(nil), body...), sum[:]...)
+	}
+	modify := func(f func(data []byte) []byte) []byte {
+		return f(append([]byte(nil), valid...))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty", data: nil},
+		{name: "TooShort", data: valid[:20]},
+		{name: "Truncated", data: withChecksum(valid[:100])},
+		{
+			name: "BadChecksum",
+			data: modify(func(data []byte) []byte {
+				data[len(data)-1] ^= 0xff
+				return data
+			}),
+		},
+		{
+			name: "BadSignature",
+			data: modify(func(data []byte) []byte {
+				data[0] = 'X'
+				return withChecksum(data)
+			}),
+		},
+		{
+			name: "BadVersion",
+			data: modify(func(data []byte) []byte {
+				binary.BigEndian.PutUint32(data[4:], 5)
+				return withChecksum(data)
+			}),
+		},
+		{
+			name: "TooManyEntries",
+			data: modify(func(data []byte) []byte {
+				binary.BigEndian.PutUint32(data[8:], 1000)
+				return withChecksum(data)
+			}),
+		},
+		{
+			name: "UnknownRequiredExtension",
+			data: modify(func(data []byte) []byte {
+				body := data[:len(data)-githash.SHA1Size]
+				body = append(body, "abcd\x00\x00\x00\x00"...)
+				return withChecksum(append(body, make([]byte, githash.SHA1Size)...))
+			}),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(test.data)); err == nil {
+				t.Error("Read did not return an error")
+			}
+		})
+	}
+
+	t.Run("UnknownOptionalExtension", func(t *testing.T) {
+		data := modify(func(data []byte) []byte {
+			body := data[:len(data)-githash.SHA1Size]
+			body = append(body, "ABCD\x00\x00\x00\x01x"...)
+			return withChecksum(append(body, make([]byte, githash.SHA1Size)...))
+		})
+		if _, err := Read(bytes.NewReader(data)); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("SkipHash", func(t *testing.T) {
+		data := modify(func(data []byte) []byte {
+			copy(data[len(data)-githash.SHA1Size:], make([]byte, githash.SHA1Size))
+			return data
+		})
+		idx, err := Read(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if idx.Checksum != (githash.SHA1{}) {
+			t.Errorf("Checksum = %v; want zero", idx.Checksum)
+		}
+	})
+}
+
+func TestReadOffsetVarint(t *testing.T) {
+	tests := []struct {
+		data  []byte
+		want  uint64
+		wantN int
+	}{
+		{data: nil, want: 0, wantN: 0},
+		{data: []byte{0x00}, want: 0, wantN: 1},
+		{data: []byte{0x05, 'x'}, want: 5, wantN: 1},
+		{data: []byte{0x7f}, want: 127, wantN: 1},
+		{data: []byte{0x80, 0x00}, want: 128, wantN: 2},
+		{data: []byte{0x80, 0x7f}, want: 255, wantN: 2},
+		{data: []byte{0x81, 0x00}, want: 256, wantN: 2},
+		{data: []byte{0x80}, want: 0, wantN: 0},
+	}
+	for _, test := range tests {
+		got, n := readOffsetVarint(test.data)
+		if got != test.want || n != test.wantN {
+			t.Errorf("readOffsetVarint(%#v) = %d, %d; want %d, %d", test.data, got, n, test.want, test.wantN)
+		}
+	}
+}
+
+func TestParseEWAH(t *testing.T) {
+	word := func(w uint64) []byte {
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], w)
+		return buf[:]
+	}
+	bitmap := func(bitSize uint32, words ...[]byte) []byte {
+		var buf []byte
+		buf = append(buf, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(buf, bitSize)
+		binary.BigEndian.PutUint32(buf[4:], uint32(len(words)))
+		for _, w := range words {
+			buf = append(buf, w...)
+		}
+		return append(buf, 0, 0, 0, 0)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want []int
+	}{
+		{
+			name: "Empty",
+			data: bitmap(0),
+			want: nil,
+		},
+		{
+			name: "Literal",
+			data: bitmap(4, word(1<<33), word(0xf)),
+			want: []int{0, 1, 2, 3},
+		},
+		{
+			name: "RunThenLiteral",
+			data: bitmap(130, word(1<<33|1<<1|1), word(0x5)),
+			want: func() []int {
+				var want []int
+				for i := 0; i < 64; i++ {
+					want = append(want, i)
+				}
+				return append(want, 64, 66)
+			}(),
+		},
+		{
+			name: "ZeroRun",
+			data: bitmap(200, word(1<<33|2<<1), word(1<<3)),
+			want: []int{131},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, rest, err := parseEWAH(append(test.data, "rest"...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("positions (-want +got):\n%s", diff)
+			}
+			if string(rest) != "rest" {
+				t.Errorf("rest = %q; want \"rest\"", rest)
+			}
+		})
+	}
+}
+
+func hashLiteral(s string) githash.SHA1 {
+	h, err := githash.ParseSHA1(s)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
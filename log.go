@@ -26,6 +26,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"gg-scm.io/pkg/git/object"
 )
@@ -87,6 +88,100 @@ type LogOptions struct {
 	// If NoWalk is true, then ancestor commits are not traversed. Does not have
 	// an effect if Revs contains a range.
 	NoWalk bool
+
+	// If Pathspecs is not empty, then only commits that modify paths
+	// matching the pathspecs are listed. Simplification specifies how
+	// history is simplified when filtering by path.
+	Pathspecs      []Pathspec
+	Simplification HistorySimplification
+
+	// If Author or Committer is not empty, then only commits whose
+	// author or committer (respectively) matches the regular expression
+	// are listed.
+	Author    string
+	Committer string
+
+	// If Since is not zero, then only commits more recent than Since are
+	// listed. If Until is not zero, then only commits older than Until are
+	// listed. Both are compared against the commit time.
+	Since time.Time
+	Until time.Time
+
+	// If Grep is not empty, then only commits whose message matches at
+	// least one of the regular expressions are listed. If GrepAllMatch is
+	// true, then the message must match all of the regular expressions.
+	// If InvertGrep is true, then only commits whose message does not
+	// match are listed.
+	Grep         []string
+	GrepAllMatch bool
+	InvertGrep   bool
+
+	// If Pickaxe is not empty, then only commits that change the number
+	// of occurrences of the string in a file are listed, like `git log -S`.
+	// If PickaxeRegexp is true, then Pickaxe is treated as a regular
+	// expression.
+	Pickaxe       string
+	PickaxeRegexp bool
+	// If DiffGrep is not empty, then only commits whose diff has an added
+	// or removed line that matches the regular expression are listed,
+	// like `git log -G`. DiffGrep cannot be used with Pickaxe.
+	DiffGrep string
+
+	// If TopoOrder is true, then no parents are shown before all of their
+	// children, and commits on different lines of history are not
+	// intermixed. If DateOrder is true, then no parents are shown before
+	// all of their children, but otherwise commits are shown in commit
+	// time order. At most one of TopoOrder and DateOrder may be set.
+	TopoOrder bool
+	DateOrder bool
+
+	// If Merges is true, then only merge commits are listed.
+	// If NoMerges is true, then merge commits are not listed.
+	Merges   bool
+	NoMerges bool
+
+	// If NotesRef is not empty, then Log reads the note attached to each
+	// commit in the given notes ref (e.g. "refs/notes/commits").
+	// The note is available from *Log.Note.
+	NotesRef Ref
+
+	// If Stats is true, then Log reads the files changed by each commit
+	// relative to its parent along with the number of lines added and
+	// removed, available from *Log.Stats. Merge commits do not have any
+	// changes listed, even if FirstParent is true.
+	Stats bool
+}
+
+// HistorySimplification specifies how Log simplifies history when
+// filtering commits by path.
+type HistorySimplification int
+
+// History simplification modes.
+// See https://git-scm.com/docs/git-log#_history_simplification for details.
+const (
+	// SimplifyDefault follows only one parent of a merge commit if the
+	// merge did not change the paths relative to that parent.
+	SimplifyDefault HistorySimplification = iota
+	// SimplifyFullHistory does not prune any side of history, listing
+	// every commit that modifies the paths.
+	SimplifyFullHistory
+	// SimplifyMerges is like SimplifyFullHistory, but also removes merge
+	// commits that do not contribute a change to the paths.
+	SimplifyMerges
+)
+
+// String returns the Go constant name of the mode.
+func (mode HistorySimplification) String() string {
+	switch mode {
+	case SimplifyDefault:
+		return "SimplifyDefault"
+	case SimplifyFullHistory:
+		return "SimplifyFullHistory"
+	case SimplifyMerges:
+		return "SimplifyMerges"
+	default:
+		return fmt.Sprintf("HistorySimplification(%d)", int(mode))
+	}
 }
 
 const logErrPrefix = "git rev-list | git cat-file --batch"
@@ -102,6 +197,26 @@ func (g *Git) Log(ctx context.Context, opts LogOptions) (_ *Log, err error) {
 		}
 	}
 	args := []string{"rev-list"}
+	if opts.Stats {
+		// Stats are read from log's output, so Log requests each commit
+		// from cat-file as the commit is read.
+		args = logArgs(
+			"-z",
+			"--format="+logCommitPrefix+"%H",
+			"--raw",
+			"--numstat",
+			"--no-abbrev",
+		)
+		if version, err := g.getVersion(ctx); err == nil && versionAtLeast(version, 2, 31) {
+			// FirstParent implies --diff-merges=first-parent since Git 2.31.
+			args = append(args, "--diff-merges=off")
+		}
+	} else if opts.Pickaxe != "" || opts.DiffGrep != "" {
+		// rev-list does not compute diffs, so pickaxe options are only
+		// available through log. The format and configuration make its
+		// output the same as rev-list's.
+		args = logArgs("--format=%H")
+	}
 	if opts.MaxParents > 0 || opts.AllowZeroMaxParents {
 		args = append(args, fmt.Sprintf("--max-parents=%d", opts.MaxParents))
 	}
@@ -117,12 +232,28 @@ func (g *Git) Log(ctx context.Context, opts LogOptions) (_ *Log, err error) {
 	if opts.NoWalk {
 		args = append(args, "--no-walk=sorted")
 	}
+	filterArgs, err := opts.filterArgs()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", logErrPrefix, err)
+	}
+	args = append(args, filterArgs...)
 	if len(opts.Revs) == 0 {
 		args = append(args, Head.String())
 	} else {
 		args = append(args, opts.Revs...)
 	}
 	args = append(args, "--")
+	for _, p := range opts.Pathspecs {
+		args = append(args, p.String())
+	}
+
+	var notes map[Hash]Hash
+	if opts.NotesRef != "" {
+		notes, err = g.readNotesMap(ctx, opts.NotesRef)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", logErrPrefix, err)
+		}
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	stderr := new(bytes.Buffer)
@@ -138,6 +269,27 @@ func (g *Git) Log(ctx context.Context, opts LogOptions) (_ *Log, err error) {
 		cancel()
 		return nil, fmt.Errorf("%s: %w", logErrPrefix, err)
 	}
+	if opts.Stats {
+		l := &Log{
+			tokens: &nulTokenReader{r: bufio.NewReader(revListPipe)},
+			stderr: stderr,
+			cancel: cancel,
+			closers: [...]io.Closer{
+				pipeStreamCloser{revListPipe, revListStderr},
+				nil,
+				nil,
+			},
+			ctx:   ctx,
+			notes: notes,
+		}
+		l.objects, err = g.OpenObjectReader(ctx)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("%s: %w", logErrPrefix, err)
+		}
+		l.closers[1] = l.objects
+		return l, nil
+	}
 
 	catFileStderr := stderrMux.newHandle()
 	catFilePipe, err := StartPipe(ctx, g.runner, &Invocation{
@@ -152,7 +304,7 @@ func (g *Git) Log(ctx context.Context, opts LogOptions) (_ *Log, err error) {
 		return nil, fmt.Errorf("%s: %w", logErrPrefix, err)
 	}
 
-	return &Log{
+	l := &Log{
 		r:      bufio.NewReaderSize(catFilePipe, 1<<20 /* 1 MiB */),
 		stderr: stderr,
 		cancel: cancel,
@@ -160,8 +312,128 @@ func (g *Git) Log(ctx context.Context, opts LogOptions) (_ *Log, err error) {
 		closers: [...]io.Closer{
 			pipeStreamCloser{catFilePipe, catFileStderr},
 			pipeStreamCloser{revListPipe, revListStderr},
+			nil,
 		},
-	}, nil
+	}
+	if len(notes) > 0 {
+		l.ctx = ctx
+		l.notes = notes
+		l.objects, err = g.OpenObjectReader(ctx)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("%s: %w", logErrPrefix, err)
+		}
+		l.closers[2] = l.objects
+	}
+	return l, nil
+}
+
+// filterArgs returns the `git rev-list` arguments for the commit filters
+// and ordering in opts.
+func (opts *LogOptions) filterArgs() ([]string, error) {
+	var args []string
+	switch opts.Simplification {
+	case SimplifyDefault:
+	case SimplifyFullHistory:
+		args = append(args, "--full-history")
+	case SimplifyMerges:
+		args = append(args, "--full-history", "--simplify-merges")
+	default:
+		return nil, fmt.Errorf("unknown history simplification %v", opts.Simplification)
+	}
+	if opts.Author != "" {
+		args = append(args, "--author="+opts.Author)
+	}
+	if opts.Committer != "" {
+		args = append(args, "--committer="+opts.Committer)
+	}
+	if !opts.Since.IsZero() {
+		args = append(args, fmt.Sprintf("--max-age=%d", opts.Since.Unix()))
+	}
+	if !opts.Until.IsZero() {
+		args = append(args, fmt.Sprintf("--min-age=%d", opts.Until.Unix()))
+	}
+	for _, pattern := range opts.Grep {
+		args = append(args, "--grep="+pattern)
+	}
+	if opts.GrepAllMatch {
+		args = append(args, "--all-match")
+	}
+	if opts.InvertGrep {
+		args = append(args, "--invert-grep")
+	}
+	if opts.Pickaxe != "" && opts.DiffGrep != "" {
+		return nil, errors.New("cannot use both pickaxe and diff grep")
+	}
+	if opts.Pickaxe != "" {
+		args = append(args, "-S"+opts.Pickaxe)
+		if opts.PickaxeRegexp {
+			args = append(args, "--pickaxe-regex")
+		}
+	}
+	if opts.DiffGrep != "" {
+		args = append(args, "-G"+opts.DiffGrep)
+	}
+	if opts.TopoOrder && opts.DateOrder {
+		return nil, errors.New("cannot use both topological and date order")
+	}
+	if opts.TopoOrder {
+		args = append(args, "--topo-order")
+	}
+	if opts.DateOrder {
+		args = append(args, "--date-order")
+	}
+	if opts.Merges && opts.NoMerges {
+		return nil, errors.New("cannot list only merges and no merges")
+	}
+	if opts.Merges {
+		args = append(args, "--merges")
+	}
+	if opts.NoMerges {
+		args = append(args, "--no-merges")
+	}
+	return args, nil
+}
+
+// logCommitPrefix starts the line for each commit in `git log` output
+// that is read directly.
+const logCommitPrefix = "commit "
+
+// logConfig overrides the configuration settings that change the output
+// of `git log`. Unlike rev-list, log is a porcelain command that reads
+// the user's configuration.
+var logConfig = []string{
+	"-c", "log.showSignature=false",
+	"-c", "log.showRoot=true",
+	"-c", "log.follow=false",
+	"-c", "log.date=default",
+	"-c", "log.mailmap=false",
+	"-c", "diff.renames=true",
+	"-c", "diff.relative=false",
+}
+
+// logArgs returns the arguments to run `git log` with the given arguments
+// and the configuration in logConfig.
+func logArgs(args ...string) []string {
+	cmd := make([]string, 0, len(logConfig)+2+len(args))
+	cmd = append(cmd, logConfig...)
+	cmd = append(cmd, "log", "--no-color")
+	return append(cmd, args...)
+}
+
+// A FileStat describes the change to a single file in a commit.
+type FileStat struct {
+	// DiffStatusEntry describes the kind of change. Name is the path of
+	// the file after the change. If the file was renamed or copied,
+	// then From is the path of the file before the change.
+	DiffStatusEntry
+
+	// Added and Removed are the number of lines added and removed.
+	// They are zero for binary files.
+	Added   int
+	Removed int
+	// Binary is true if the file's content is binary.
+	Binary bool
 }
 
 // Log is an open handle to a `git cat-file --batch` subprocess. Closing the Log
@@ -171,11 +443,22 @@ type Log struct {
 	stderr  *bytes.Buffer
 	hash    hash.Hash
 	cancel  context.CancelFunc
-	closers [2]io.Closer
+	closers [3]io.Closer
+
+	// tokens is used instead of r if LogOptions.Stats is set.
+	// Commits are then read through objects.
+	tokens *nulTokenReader
+
+	// Notes are only read if LogOptions.NotesRef is set.
+	ctx     context.Context
+	notes   map[Hash]Hash
+	objects *ObjectReader
 
 	scanErr  error
 	scanDone bool
 	info     *object.Commit
+	note     string
+	stats    []*FileStat
 }
 
 // Next attempts to scan the next log entry and returns whether there is a new entry.
@@ -192,6 +475,8 @@ func (l *Log) Next() bool {
 		}
 		l.scanDone = true
 		l.info = nil
+		l.note = ""
+		l.stats = nil
 		l.cancel()
 		return false
 	}
@@ -199,6 +484,10 @@ func (l *Log) Next() bool {
 }
 
 func (l *Log) next() error {
+	if l.tokens != nil {
+		return l.nextWithStats()
+	}
+
 	// Read object information.
 	// Reference: https://git-scm.com/docs/git-cat-file#_batch_output
 	line, err := l.r.ReadSlice('\n')
@@ -258,6 +547,149 @@ func (l *Log) next() error {
 		return fmt.Errorf("commit %v: %w", expectSum, err)
 	}
 	l.info = info
+	return l.readNote(expectSum)
+}
+
+// nextWithStats reads the next commit from `git log --raw --numstat`
+// output and then reads the commit object.
+func (l *Log) nextWithStats() error {
+	header, err := l.tokens.next()
+	if errors.Is(err, io.EOF) {
+		// Reached successful end. Wait for subprocesses to exit.
+		if err := l.close(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+	header = strings.TrimPrefix(header, "\n")
+	if !strings.HasPrefix(header, logCommitPrefix) {
+		return fmt.Errorf("expected commit, got %q", header)
+	}
+	id, err := ParseHash(header[len(logCommitPrefix):])
+	if err != nil {
+		return err
+	}
+	l.stats, err = readLogStats(l.tokens)
+	if err != nil {
+		return fmt.Errorf("commit %v: %w", id, err)
+	}
+	l.info, err = l.objects.Commit(l.ctx, id.String())
+	if err != nil {
+		return fmt.Errorf("commit %v: %w", id, err)
+	}
+	return l.readNote(id)
+}
+
+// readLogStats reads the `--raw` and `--numstat` output for a single commit.
+// Git writes all of the raw entries and then the numstat entries
+// for the same files in the same order.
+func readLogStats(tokens *nulTokenReader) ([]*FileStat, error) {
+	var stats []*FileStat
+	numstatCount := 0
+	for {
+		tok, err := tokens.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Git separates the commit line from the diff with a newline.
+		tok = strings.TrimPrefix(tok, "\n")
+		if tok == "" {
+			continue
+		}
+		if strings.HasPrefix(tok, logCommitPrefix) {
+			tokens.unread(tok)
+			break
+		}
+
+		if tok[0] == ':' {
+			// Raw entry: ":<old mode> <new mode> <old ID> <new ID> <status>"
+			// followed by one or two paths.
+			status := tok[strings.LastIndexByte(tok, ' ')+1:]
+			names, err := readStatNames(tokens, DiffStatusCode(status[0]))
+			if err != nil {
+				return nil, err
+			}
+			ent, _, err := readDiffStatusEntry(status + "\x00" + strings.Join(names, "\x00") + "\x00")
+			if err != nil {
+				return nil, err
+			}
+			stats = append(stats, &FileStat{DiffStatusEntry: ent})
+			continue
+		}
+
+		// Numstat entry: "<added>\t<removed>\t<path>". For renames and
+		// copies, the path is empty and followed by the two paths.
+		parts := strings.SplitN(tok, "\t", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid numstat entry %q", tok)
+		}
+		if parts[2] == "" {
+			if _, err := readStatNames(tokens, DiffStatusRenamed); err != nil {
+				return nil, err
+			}
+		}
+		if numstatCount >= len(stats) {
+			return nil, fmt.Errorf("numstat entry %q does not have a matching raw entry", tok)
+		}
+		st := stats[numstatCount]
+		numstatCount++
+		if parts[0] == "-" && parts[1] == "-" {
+			st.Binary = true
+			continue
+		}
+		st.Added, err = strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid numstat entry %q", tok)
+		}
+		st.Removed, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid numstat entry %q", tok)
+		}
+	}
+	if numstatCount != len(stats) {
+		return nil, fmt.Errorf("%d raw entries but %d numstat entries", len(stats), numstatCount)
+	}
+	return stats, nil
+}
+
+// readStatNames reads the paths that follow a diff entry with the given code.
+func readStatNames(tokens *nulTokenReader, code DiffStatusCode) ([]string, error) {
+	n := 1
+	if code == DiffStatusRenamed || code == DiffStatusCopied {
+		n = 2
+	}
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		name, err := tokens.next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// readNote reads the note for the given commit, if any.
+func (l *Log) readNote(id Hash) error {
+	l.note = ""
+	blob, ok := l.notes[id]
+	if !ok {
+		return nil
+	}
+	_, data, err := l.objects.readAll(l.ctx, blob.String(), object.TypeBlob)
+	if err != nil {
+		return fmt.Errorf("commit %v: note: %w", id, err)
+	}
+	l.note = string(data)
 	return nil
 }
 
@@ -267,6 +699,19 @@ func (l *Log) CommitInfo() *object.Commit {
 	return l.info
 }
 
+// Stats returns the files changed by the most recently scanned log entry.
+// Stats are only read if LogOptions.Stats was set.
+func (l *Log) Stats() []*FileStat {
+	return l.stats
+}
+
+// Note returns the note attached to the most recently scanned log entry
+// or an empty string if the commit does not have a note. Notes are only
+// read if LogOptions.NotesRef was set.
+func (l *Log) Note() string {
+	return l.note
+}
+
 // Close ends the log subprocess and waits for it to finish.
 // Close returns an error if Next returned false due to a parse failure.
 func (l *Log) Close() error {
@@ -293,6 +738,35 @@ func (l *Log) close() error {
 	return nil
 }
 
+// A nulTokenReader reads NUL-terminated tokens from `git log -z` output.
+type nulTokenReader struct {
+	r *bufio.Reader
+	// pending is a token that has been read but not consumed.
+	pending string
+}
+
+// next reads the next token without its NUL terminator.
+func (tr *nulTokenReader) next() (string, error) {
+	if tr.pending != "" {
+		tok := tr.pending
+		tr.pending = ""
+		return tok, nil
+	}
+	tok, err := tr.r.ReadString(0)
+	if err != nil {
+		if errors.Is(err, io.EOF) && tok != "" {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return tok[:len(tok)-1], nil
+}
+
+// unread causes the next call to next to return tok.
+func (tr *nulTokenReader) unread(tok string) {
+	tr.pending = tok
+}
+
 // A muxWriter synchronizes access to a writer through a number of handles.
 type muxWriter struct {
 	mu sync.Mutex
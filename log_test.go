@@ -677,12 +677,344 @@ func TestLog_NoWalk(t *testing.T) {
 	}
 }
 
+func TestLog_Filters(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	// Create a repository with a merge commit:
+	//
+	//   * merge side
+	//   |\
+	//   | * change foo on side
+	//   * | edit bar
+	//   |/
+	//   * add bar
+	//   * add foo
+	const (
+		alice object.User = "Alice <alice@example.com>"
+		bob   object.User = "Bob <bob@example.com>"
+	)
+	baseTime := time.Date(2018, time.February, 20, 15, 47, 42, 0, time.FixedZone("UTC-8", -8*60*60))
+	commitOpts := func(user object.User, days int) CommitOptions {
+		t := baseTime.Add(time.Duration(days) * 24 * time.Hour)
+		return CommitOptions{
+			Author:     user,
+			AuthorTime: t,
+			Committer:  user,
+			CommitTime: t,
+		}
+	}
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "symbolic-ref", "HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "apple\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "add foo", commitOpts(alice, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("bar.txt", "banana\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"bar.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "add bar\n\nFixes a bug.", commitOpts(bob, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.NewBranch(ctx, "side", BranchOptions{Checkout: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "apple\ncherry\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CommitAll(ctx, "change foo on side", commitOpts(alice, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CheckoutBranch(ctx, "main", CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("bar.txt", "banana\ndate\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CommitAll(ctx, "edit bar", commitOpts(bob, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Merge(ctx, []string{"side"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "merge side", commitOpts(alice, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    LogOptions
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "Default",
+			want: []string{"merge side", "edit bar", "change foo on side", "add bar\n\nFixes a bug.", "add foo"},
+		},
+		{
+			name: "Pathspecs",
+			opts: LogOptions{Pathspecs: []Pathspec{"foo.txt"}},
+			want: []string{"change foo on side", "add foo"},
+		},
+		{
+			name: "FullHistory",
+			opts: LogOptions{Pathspecs: []Pathspec{"foo.txt"}, Simplification: SimplifyFullHistory},
+			want: []string{"merge side", "change foo on side", "add foo"},
+		},
+		{
+			name: "SimplifyMerges",
+			opts: LogOptions{Pathspecs: []Pathspec{"foo.txt"}, Simplification: SimplifyMerges},
+			want: []string{"change foo on side", "add foo"},
+		},
+		{
+			name: "Author",
+			opts: LogOptions{Author: "^Alice"},
+			want: []string{"merge side", "change foo on side", "add foo"},
+		},
+		{
+			name: "Committer",
+			opts: LogOptions{Committer: "bob@example"},
+			want: []string{"edit bar", "add bar\n\nFixes a bug."},
+		},
+		{
+			name: "Since",
+			opts: LogOptions{Since: baseTime.Add(36 * time.Hour)},
+			want: []string{"merge side", "edit bar", "change foo on side"},
+		},
+		{
+			name: "Until",
+			opts: LogOptions{Until: baseTime.Add(36 * time.Hour)},
+			want: []string{"add bar\n\nFixes a bug.", "add foo"},
+		},
+		{
+			name: "Grep",
+			opts: LogOptions{Grep: []string{"bar", "bug"}},
+			want: []string{"edit bar", "add bar\n\nFixes a bug."},
+		},
+		{
+			name: "GrepAllMatch",
+			opts: LogOptions{Grep: []string{"bar", "bug"}, GrepAllMatch: true},
+			want: []string{"add bar\n\nFixes a bug."},
+		},
+		{
+			name: "InvertGrep",
+			opts: LogOptions{Grep: []string{"add"}, InvertGrep: true},
+			want: []string{"merge side", "edit bar", "change foo on side"},
+		},
+		{
+			name: "Pickaxe",
+			opts: LogOptions{Pickaxe: "cherry"},
+			want: []string{"change foo on side"},
+		},
+		{
+			name: "PickaxeRegexp",
+			opts: LogOptions{Pickaxe: "ch.rry|d.te", PickaxeRegexp: true},
+			want: []string{"edit bar", "change foo on side"},
+		},
+		{
+			name: "DiffGrep",
+			opts: LogOptions{DiffGrep: "^ban"},
+			want: []string{"add bar\n\nFixes a bug."},
+		},
+		{
+			name: "TopoOrder",
+			opts: LogOptions{TopoOrder: true},
+			want: []string{"merge side", "change foo on side", "edit bar", "add bar\n\nFixes a bug.", "add foo"},
+		},
+		{
+			name: "DateOrder",
+			opts: LogOptions{DateOrder: true},
+			want: []string{"merge side", "edit bar", "change foo on side", "add bar\n\nFixes a bug.", "add foo"},
+		},
+		{
+			name: "Merges",
+			opts: LogOptions{Merges: true},
+			want: []string{"merge side"},
+		},
+		{
+			name: "NoMerges",
+			opts: LogOptions{NoMerges: true, Limit: 2},
+			want: []string{"edit bar", "change foo on side"},
+		},
+		{
+			name:    "PickaxeAndDiffGrep",
+			opts:    LogOptions{Pickaxe: "cherry", DiffGrep: "cherry"},
+			wantErr: true,
+		},
+		{
+			name:    "TopoAndDateOrder",
+			opts:    LogOptions{TopoOrder: true, DateOrder: true},
+			wantErr: true,
+		},
+		{
+			name:    "MergesAndNoMerges",
+			opts:    LogOptions{Merges: true, NoMerges: true},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log, err := env.g.Log(ctx, test.opts)
+			if err != nil {
+				if !test.wantErr {
+					t.Fatal("Log:", err)
+				}
+				return
+			}
+			if test.wantErr {
+				log.Close()
+				t.Fatal("Log did not return an error")
+			}
+			var got []string
+			for log.Next() {
+				got = append(got, log.CommitInfo().Message)
+			}
+			if err := log.Close(); err != nil {
+				t.Error("Close:", err)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("messages (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func equateTruncatedTime(d time.Duration) cmp.Option {
 	return cmp.Comparer(func(t1, t2 time.Time) bool {
 		return t1.Truncate(d).Equal(t2.Truncate(d))
 	})
 }
 
+func TestLog_Stats(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	const content = "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\n"
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	err = env.root.Apply(
+		filesystem.Write("foo.txt", content),
+		filesystem.Write("bar.txt", "a\nb\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt", "bar.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err = env.root.Apply(
+		filesystem.Rename("foo.txt", "renamed.txt"),
+		filesystem.Write("bar.txt", "a\nc\nd\n"),
+		filesystem.Write("data.bin", "\x00\x01\x02"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt", "renamed.txt", "bar.txt", "data.bin"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "second", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := env.g.Log(ctx, LogOptions{Stats: true})
+	if err != nil {
+		t.Fatal("Log:", err)
+	}
+	got := make(map[string][]*FileStat)
+	for log.Next() {
+		info := log.CommitInfo()
+		if info == nil {
+			t.Fatal("CommitInfo() = <nil>")
+		}
+		got[info.Message] = log.Stats()
+	}
+	if err := log.Close(); err != nil {
+		t.Error("Log:", err)
+	}
+	want := map[string][]*FileStat{
+		"first": {
+			{DiffStatusEntry: DiffStatusEntry{Code: DiffStatusAdded, Name: "bar.txt"}, Added: 2},
+			{DiffStatusEntry: DiffStatusEntry{Code: DiffStatusAdded, Name: "foo.txt"}, Added: 8},
+		},
+		"second": {
+			{DiffStatusEntry: DiffStatusEntry{Code: DiffStatusModified, Name: "bar.txt"}, Added: 2, Removed: 1},
+			{DiffStatusEntry: DiffStatusEntry{Code: DiffStatusAdded, Name: "data.bin"}, Binary: true},
+			{DiffStatusEntry: DiffStatusEntry{Code: DiffStatusRenamed, Name: "renamed.txt", From: "foo.txt", Similarity: 100}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Log(ctx, {Stats: true}) stats (-want +got):\n%s", diff)
+	}
+
+	// Merge commits do not have any changes listed, even with FirstParent.
+	if err := env.g.Run(ctx, "checkout", "--quiet", "-b", "side", "HEAD~"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("side.txt", "side\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"side.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "side", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "checkout", "--quiet", "-"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Merge(ctx, []string{"side"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "merge", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	log, err = env.g.Log(ctx, LogOptions{Stats: true, FirstParent: true, Limit: 1})
+	if err != nil {
+		t.Fatal("Log:", err)
+	}
+	for log.Next() {
+		if stats := log.Stats(); len(stats) > 0 {
+			t.Errorf("Log(ctx, {Stats: true, FirstParent: true}) merge stats = %+v; want none", stats)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Error("Log:", err)
+	}
+}
+
 func TestMuxWriter(t *testing.T) {
 	tests := []struct {
 		name      string
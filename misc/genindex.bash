@@ -0,0 +1,88 @@
+#!/bin/bash
+# Copyright 2021 The gg Authors
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     https://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# SPDX-License-Identifier: Apache-2.0
+
+set -euo pipefail
+# genindex.bash regenerates the index files in index/testdata.
+# Run it from the root of the repository.
+
+readonly dst="$PWD/index/testdata"
+workdir="$(mktemp -d)"
+trap 'rm -rf "$workdir"' EXIT
+cd "$workdir"
+
+export GIT_AUTHOR_NAME='Octo Cat'
+export GIT_AUTHOR_EMAIL='octocat@example.com'
+export GIT_AUTHOR_DATE='2021-01-01T00:00:00Z'
+export GIT_COMMITTER_NAME="$GIT_AUTHOR_NAME"
+export GIT_COMMITTER_EMAIL="$GIT_AUTHOR_EMAIL"
+export GIT_COMMITTER_DATE="$GIT_AUTHOR_DATE"
+
+new_repo() {
+  rm -rf repo
+  git init --quiet repo
+  cd repo
+  printf 'a\n' > a.txt
+  mkdir -p dir/sub
+  printf 'b\n' > dir/b.txt
+  printf '#!/bin/sh\n' > dir/sub/c.sh
+  chmod +x dir/sub/c.sh
+  ln -s a.txt link
+  git add a.txt dir link
+  git write-tree > /dev/null
+}
+
+# Basic index in each version. Version 3 is only written when entries
+# have extended flags, so it is covered by the flags test below.
+for version in 2 4; do
+  new_repo
+  git update-index --index-version "$version"
+  cp .git/index "$dst/V${version}.index"
+  cd ..
+done
+
+# Flags: assume-valid, skip-worktree, and intent-to-add.
+new_repo
+git update-index --assume-unchanged a.txt
+git update-index --skip-worktree dir/b.txt
+printf 'new\n' > new.txt
+git add --intent-to-add new.txt
+cp .git/index "$dst/Flags.index"
+cd ..
+
+# Unmerged entries, then resolve-undo information after resolving.
+new_repo
+git commit --quiet -m 'First commit'
+git checkout --quiet -b feature
+printf 'feature\n' > a.txt
+git commit --quiet -a -m 'Feature'
+git checkout --quiet -
+printf 'main\n' > a.txt
+git commit --quiet -a -m 'Main'
+git merge --quiet feature > /dev/null || true
+cp .git/index "$dst/Conflict.index"
+printf 'resolved\n' > a.txt
+git add a.txt
+cp .git/index "$dst/ResolveUndo.index"
+cd ..
+
+# Split index.
+new_repo
+git update-index --split-index
+printf 'changed\n' > a.txt
+git add a.txt
+cp .git/index "$dst/Split.index"
+cd ..
@@ -15,10 +15,13 @@
 package git
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -130,6 +133,466 @@ func (g *Git) ListRemoteRefs(ctx context.Context, remote string) (map[Ref]Hash,
 	return refs, nil
 }
 
+// FetchOptions specifies the command-line options for `git fetch`.
+type FetchOptions struct {
+	// Refspecs is the set of refspecs to fetch. If empty, the remote's
+	// configured refspecs are used.
+	Refspecs []FetchRefspec
+
+	// Progress receives the stderr of the `git fetch` subprocess if not nil.
+	Progress io.Writer
+
+	// If Prune is true, local remote-tracking refs that no longer exist on
+	// the remote are deleted.
+	Prune bool
+	// If Depth is greater than zero, it limits the history fetched to the
+	// given number of commits from the tip of each remote branch.
+	// It is mutually exclusive with Deepen.
+	Depth int
+	// If Deepen is greater than zero, it extends the history of a shallow
+	// repository by the given number of commits.
+	// It is mutually exclusive with Depth.
+	Deepen int
+	// Tags controls which tags are fetched.
+	Tags FetchTags
+}
+
+// FetchTags specifies which tags a fetch downloads.
+type FetchTags int
+
+// Tag fetching modes.
+const (
+	// FetchTagsDefault fetches tags that point into the fetched history,
+	// unless the remote's configuration says otherwise.
+	FetchTagsDefault FetchTags = iota
+	// FetchAllTags fetches all tags from the remote.
+	FetchAllTags
+	// FetchNoTags does not fetch any tags beyond those named in refspecs.
+	FetchNoTags
+)
+
+// RefUpdate describes a change to a single ref made by a fetch or push.
+type RefUpdate struct {
+	// Ref is the ref that was updated: the local ref for a fetch or the
+	// remote ref for a push.
+	Ref Ref
+	// Src is the local source of a push, as given in the refspec. It is empty
+	// for fetches and for push deletions.
+	Src string
+
+	// OldHash is the value of Ref before the update. It is the zero hash if
+	// Ref did not exist or if Git did not report the value.
+	OldHash Hash
+	// NewHash is the value of Ref after the update. It is the zero hash if
+	// Ref was deleted or if Git did not report the value.
+	NewHash Hash
+
+	Status RefUpdateStatus
+	// Reason is Git's explanation for the status, like "non-fast-forward".
+	// It is usually only present for rejected updates.
+	Reason string
+}
+
+// RefUpdateStatus is a single-character flag from the `--porcelain` output
+// of `git fetch` and `git push`.
+type RefUpdateStatus byte
+
+// Ref update statuses.
+const (
+	RefFastForward  RefUpdateStatus = ' '
+	RefForcedUpdate RefUpdateStatus = '+'
+	RefDeleted      RefUpdateStatus = '-'
+	RefTagUpdate    RefUpdateStatus = 't'
+	RefNew          RefUpdateStatus = '*'
+	RefRejected     RefUpdateStatus = '!'
+	RefUpToDate     RefUpdateStatus = '='
+)
+
+func (status RefUpdateStatus) isValid() bool {
+	return status == RefFastForward ||
+		status == RefForcedUpdate ||
+		status == RefDeleted ||
+		status == RefTagUpdate ||
+		status == RefNew ||
+		status == RefRejected ||
+		status == RefUpToDate
+}
+
+// String returns the status flag as a string.
+func (status RefUpdateStatus) String() string {
+	return string(status)
+}
+
+// Fetch downloads objects and refs from a remote repository.
+// remote may be a URL or the name of a remote. Fetch returns the refs that
+// were updated, even if it also returns an error because some updates
+// were rejected.
+//
+// Git versions before 2.41 do not have machine-readable fetch output.
+// For those versions, Fetch compares the local refs before and after the
+// fetch, so refs that were up-to-date or rejected are not reported.
+//
+// This function may block on user input if the remote requires
+// credentials.
+func (g *Git) Fetch(ctx context.Context, remote string, opts FetchOptions) ([]*RefUpdate, error) {
+	errPrefix := fmt.Sprintf("git fetch %q", remote)
+	if opts.Depth > 0 && opts.Deepen > 0 {
+		return nil, fmt.Errorf("%s: Depth and Deepen are mutually exclusive", errPrefix)
+	}
+	porcelain := false
+	if version, err := g.getVersion(ctx); err == nil && versionAtLeast(version, 2, 41) {
+		porcelain = true
+	}
+	args := []string{"fetch"}
+	if porcelain {
+		args = append(args, "--porcelain")
+	}
+	if opts.Progress != nil {
+		args = append(args, "--progress")
+	}
+	if opts.Prune {
+		args = append(args, "--prune")
+	}
+	if opts.Depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", opts.Depth))
+	}
+	if opts.Deepen > 0 {
+		args = append(args, fmt.Sprintf("--deepen=%d", opts.Deepen))
+	}
+	switch opts.Tags {
+	case FetchTagsDefault:
+	case FetchAllTags:
+		args = append(args, "--tags")
+	case FetchNoTags:
+		args = append(args, "--no-tags")
+	default:
+		return nil, fmt.Errorf("%s: unknown tags mode %d", errPrefix, int(opts.Tags))
+	}
+	args = append(args, "--", remote)
+	for _, spec := range opts.Refspecs {
+		args = append(args, spec.String())
+	}
+
+	var before map[Ref]Hash
+	if !porcelain {
+		var err error
+		before, err = g.listAllRefs(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	stdout := new(strings.Builder)
+	runErr := g.runNetwork(ctx, errPrefix, args, stdout, opts.Progress)
+	if porcelain {
+		updates, err := parseFetchPorcelain(stdout.String())
+		if runErr != nil {
+			return updates, runErr
+		}
+		if err != nil {
+			return updates, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		return updates, nil
+	}
+	// Even if some updates were rejected, others may have succeeded,
+	// so always compare the refs.
+	after, err := g.listAllRefs(ctx)
+	if err != nil {
+		if runErr != nil {
+			return nil, runErr
+		}
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	updates, err := g.diffRefs(ctx, before, after)
+	if runErr != nil {
+		return updates, runErr
+	}
+	if err != nil {
+		return updates, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return updates, nil
+}
+
+// parseFetchPorcelain parses the output of `git fetch --porcelain`.
+// Each line has the form "<flag> <old-hash> <new-hash> <local-ref>".
+func parseFetchPorcelain(out string) ([]*RefUpdate, error) {
+	var updates []*RefUpdate
+	for len(out) > 0 {
+		eol := strings.IndexByte(out, '\n')
+		if eol == -1 {
+			return updates, errors.New("parse fetch output: unexpected EOF")
+		}
+		line := out[:eol]
+		out = out[eol+1:]
+
+		if len(line) < 2 || line[1] != ' ' || !RefUpdateStatus(line[0]).isValid() {
+			return updates, fmt.Errorf("parse fetch output: invalid line %q", line)
+		}
+		fields := strings.SplitN(line[2:], " ", 3)
+		if len(fields) != 3 {
+			return updates, fmt.Errorf("parse fetch output: invalid line %q", line)
+		}
+		u := &RefUpdate{
+			Ref:    Ref(fields[2]),
+			Status: RefUpdateStatus(line[0]),
+		}
+		var err error
+		if u.OldHash, err = ParseHash(fields[0]); err != nil {
+			return updates, fmt.Errorf("parse fetch output: %w", err)
+		}
+		if u.NewHash, err = ParseHash(fields[1]); err != nil {
+			return updates, fmt.Errorf("parse fetch output: %w", err)
+		}
+		updates = append(updates, u)
+	}
+	return updates, nil
+}
+
+// listAllRefs lists the refs in the repository without dereferencing tags.
+// Symbolic refs are omitted. Unlike ListRefsVerbatim, it succeeds in a
+// repository without any refs.
+func (g *Git) listAllRefs(ctx context.Context) (map[Ref]Hash, error) {
+	const errPrefix = "git for-each-ref"
+	out, err := g.output(ctx, errPrefix, []string{"for-each-ref", "--format=%(objectname) %(refname) %(symref)"})
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[Ref]Hash)
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, " ")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s: invalid line %q", errPrefix, line)
+		}
+		if fields[2] != "" {
+			continue
+		}
+		h, err := ParseHash(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		refs[Ref(fields[1])] = h
+	}
+	return refs, nil
+}
+
+// diffRefs reports the changes between two ref listings in the style of
+// `git fetch --porcelain`.
+func (g *Git) diffRefs(ctx context.Context, before, after map[Ref]Hash) ([]*RefUpdate, error) {
+	var updates []*RefUpdate
+	for ref, newHash := range after {
+		oldHash, existed := before[ref]
+		switch {
+		case !existed:
+			updates = append(updates, &RefUpdate{Ref: ref, NewHash: newHash, Status: RefNew})
+		case oldHash == newHash:
+			// Unchanged.
+		case ref.IsTag():
+			updates = append(updates, &RefUpdate{Ref: ref, OldHash: oldHash, NewHash: newHash, Status: RefTagUpdate})
+		default:
+			ff, err := g.IsAncestor(ctx, oldHash.String(), newHash.String())
+			if err != nil {
+				return nil, err
+			}
+			status := RefForcedUpdate
+			if ff {
+				status = RefFastForward
+			}
+			updates = append(updates, &RefUpdate{Ref: ref, OldHash: oldHash, NewHash: newHash, Status: status})
+		}
+	}
+	for ref, oldHash := range before {
+		if _, exists := after[ref]; !exists {
+			updates = append(updates, &RefUpdate{Ref: ref, OldHash: oldHash, Status: RefDeleted})
+		}
+	}
+	sort.Slice(updates, func(i, j int) bool {
+		return updates[i].Ref < updates[j].Ref
+	})
+	return updates, nil
+}
+
+// PushOptions specifies the command-line options for `git push`.
+type PushOptions struct {
+	// Refspecs is the set of refspecs to push, like "main" or
+	// "HEAD:refs/heads/feature". If empty, Git's push.default behavior
+	// is used.
+	Refspecs []string
+
+	// Progress receives the stderr of the `git push` subprocess if not nil.
+	Progress io.Writer
+
+	// ForceWithLease maps remote refs to the values they are expected to have
+	// before the push. If a remote ref has a different value, the push is
+	// rejected. A zero hash expects the remote ref to not exist.
+	ForceWithLease map[Ref]Hash
+	// If Atomic is true, either all refs are updated on the remote or none
+	// are.
+	Atomic bool
+	// Options are transmitted to the remote's hooks as push options.
+	Options []string
+}
+
+// Push uploads objects and updates refs in a remote repository.
+// remote may be a URL or the name of a remote. Push returns the status of
+// each ref, even if it also returns an error because some updates were
+// rejected.
+//
+// This function may block on user input if the remote requires
+// credentials.
+func (g *Git) Push(ctx context.Context, remote string, opts PushOptions) ([]*RefUpdate, error) {
+	errPrefix := fmt.Sprintf("git push %q", remote)
+	// Set core.abbrev so that --porcelain output includes full hashes.
+	args := []string{"-c", fmt.Sprintf("core.abbrev=%d", hashHexSize), "push", "--porcelain"}
+	if opts.Progress != nil {
+		args = append(args, "--progress")
+	}
+	leaseRefs := make([]Ref, 0, len(opts.ForceWithLease))
+	for ref := range opts.ForceWithLease {
+		leaseRefs = append(leaseRefs, ref)
+	}
+	sort.Slice(leaseRefs, func(i, j int) bool {
+		return leaseRefs[i] < leaseRefs[j]
+	})
+	for _, ref := range leaseRefs {
+		expect := opts.ForceWithLease[ref]
+		if expect == (Hash{}) {
+			args = append(args, "--force-with-lease="+ref.String()+":")
+		} else {
+			args = append(args, "--force-with-lease="+ref.String()+":"+expect.String())
+		}
+	}
+	if opts.Atomic {
+		args = append(args, "--atomic")
+	}
+	for _, o := range opts.Options {
+		args = append(args, "--push-option="+o)
+	}
+	args = append(args, "--", remote)
+	args = append(args, opts.Refspecs...)
+
+	stdout := new(strings.Builder)
+	runErr := g.runNetwork(ctx, errPrefix, args, stdout, opts.Progress)
+	updates, err := parsePushPorcelain(stdout.String())
+	if err == nil {
+		err = g.fillPushHashes(ctx, updates)
+	}
+	if runErr != nil {
+		return updates, runErr
+	}
+	if err != nil {
+		return updates, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return updates, nil
+}
+
+// hashHexSize is the number of hex digits in a Hash.
+const hashHexSize = len(Hash{}) * 2
+
+// parsePushPorcelain parses the output of `git push --porcelain`.
+// Each ref line has the form "<flag>\t<from>:<to>\t<summary> (<reason>)".
+func parsePushPorcelain(out string) ([]*RefUpdate, error) {
+	var updates []*RefUpdate
+	for len(out) > 0 {
+		var line string
+		if eol := strings.IndexByte(out, '\n'); eol != -1 {
+			line, out = out[:eol], out[eol+1:]
+		} else {
+			line, out = out, ""
+		}
+
+		if line == "" || line == "Done" || strings.HasPrefix(line, "To ") {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 || len(fields[0]) != 1 || !RefUpdateStatus(fields[0][0]).isValid() {
+			return updates, fmt.Errorf("parse push output: invalid line %q", line)
+		}
+		colon := strings.LastIndexByte(fields[1], ':')
+		if colon == -1 {
+			return updates, fmt.Errorf("parse push output: invalid line %q", line)
+		}
+		u := &RefUpdate{
+			Src:    fields[1][:colon],
+			Ref:    Ref(fields[1][colon+1:]),
+			Status: RefUpdateStatus(fields[0][0]),
+		}
+		summary := fields[2]
+		if strings.HasSuffix(summary, ")") {
+			if i := strings.LastIndex(summary, " ("); i != -1 {
+				u.Reason = summary[i+2 : len(summary)-1]
+				summary = summary[:i]
+			}
+		}
+		if sep := strings.Index(summary, ".."); sep != -1 && !strings.HasPrefix(summary, "[") {
+			oldHex := summary[:sep]
+			newHex := strings.TrimPrefix(summary[sep+2:], ".")
+			// Hashes may be abbreviated if Git ignored core.abbrev.
+			// Leave them as zero in that case.
+			u.OldHash, _ = ParseHash(oldHex)
+			u.NewHash, _ = ParseHash(newHex)
+		}
+		updates = append(updates, u)
+	}
+	return updates, nil
+}
+
+// fillPushHashes fills in the new hashes of newly created or up-to-date refs,
+// since `git push --porcelain` does not report them.
+func (g *Git) fillPushHashes(ctx context.Context, updates []*RefUpdate) error {
+	for _, u := range updates {
+		if (u.Status != RefNew && u.Status != RefUpToDate) || u.Src == "" {
+			continue
+		}
+		// Don't peel the source: pushing an annotated tag sets the remote ref
+		// to the tag object, not the tagged commit.
+		src := strings.TrimPrefix(u.Src, "+")
+		errPrefix := fmt.Sprintf("resolve %q", src)
+		if err := validateRev(src); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		out, err := g.output(ctx, errPrefix, []string{"rev-parse", "-q", "--verify", "--revs-only", src})
+		if err != nil {
+			return err
+		}
+		line, err := oneLine(out)
+		if err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		h, err := ParseHash(line)
+		if err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		u.NewHash = h
+		if u.Status == RefUpToDate {
+			u.OldHash = h
+		}
+	}
+	return nil
+}
+
+// runNetwork runs a Git subcommand that communicates with a remote,
+// sending its stderr to progress (if not nil) in addition to capturing it
+// for any returned error.
+func (g *Git) runNetwork(ctx context.Context, errPrefix string, args []string, stdout io.Writer, progress io.Writer) error {
+	stderr := new(bytes.Buffer)
+	var stderrWriter io.Writer = &limitWriter{w: stderr, n: errorOutputLimit}
+	if progress != nil {
+		stderrWriter = io.MultiWriter(progress, stderrWriter)
+	}
+	err := g.runner.RunGit(ctx, &Invocation{
+		Args:   args,
+		Dir:    g.dir,
+		Stdout: &limitWriter{w: stdout, n: dataOutputLimit},
+		Stderr: stderrWriter,
+	})
+	if err != nil {
+		return commandError(errPrefix, err, stderr.Bytes())
+	}
+	return nil
+}
+
 // A FetchRefspec specifies a mapping from remote refs to local refs.
 type FetchRefspec string
 
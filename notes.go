@@ -0,0 +1,291 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// notesArgs returns the leading arguments for a `git notes` subcommand
+// operating on the given notes ref. An empty notes ref uses Git's default,
+// which is usually "refs/notes/commits".
+func notesArgs(notesRef Ref, subcmd string) ([]string, error) {
+	args := []string{"notes"}
+	if notesRef != "" {
+		if err := validateRev(notesRef.String()); err != nil {
+			return nil, fmt.Errorf("notes ref: %w", err)
+		}
+		args = append(args, "--ref="+notesRef.String())
+	}
+	return append(args, subcmd), nil
+}
+
+// ReadNote returns the content of the note attached to the object named by
+// rev in the given notes ref. If notesRef is empty, then Git's default notes
+// ref is used. Short notes refs like "ci" are interpreted as
+// "refs/notes/ci". If the object does not have a note, then the returned
+// error will satisfy errors.Is(err, os.ErrNotExist).
+func (g *Git) ReadNote(ctx context.Context, notesRef Ref, rev string) (string, error) {
+	errPrefix := fmt.Sprintf("git notes show %q", rev)
+	if err := validateRev(rev); err != nil {
+		return "", fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	args, err := notesArgs(notesRef, "show")
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	args = append(args, rev)
+	out, err := g.output(ctx, errPrefix, args)
+	if err != nil {
+		if exitCode(err) == 1 {
+			return "", fmt.Errorf("%s: %w", errPrefix, os.ErrNotExist)
+		}
+		return "", err
+	}
+	return out, nil
+}
+
+// AddNoteOptions specifies the command-line options for `git notes add`.
+type AddNoteOptions struct {
+	// If Force is true, then any existing note on the object is replaced.
+	// Otherwise, AddNote returns an error if the object already has a note.
+	Force bool
+}
+
+// AddNote attaches a note to the object named by rev in the given notes ref.
+// If notesRef is empty, then Git's default notes ref is used. As with
+// commit messages, Git strips trailing whitespace and collapses consecutive
+// blank lines in the message.
+func (g *Git) AddNote(ctx context.Context, notesRef Ref, rev string, message string, opts AddNoteOptions) error {
+	errPrefix := fmt.Sprintf("git notes add %q", rev)
+	args, err := notesArgs(notesRef, "add")
+	if err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	return g.writeNote(ctx, errPrefix, args, rev, message)
+}
+
+// AppendNote appends a paragraph to the note attached to the object named by
+// rev in the given notes ref, creating the note if it does not exist.
+// If notesRef is empty, then Git's default notes ref is used.
+func (g *Git) AppendNote(ctx context.Context, notesRef Ref, rev string, message string) error {
+	errPrefix := fmt.Sprintf("git notes append %q", rev)
+	args, err := notesArgs(notesRef, "append")
+	if err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return g.writeNote(ctx, errPrefix, args, rev, message)
+}
+
+func (g *Git) writeNote(ctx context.Context, errPrefix string, args []string, rev string, message string) error {
+	if err := validateRev(rev); err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	args = append(args, "--file=-", rev)
+	out := new(bytes.Buffer)
+	w := &limitWriter{w: out, n: errorOutputLimit}
+	err := g.runner.RunGit(ctx, &Invocation{
+		Args:   args,
+		Dir:    g.dir,
+		Stdin:  strings.NewReader(message),
+		Stdout: w,
+		Stderr: w,
+	})
+	if err != nil {
+		return commandError(errPrefix, err, out.Bytes())
+	}
+	return nil
+}
+
+// RemoveNote removes the note attached to the object named by rev in the
+// given notes ref. If notesRef is empty, then Git's default notes ref is used.
+// It is an error if the object does not have a note.
+func (g *Git) RemoveNote(ctx context.Context, notesRef Ref, rev string) error {
+	errPrefix := fmt.Sprintf("git notes remove %q", rev)
+	if err := validateRev(rev); err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	args, err := notesArgs(notesRef, "remove")
+	if err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	args = append(args, rev)
+	return g.run(ctx, errPrefix, args)
+}
+
+// ListNotes starts listing the notes in the given notes ref. If notesRef is
+// empty, then Git's default notes ref is used. The context's deadline and
+// cancelation will apply to the entire read from the NoteList. It is the
+// caller's responsibility to call Close on the returned NoteList.
+func (g *Git) ListNotes(ctx context.Context, notesRef Ref) (*NoteList, error) {
+	const errPrefix = "git notes list"
+	args, err := notesArgs(notesRef, "list")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stderr := new(bytes.Buffer)
+	pipe, err := StartPipe(ctx, g.runner, &Invocation{
+		Args:   args,
+		Dir:    g.dir,
+		Stderr: &limitWriter{w: stderr, n: errorOutputLimit},
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return &NoteList{
+		r:      bufio.NewReader(pipe),
+		pipe:   pipe,
+		stderr: stderr,
+		cancel: cancel,
+	}, nil
+}
+
+// NoteList is an open handle to a `git notes list` subprocess.
+// Closing the NoteList stops the subprocess.
+type NoteList struct {
+	r      *bufio.Reader
+	pipe   io.ReadCloser
+	stderr *bytes.Buffer
+	cancel context.CancelFunc
+
+	scanErr  error
+	scanDone bool
+	object   Hash
+	note     Hash
+}
+
+// Next attempts to scan the next note and returns whether there is a new note.
+func (nl *NoteList) Next() bool {
+	if nl.scanDone {
+		return false
+	}
+	err := nl.next()
+	if err != nil {
+		nl.scanErr = err
+		if errors.Is(err, io.EOF) {
+			nl.scanErr = nil
+		}
+		nl.scanDone = true
+		nl.object = Hash{}
+		nl.note = Hash{}
+		nl.cancel()
+		return false
+	}
+	return true
+}
+
+func (nl *NoteList) next() error {
+	line, err := nl.r.ReadString('\n')
+	if len(line) == 0 && errors.Is(err, io.EOF) {
+		// Reached successful end. Wait for subprocess to exit.
+		if err := nl.close(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	nl.note, nl.object, err = parseNoteLine(strings.TrimSuffix(line, "\n"))
+	if err != nil {
+		return fmt.Errorf("git notes list: %w", err)
+	}
+	return nil
+}
+
+// parseNoteLine parses a single line of `git notes list` output.
+func parseNoteLine(line string) (note, object Hash, _ error) {
+	i := strings.IndexByte(line, ' ')
+	if i == -1 {
+		return Hash{}, Hash{}, fmt.Errorf("invalid line %q", line)
+	}
+	note, err := ParseHash(line[:i])
+	if err != nil {
+		return Hash{}, Hash{}, fmt.Errorf("note: %w", err)
+	}
+	object, err = ParseHash(line[i+1:])
+	if err != nil {
+		return Hash{}, Hash{}, fmt.Errorf("annotated object: %w", err)
+	}
+	return note, object, nil
+}
+
+// Object returns the ID of the annotated object of the most recently
+// scanned note. Next must be called at least once before calling Object.
+func (nl *NoteList) Object() Hash {
+	return nl.object
+}
+
+// Note returns the ID of the blob that holds the content of the most
+// recently scanned note. Next must be called at least once before
+// calling Note.
+func (nl *NoteList) Note() Hash {
+	return nl.note
+}
+
+// Close ends the subprocess and waits for it to finish.
+// Close returns an error if Next returned false due to a parse failure.
+func (nl *NoteList) Close() error {
+	nl.cancel()
+	nl.close()         // Ignore error, since it's from interrupting.
+	nl.scanDone = true // Bail early for future calls to Next.
+	return nl.scanErr
+}
+
+func (nl *NoteList) close() error {
+	if nl.pipe == nil {
+		return nil
+	}
+	err := nl.pipe.Close()
+	nl.pipe = nil
+	if err != nil {
+		return commandError("git notes list", err, nl.stderr.Bytes())
+	}
+	return nil
+}
+
+// readNotesMap reads all the notes in the given notes ref into a map of
+// annotated object IDs to note blob IDs.
+func (g *Git) readNotesMap(ctx context.Context, notesRef Ref) (map[Hash]Hash, error) {
+	notes, err := g.ListNotes(ctx, notesRef)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[Hash]Hash)
+	for notes.Next() {
+		m[notes.Object()] = notes.Note()
+	}
+	if err := notes.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNotes(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", dummyContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	rev1, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "Goodbye, World!\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CommitAll(ctx, "second", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	rev2, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const notesRef Ref = "refs/notes/ci"
+	if _, err := env.g.ReadNote(ctx, notesRef, rev1.Commit.String()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadNote(...) before adding = _, %v; want %v", err, os.ErrNotExist)
+	}
+	if err := env.g.AddNote(ctx, notesRef, rev1.Commit.String(), "build: passed\n", AddNoteOptions{}); err != nil {
+		t.Fatal("AddNote:", err)
+	}
+	if err := env.g.AddNote(ctx, notesRef, rev1.Commit.String(), "build: failed\n", AddNoteOptions{}); err == nil {
+		t.Error("AddNote on object with note did not return an error")
+	}
+	if err := env.g.AddNote(ctx, "ci", rev2.Commit.String(), "build: failed\n", AddNoteOptions{}); err != nil {
+		t.Fatal("AddNote with short ref:", err)
+	}
+	if err := env.g.AppendNote(ctx, notesRef, rev2.Commit.String(), "retry: passed\n"); err != nil {
+		t.Fatal("AppendNote:", err)
+	}
+
+	got, err := env.g.ReadNote(ctx, notesRef, rev1.Commit.String())
+	if err != nil {
+		t.Fatal("ReadNote:", err)
+	}
+	if want := "build: passed\n"; got != want {
+		t.Errorf("ReadNote(..., %v) = %q; want %q", rev1.Commit, got, want)
+	}
+	got, err = env.g.ReadNote(ctx, notesRef, rev2.Commit.String())
+	if err != nil {
+		t.Fatal("ReadNote:", err)
+	}
+	if want := "build: failed\n\nretry: passed\n"; got != want {
+		t.Errorf("ReadNote(..., %v) = %q; want %q", rev2.Commit, got, want)
+	}
+	if _, err := env.g.ReadNote(ctx, "", rev1.Commit.String()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadNote(...) in default notes ref = _, %v; want %v", err, os.ErrNotExist)
+	}
+
+	// List notes.
+	notes, err := env.g.ListNotes(ctx, notesRef)
+	if err != nil {
+		t.Fatal("ListNotes:", err)
+	}
+	listed := make(map[Hash]string)
+	for notes.Next() {
+		content, err := env.g.Output(ctx, "cat-file", "blob", notes.Note().String())
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		listed[notes.Object()] = content
+	}
+	if err := notes.Close(); err != nil {
+		t.Error("ListNotes:", err)
+	}
+	wantListed := map[Hash]string{
+		rev1.Commit: "build: passed\n",
+		rev2.Commit: "build: failed\n\nretry: passed\n",
+	}
+	if diff := cmp.Diff(wantListed, listed); diff != "" {
+		t.Errorf("ListNotes(...) (-want +got):\n%s", diff)
+	}
+
+	// Read notes alongside the log.
+	log, err := env.g.Log(ctx, LogOptions{NotesRef: notesRef})
+	if err != nil {
+		t.Fatal("Log:", err)
+	}
+	logNotes := make(map[string]string)
+	for log.Next() {
+		logNotes[log.CommitInfo().Message] = log.Note()
+	}
+	if err := log.Close(); err != nil {
+		t.Error("Log:", err)
+	}
+	wantLogNotes := map[string]string{
+		"first":  "build: passed\n",
+		"second": "build: failed\n\nretry: passed\n",
+	}
+	if diff := cmp.Diff(wantLogNotes, logNotes); diff != "" {
+		t.Errorf("Log notes (-want +got):\n%s", diff)
+	}
+
+	// Remove a note.
+	if err := env.g.RemoveNote(ctx, notesRef, rev1.Commit.String()); err != nil {
+		t.Fatal("RemoveNote:", err)
+	}
+	if _, err := env.g.ReadNote(ctx, notesRef, rev1.Commit.String()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadNote(...) after RemoveNote = _, %v; want %v", err, os.ErrNotExist)
+	}
+	if err := env.g.RemoveNote(ctx, notesRef, rev1.Commit.String()); err == nil {
+		t.Error("RemoveNote on object without note did not return an error")
+	}
+}
+
+func TestParseNoteLine(t *testing.T) {
+	tests := []struct {
+		line       string
+		wantNote   Hash
+		wantObject Hash
+		wantErr    bool
+	}{
+		{
+			line:       "6cb2dae4f132337019b3999c77a0bf21279a6673 1bec116a955de777a9abffc914ea579b49dc1157",
+			wantNote:   hashLiteral("6cb2dae4f132337019b3999c77a0bf21279a6673"),
+			wantObject: hashLiteral("1bec116a955de777a9abffc914ea579b49dc1157"),
+		},
+		{
+			line:    "6cb2dae4f132337019b3999c77a0bf21279a6673",
+			wantErr: true,
+		},
+		{
+			line:    "6cb2dae4f132337019b3999c77a0bf21279a6673 1bec116a",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		note, object, err := parseNoteLine(test.line)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("parseNoteLine(%q): %v", test.line, err)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("parseNoteLine(%q) = %v, %v, <nil>; want error", test.line, note, object)
+			continue
+		}
+		if note != test.wantNote || object != test.wantObject {
+			t.Errorf("parseNoteLine(%q) = %v, %v, <nil>; want %v, %v, <nil>", test.line, note, object, test.wantNote, test.wantObject)
+		}
+	}
+}
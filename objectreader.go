@@ -0,0 +1,463 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"gg-scm.io/pkg/git/object"
+)
+
+// ObjectInfo describes a single Git object.
+type ObjectInfo struct {
+	ID   Hash
+	Type object.Type
+	Size int64
+}
+
+// An ObjectReader reads objects from a repository using long-running
+// `git cat-file --batch` and `git cat-file --batch-check` subprocesses,
+// avoiding the cost of starting a new process for each object.
+// The subprocesses are started on first use.
+//
+// An ObjectReader is safe to use from multiple goroutines, but requests are
+// serialized: only one object may be read at a time. If a subprocess fails,
+// the request that observed the failure returns an error and the next request
+// starts a new subprocess.
+type ObjectReader struct {
+	runner Runner
+	dir    string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// sem is a semaphore that guards the fields below.
+	// A blob reader holds the semaphore until it is closed.
+	sem    chan struct{}
+	batch  *catFileProcess
+	check  *catFileProcess
+	closed bool
+}
+
+// OpenObjectReader returns a new ObjectReader for the repository.
+// The context's deadline and cancelation will apply to the lifetime of the
+// ObjectReader's subprocesses. It is the caller's responsibility to call
+// Close on the returned ObjectReader.
+func (g *Git) OpenObjectReader(ctx context.Context) (*ObjectReader, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &ObjectReader{
+		runner: g.runner,
+		dir:    g.dir,
+		ctx:    ctx,
+		cancel: cancel,
+		sem:    make(chan struct{}, 1),
+	}
+	return r, nil
+}
+
+// catFileProcess is a running `git cat-file` batch subprocess.
+type catFileProcess struct {
+	errPrefix string
+	stdin     *io.PipeWriter
+	stdout    *bufio.Reader
+	pipe      io.ReadCloser
+	stderr    *bytes.Buffer
+	err       error // sticky error after a protocol failure
+}
+
+// catFile returns the running `git cat-file` subprocess stored in *p,
+// starting a new one if there is none or the previous one has failed.
+// The caller must hold the semaphore.
+func (r *ObjectReader) catFile(p **catFileProcess, mode string) (*catFileProcess, error) {
+	if *p != nil && (*p).err != nil {
+		// The error has already been reported, so ignore the exit status.
+		(*p).close()
+		*p = nil
+	}
+	if *p == nil {
+		var err error
+		*p, err = r.startCatFile(mode)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return *p, nil
+}
+
+func (r *ObjectReader) startCatFile(mode string) (*catFileProcess, error) {
+	errPrefix := "git cat-file " + mode
+	stdinReader, stdinWriter := io.Pipe()
+	stderr := new(bytes.Buffer)
+	pipe, err := StartPipe(r.ctx, r.runner, &Invocation{
+		Args:   []string{"cat-file", mode},
+		Dir:    r.dir,
+		Stdin:  stdinReader,
+		Stderr: &limitWriter{w: stderr, n: errorOutputLimit},
+	})
+	if err != nil {
+		stdinWriter.Close()
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return &catFileProcess{
+		errPrefix: errPrefix,
+		stdin:     stdinWriter,
+		stdout:    bufio.NewReaderSize(pipe, 64<<10 /* 64 KiB */),
+		pipe:      pipe,
+		stderr:    stderr,
+	}, nil
+}
+
+// request writes a revision to the process's stdin and reads the object
+// information line in response.
+func (p *catFileProcess) request(rev string) (*ObjectInfo, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if _, err := io.WriteString(p.stdin, rev+"\n"); err != nil {
+		p.err = fmt.Errorf("%s: %w", p.errPrefix, err)
+		return nil, p.err
+	}
+	line, err := p.stdout.ReadString('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		p.err = fmt.Errorf("%s: %w", p.errPrefix, err)
+		return nil, p.err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	if strings.HasSuffix(line, " missing") {
+		return nil, fmt.Errorf("%s: %w", rev, os.ErrNotExist)
+	}
+	if strings.HasSuffix(line, " ambiguous") {
+		return nil, fmt.Errorf("%s: ambiguous revision", rev)
+	}
+	info, err := parseObjectInfoLine(line)
+	if err != nil {
+		p.err = fmt.Errorf("%s: %w", p.errPrefix, err)
+		return nil, p.err
+	}
+	return info, nil
+}
+
+func (p *catFileProcess) close() error {
+	p.stdin.Close()
+	if err := p.pipe.Close(); err != nil {
+		return commandError(p.errPrefix, err, p.stderr.Bytes())
+	}
+	return nil
+}
+
+// parseObjectInfoLine parses the default `git cat-file --batch` object
+// information line (without the trailing newline).
+//
+// Reference: https://git-scm.com/docs/git-cat-file#_batch_output
+func parseObjectInfoLine(line string) (*ObjectInfo, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid object information line %q", line)
+	}
+	id, err := ParseHash(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid object information line: %w", err)
+	}
+	typ := object.Type(fields[1])
+	if !typ.IsValid() {
+		return nil, fmt.Errorf("object %v: unknown type %q", id, typ)
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("object %v: size: %w", id, err)
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("object %v: negative size", id)
+	}
+	return &ObjectInfo{ID: id, Type: typ, Size: size}, nil
+}
+
+// acquire waits for exclusive access to the reader's subprocesses.
+func (r *ObjectReader) acquire(ctx context.Context) error {
+	select {
+	case r.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if r.closed {
+		r.release()
+		return errors.New("object reader closed")
+	}
+	return nil
+}
+
+func (r *ObjectReader) release() {
+	<-r.sem
+}
+
+// Stat returns information about the object named by the given revision
+// without reading its content. If the object does not exist, then the
+// returned error will satisfy errors.Is(err, os.ErrNotExist).
+func (r *ObjectReader) Stat(ctx context.Context, rev string) (*ObjectInfo, error) {
+	errPrefix := fmt.Sprintf("stat object %q", rev)
+	if err := validateBatchRev(rev); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if err := r.acquire(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	defer r.release()
+	check, err := r.catFile(&r.check, "--batch-check")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	info, err := check.request(rev)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return info, nil
+}
+
+// Open starts reading the object named by the given revision. If the object
+// does not exist, then the returned error will satisfy
+// errors.Is(err, os.ErrNotExist).
+//
+// The ObjectReader cannot be used for other requests until the returned
+// io.ReadCloser is closed, so it is the caller's responsibility to close it
+// promptly if the returned error is nil.
+func (r *ObjectReader) Open(ctx context.Context, rev string) (*ObjectInfo, io.ReadCloser, error) {
+	errPrefix := fmt.Sprintf("open object %q", rev)
+	if err := validateBatchRev(rev); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if err := r.acquire(ctx); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	info, err := r.startRead(rev)
+	if err != nil {
+		r.release()
+		return nil, nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return info, &batchObjectReader{
+		r: r,
+		p: r.batch,
+		n: info.Size,
+	}, nil
+}
+
+// startRead requests an object from the batch process. The caller must hold
+// the semaphore.
+func (r *ObjectReader) startRead(rev string) (*ObjectInfo, error) {
+	batch, err := r.catFile(&r.batch, "--batch")
+	if err != nil {
+		return nil, err
+	}
+	return batch.request(rev)
+}
+
+// readAll reads the entire content of the object named by rev and verifies
+// that it is of the expected type.
+func (r *ObjectReader) readAll(ctx context.Context, rev string, want object.Type) (*ObjectInfo, []byte, error) {
+	if err := r.acquire(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer r.release()
+	info, err := r.startRead(rev)
+	if err != nil {
+		return nil, nil, err
+	}
+	data := make([]byte, info.Size)
+	if _, err := io.ReadFull(r.batch.stdout, data); err != nil {
+		r.batch.err = fmt.Errorf("%s: %w", r.batch.errPrefix, err)
+		return nil, nil, r.batch.err
+	}
+	if err := r.batch.readTrailer(); err != nil {
+		return nil, nil, err
+	}
+	if info.Type != want {
+		return nil, nil, fmt.Errorf("object %v is a %v, not a %v", info.ID, info.Type, want)
+	}
+	return info, data, nil
+}
+
+// readTrailer consumes the newline that follows each object's content.
+func (p *catFileProcess) readTrailer() error {
+	c, err := p.stdout.ReadByte()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		p.err = fmt.Errorf("%s: %w", p.errPrefix, err)
+		return p.err
+	}
+	if c != '\n' {
+		p.err = fmt.Errorf("%s: object does not end with newline", p.errPrefix)
+		return p.err
+	}
+	return nil
+}
+
+// Commit reads the commit named by the given revision. If the revision names
+// an annotated tag, then it is peeled to its commit.
+func (r *ObjectReader) Commit(ctx context.Context, rev string) (*object.Commit, error) {
+	errPrefix := fmt.Sprintf("read commit %q", rev)
+	if err := validateBatchRev(rev); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	_, data, err := r.readAll(ctx, rev+"^{commit}", object.TypeCommit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	c, err := object.ParseCommit(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return c, nil
+}
+
+// Tree reads the tree named by the given revision. If the revision names a
+// commit or an annotated tag, then it is peeled to its tree.
+func (r *ObjectReader) Tree(ctx context.Context, rev string) (object.Tree, error) {
+	errPrefix := fmt.Sprintf("read tree %q", rev)
+	if err := validateBatchRev(rev); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	_, data, err := r.readAll(ctx, rev+"^{tree}", object.TypeTree)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	tree, err := object.ParseTree(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return tree, nil
+}
+
+// Tag reads the annotated tag named by the given revision.
+func (r *ObjectReader) Tag(ctx context.Context, rev string) (*object.Tag, error) {
+	errPrefix := fmt.Sprintf("read tag %q", rev)
+	if err := validateBatchRev(rev); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	_, data, err := r.readAll(ctx, rev, object.TypeTag)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	tag, err := object.ParseTag(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return tag, nil
+}
+
+// Close stops the ObjectReader's subprocesses and waits for them to finish.
+// Close waits for any open object readers to be closed.
+func (r *ObjectReader) Close() error {
+	r.sem <- struct{}{}
+	defer r.release()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	var first error
+	for _, p := range []*catFileProcess{r.batch, r.check} {
+		if p == nil {
+			continue
+		}
+		if err := p.close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	r.batch = nil
+	r.check = nil
+	r.cancel()
+	return first
+}
+
+// batchObjectReader reads a single object's content from a
+// `git cat-file --batch` process.
+type batchObjectReader struct {
+	r *ObjectReader // nil after Close
+	p *catFileProcess
+	n int64 // number of bytes remaining in object
+}
+
+func (br *batchObjectReader) Read(b []byte) (int, error) {
+	if br.r == nil {
+		return 0, errors.New("read from closed object")
+	}
+	if br.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > br.n {
+		b = b[:br.n]
+	}
+	n, err := br.p.stdout.Read(b)
+	br.n -= int64(n)
+	if errors.Is(err, io.EOF) {
+		if br.n > 0 {
+			err = io.ErrUnexpectedEOF
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		br.p.err = fmt.Errorf("%s: %w", br.p.errPrefix, err)
+	}
+	return n, err
+}
+
+// Close discards any unread content of the object and releases the
+// ObjectReader for other requests.
+func (br *batchObjectReader) Close() error {
+	if br.r == nil {
+		return nil
+	}
+	defer func() {
+		br.r.release()
+		br.r = nil
+	}()
+	if br.p.err != nil {
+		return br.p.err
+	}
+	if br.n > 0 {
+		if _, err := io.CopyN(ioutil.Discard, br.p.stdout, br.n); err != nil {
+			br.p.err = fmt.Errorf("%s: %w", br.p.errPrefix, err)
+			return br.p.err
+		}
+		br.n = 0
+	}
+	return br.p.readTrailer()
+}
+
+// validateBatchRev returns an error if rev cannot be sent to
+// `git cat-file --batch`, which reads one revision per line.
+func validateBatchRev(rev string) error {
+	if rev == "" {
+		return errors.New("empty revision")
+	}
+	if strings.ContainsAny(rev, "\n\x00") {
+		return errors.New("revision contains newline or NUL")
+	}
+	return nil
+}
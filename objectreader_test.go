@@ -0,0 +1,238 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"gg-scm.io/pkg/git/object"
+)
+
+func TestObjectReader(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	const barContent = "Bar content\n"
+	err = env.root.Apply(
+		filesystem.Write("foo.txt", dummyContent),
+		filesystem.Write("bar.txt", barContent),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt", "bar.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	head, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := env.g.OpenObjectReader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			t.Error("Close:", err)
+		}
+	}()
+
+	info, err := r.Stat(ctx, "HEAD")
+	if err != nil {
+		t.Fatal("Stat:", err)
+	}
+	if info.ID != head.Commit || info.Type != object.TypeCommit {
+		t.Errorf("Stat(ctx, \"HEAD\") = %v %v; want %v %v", info.ID, info.Type, head.Commit, object.TypeCommit)
+	}
+
+	c, err := r.Commit(ctx, "HEAD")
+	if err != nil {
+		t.Fatal("Commit:", err)
+	}
+	if c.Message != "first" {
+		t.Errorf("Commit(ctx, \"HEAD\").Message = %q; want \"first\"", c.Message)
+	}
+	tree, err := r.Tree(ctx, "HEAD")
+	if err != nil {
+		t.Fatal("Tree:", err)
+	}
+	if tree.SHA1() != c.Tree {
+		t.Errorf("Tree(ctx, \"HEAD\").SHA1() = %v; want %v", tree.SHA1(), c.Tree)
+	}
+	if len(tree) != 2 {
+		t.Errorf("len(Tree(ctx, \"HEAD\")) = %d; want 2", len(tree))
+	}
+
+	// Read only part of a blob, then make sure the session stays in sync.
+	info, blob, err := r.Open(ctx, "HEAD:foo.txt")
+	if err != nil {
+		t.Fatal("Open:", err)
+	}
+	if info.Type != object.TypeBlob || info.Size != int64(len(dummyContent)) {
+		t.Errorf("Open(ctx, \"HEAD:foo.txt\") info = %v %d; want %v %d", info.Type, info.Size, object.TypeBlob, len(dummyContent))
+	}
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(blob, buf); err != nil {
+		t.Error("Read:", err)
+	} else if string(buf) != dummyContent[:3] {
+		t.Errorf("first bytes of foo.txt = %q; want %q", buf, dummyContent[:3])
+	}
+	if err := blob.Close(); err != nil {
+		t.Error("Close blob:", err)
+	}
+	_, blob, err = r.Open(ctx, "HEAD:bar.txt")
+	if err != nil {
+		t.Fatal("Open:", err)
+	}
+	got, err := ioutil.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		t.Error("Read:", err)
+	} else if string(got) != barContent {
+		t.Errorf("bar.txt content = %q; want %q", got, barContent)
+	}
+
+	if _, err := r.Stat(ctx, "HEAD:missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat(ctx, \"HEAD:missing.txt\") error = %v; want %v", err, os.ErrNotExist)
+	}
+	if _, _, err := r.Open(ctx, "HEAD:missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open(ctx, \"HEAD:missing.txt\") error = %v; want %v", err, os.ErrNotExist)
+	}
+	if _, err := r.Tag(ctx, "HEAD"); err == nil {
+		t.Error("Tag(ctx, \"HEAD\") did not return an error")
+	}
+
+	// Concurrent readers should each get the correct object.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := r.Commit(ctx, head.Commit.String())
+			if err != nil {
+				t.Error("Commit:", err)
+				return
+			}
+			if c.Message != "first" {
+				t.Errorf("Commit(ctx, %q).Message = %q; want \"first\"", head.Commit, c.Message)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestObjectReaderRestart(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", dummyContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first cat-file process of each kind fails after reading its
+	// first request. Later processes run Git normally.
+	started := make(map[string]bool)
+	var mu sync.Mutex
+	runner := runnerFunc(func(ctx context.Context, invoke *Invocation) error {
+		mode := invoke.Args[len(invoke.Args)-1]
+		mu.Lock()
+		fail := invoke.Args[0] == "cat-file" && !started[mode]
+		started[mode] = true
+		mu.Unlock()
+		if fail {
+			invoke.Stdin.Read(make([]byte, 4096))
+			return errors.New("transport failure")
+		}
+		return env.g.Runner().RunGit(ctx, invoke)
+	})
+	g := Custom(env.root.String(), runner, env.g.FileSystem())
+	r, err := g.OpenObjectReader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			t.Error("Close:", err)
+		}
+	}()
+
+	if _, err := r.Stat(ctx, "HEAD:foo.txt"); err == nil {
+		t.Error("first Stat did not return an error")
+	}
+	if info, err := r.Stat(ctx, "HEAD:foo.txt"); err != nil {
+		t.Error("second Stat:", err)
+	} else if got, want := info.Size, int64(len(dummyContent)); got != want {
+		t.Errorf("second Stat size = %d; want %d", got, want)
+	}
+
+	if _, rc, err := r.Open(ctx, "HEAD:foo.txt"); err == nil {
+		rc.Close()
+		t.Error("first Open did not return an error")
+	}
+	_, rc, err := r.Open(ctx, "HEAD:foo.txt")
+	if err != nil {
+		t.Fatal("second Open:", err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	if closeErr := rc.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Error("second Open:", err)
+	} else if string(got) != dummyContent {
+		t.Errorf("second Open content = %q; want %q", got, dummyContent)
+	}
+}
@@ -0,0 +1,537 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bufio"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gg-scm.io/pkg/git/object"
+	"gg-scm.io/pkg/git/packfile"
+)
+
+// maxAlternateDepth is the maximum number of alternates files that will be
+// followed from the primary object directory. This matches Git's limit.
+const maxAlternateDepth = 5
+
+// An ObjectStore reads objects directly from a Git repository's object
+// database without starting any Git subprocesses. It reads loose objects,
+// packfiles, and any alternate object directories. It does not modify the
+// repository. An ObjectStore is safe to use from multiple goroutines
+// concurrently.
+type ObjectStore struct {
+	dirs []*objectDir
+
+	// packMu guards the packs field of every objectDir.
+	packMu sync.RWMutex
+
+	undeltifiers sync.Pool
+}
+
+// An objectDir is a single directory of objects, like .git/objects.
+type objectDir struct {
+	path  string
+	packs []*objectPack
+}
+
+// An objectPack is an open packfile and its index.
+type objectPack struct {
+	name string // base name of the packfile
+	f    *os.File
+	size int64
+	idx  *packfile.Index
+}
+
+// OpenObjectStore opens the object database of the repository whose Git
+// directory (or common directory for linked working trees) is at the given
+// path on the local filesystem. It is the caller's responsibility to call
+// Close on the returned ObjectStore.
+func OpenObjectStore(gitDir string) (*ObjectStore, error) {
+	errPrefix := fmt.Sprintf("open object store %s", gitDir)
+	dirs, err := findObjectDirs(filepath.Join(gitDir, "objects"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	store := &ObjectStore{dirs: dirs}
+	for _, dir := range store.dirs {
+		if err := dir.loadPacks(); err != nil {
+			store.Close()
+			return nil, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	return store, nil
+}
+
+// OpenObjectStore opens the object database of the repository. The
+// repository's common directory must be accessible from the local
+// filesystem. It is the caller's responsibility to call Close on the
+// returned ObjectStore.
+func (g *Git) OpenObjectStore(ctx context.Context) (*ObjectStore, error) {
+	commonDir, err := g.CommonDir(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("open object store: %w", err)
+	}
+	return OpenObjectStore(commonDir)
+}
+
+// findObjectDirs returns the given object directory followed by its
+// alternates in the order Git searches them.
+func findObjectDirs(primary string) ([]*objectDir, error) {
+	if _, err := os.Stat(primary); err != nil {
+		return nil, err
+	}
+	dirs := []*objectDir{{path: primary}}
+	seen := map[string]bool{primary: true}
+	for i, depth := 0, 0; i < len(dirs) && depth <= maxAlternateDepth; depth++ {
+		// Process one level of alternates at a time to enforce the depth limit.
+		for end := len(dirs); i < end; i++ {
+			alts, err := readAlternates(dirs[i].path)
+			if err != nil {
+				return nil, err
+			}
+			for _, alt := range alts {
+				if seen[alt] {
+					continue
+				}
+				seen[alt] = true
+				dirs = append(dirs, &objectDir{path: alt})
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// readAlternates parses the objects/info/alternates file inside the given
+// object directory. Relative paths are resolved relative to the object
+// directory. Missing directories are skipped, as they are in Git.
+//
+// See https://git-scm.com/docs/gitrepository-layout#Documentation/gitrepository-layout.txt-objectsinfoalternates
+func readAlternates(objectsDir string) ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(objectsDir, "info", "alternates"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var alts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, `"`) {
+			// Git permits C-style quoting for paths with unusual characters.
+			unquoted, err := unquoteCString(line)
+			if err != nil {
+				return nil, fmt.Errorf("read alternates: %w", err)
+			}
+			line = unquoted
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(objectsDir, line)
+		}
+		line = filepath.Clean(line)
+		if info, err := os.Stat(line); err != nil || !info.IsDir() {
+			continue
+		}
+		alts = append(alts, line)
+	}
+	return alts, nil
+}
+
+// loadPacks opens any packfiles in the directory that have not already been
+// opened. The caller must hold an exclusive lock on the store's packMu or
+// otherwise guarantee exclusive access to dir.
+func (dir *objectDir) loadPacks() error {
+	packDir := filepath.Join(dir.path, "pack")
+	idxPaths, err := filepath.Glob(filepath.Join(packDir, "pack-*.idx"))
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(dir.packs))
+	for _, pack := range dir.packs {
+		known[pack.name] = true
+	}
+	for _, idxPath := range idxPaths {
+		name := strings.TrimSuffix(filepath.Base(idxPath), ".idx") + ".pack"
+		if known[name] {
+			continue
+		}
+		pack, err := openObjectPack(idxPath, filepath.Join(packDir, name))
+		if os.IsNotExist(err) {
+			// Packfile may have been removed by a concurrent gc.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		dir.packs = append(dir.packs, pack)
+	}
+	return nil
+}
+
+func openObjectPack(idxPath, packPath string) (*objectPack, error) {
+	idxFile, err := os.Open(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := packfile.ReadIndex(bufio.NewReader(idxFile))
+	idxFile.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", idxPath, err)
+	}
+	f, err := os.Open(packPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &objectPack{
+		name: filepath.Base(packPath),
+		f:    f,
+		size: info.Size(),
+		idx:  idx,
+	}, nil
+}
+
+// Open opens the object with the given ID for reading. The returned reader
+// yields the object's content without the Git object prefix. If the object
+// does not exist, then the returned error will satisfy
+// errors.Is(err, os.ErrNotExist). It is the caller's responsibility to close
+// the returned io.ReadCloser if the returned error is nil.
+func (store *ObjectStore) Open(id Hash) (object.Prefix, io.ReadCloser, error) {
+	errPrefix := fmt.Sprintf("open object %v", id)
+	for _, dir := range store.dirs {
+		prefix, r, err := openLooseObject(dir.path, id)
+		if err == nil {
+			return prefix, r, nil
+		}
+		if !os.IsNotExist(err) {
+			return object.Prefix{}, nil, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	pack, offset, err := store.findPacked(id)
+	if err != nil {
+		return object.Prefix{}, nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	u, _ := store.undeltifiers.Get().(*packfile.Undeltifier)
+	if u == nil {
+		u = new(packfile.Undeltifier)
+	}
+	f := packfile.NewBufferedReadSeeker(io.NewSectionReader(pack.f, 0, pack.size))
+	prefix, r, err := u.Undeltify(f, offset, &packfile.UndeltifyOptions{Index: pack.idx})
+	if err != nil {
+		store.undeltifiers.Put(u)
+		return object.Prefix{}, nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return prefix, &packedObjectReader{
+		r:    io.LimitReader(r, prefix.Size),
+		u:    u,
+		pool: &store.undeltifiers,
+	}, nil
+}
+
+// Stat returns the type and size of the object with the given ID. If the
+// object does not exist, then the returned error will satisfy
+// errors.Is(err, os.ErrNotExist). Stat is usually cheaper than Open, since
+// it only needs to read the object's header.
+func (store *ObjectStore) Stat(id Hash) (object.Prefix, error) {
+	errPrefix := fmt.Sprintf("stat object %v", id)
+	for _, dir := range store.dirs {
+		prefix, r, err := openLooseObject(dir.path, id)
+		if err == nil {
+			r.Close()
+			return prefix, nil
+		}
+		if !os.IsNotExist(err) {
+			return object.Prefix{}, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	pack, offset, err := store.findPacked(id)
+	if err != nil {
+		return object.Prefix{}, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	prefix, err := statPackedObject(pack, offset)
+	if err != nil {
+		return object.Prefix{}, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return prefix, nil
+}
+
+// Has reports whether the object with the given ID exists in the store.
+func (store *ObjectStore) Has(id Hash) bool {
+	for _, dir := range store.dirs {
+		if _, err := os.Stat(looseObjectPath(dir.path, id)); err == nil {
+			return true
+		}
+	}
+	_, _, err := store.findPacked(id)
+	return err == nil
+}
+
+// findPacked searches for the object in the store's packfiles. If the object
+// cannot be found, then findPacked rescans the pack directories once in case
+// Git wrote a new packfile since the store was opened.
+func (store *ObjectStore) findPacked(id Hash) (*objectPack, int64, error) {
+	store.packMu.RLock()
+	pack, offset := store.searchPacksLocked(id)
+	store.packMu.RUnlock()
+	if pack != nil {
+		return pack, offset, nil
+	}
+
+	store.packMu.Lock()
+	defer store.packMu.Unlock()
+	for _, dir := range store.dirs {
+		if err := dir.loadPacks(); err != nil {
+			return nil, 0, err
+		}
+	}
+	pack, offset = store.searchPacksLocked(id)
+	if pack == nil {
+		return nil, 0, os.ErrNotExist
+	}
+	return pack, offset, nil
+}
+
+func (store *ObjectStore) searchPacksLocked(id Hash) (*objectPack, int64) {
+	for _, dir := range store.dirs {
+		for _, pack := range dir.packs {
+			if i := pack.idx.FindID(id); i != -1 {
+				return pack, pack.idx.Offsets[i]
+			}
+		}
+	}
+	return nil, 0
+}
+
+// Close closes any packfiles held open by the store. It is not safe to call
+// Close concurrently with other methods, and any readers returned by Open
+// must be closed before calling Close.
+func (store *ObjectStore) Close() error {
+	var first error
+	for _, dir := range store.dirs {
+		for _, pack := range dir.packs {
+			if err := pack.f.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+		dir.packs = nil
+	}
+	return first
+}
+
+func looseObjectPath(objectsDir string, id Hash) string {
+	hex := id.String()
+	return filepath.Join(objectsDir, hex[:2], hex[2:])
+}
+
+// openLooseObject opens a zlib-compressed object in the given object
+// directory and parses its prefix.
+func openLooseObject(objectsDir string, id Hash) (object.Prefix, io.ReadCloser, error) {
+	f, err := os.Open(looseObjectPath(objectsDir, id))
+	if err != nil {
+		return object.Prefix{}, nil, err
+	}
+	zr, err := zlib.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return object.Prefix{}, nil, fmt.Errorf("loose object: %w", err)
+	}
+	br := bufio.NewReader(zr)
+	// The longest prefix is "commit 9223372036854775807\x00".
+	const maxPrefixLen = 32
+	var buf []byte
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			zr.Close()
+			f.Close()
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return object.Prefix{}, nil, fmt.Errorf("loose object: read prefix: %w", err)
+		}
+		buf = append(buf, c)
+		if c == 0 {
+			break
+		}
+		if len(buf) >= maxPrefixLen {
+			zr.Close()
+			f.Close()
+			return object.Prefix{}, nil, errors.New("loose object: prefix too long")
+		}
+	}
+	var prefix object.Prefix
+	if err := prefix.UnmarshalBinary(buf); err != nil {
+		zr.Close()
+		f.Close()
+		return object.Prefix{}, nil, fmt.Errorf("loose object: %w", err)
+	}
+	return prefix, &looseObjectReader{
+		r:  io.LimitReader(br, prefix.Size),
+		zr: zr,
+		f:  f,
+	}, nil
+}
+
+type looseObjectReader struct {
+	r  io.Reader
+	zr io.Closer
+	f  *os.File
+}
+
+func (lr *looseObjectReader) Read(p []byte) (int, error) {
+	return lr.r.Read(p)
+}
+
+func (lr *looseObjectReader) Close() error {
+	lr.zr.Close()
+	return lr.f.Close()
+}
+
+type packedObjectReader struct {
+	r    io.Reader
+	u    *packfile.Undeltifier
+	pool *sync.Pool
+}
+
+func (pr *packedObjectReader) Read(p []byte) (int, error) {
+	if pr.u == nil {
+		return 0, errors.New("read from closed object")
+	}
+	return pr.r.Read(p)
+}
+
+func (pr *packedObjectReader) Close() error {
+	if pr.u == nil {
+		return nil
+	}
+	// The Undeltifier's buffers may back the reader,
+	// so it can only be reused once the caller is done.
+	pr.pool.Put(pr.u)
+	pr.u = nil
+	pr.r = nil
+	return nil
+}
+
+// statPackedObject reads the type and size of the object at the given offset
+// without expanding its delta chain.
+func statPackedObject(pack *objectPack, offset int64) (object.Prefix, error) {
+	f := packfile.NewBufferedReadSeeker(io.NewSectionReader(pack.f, 0, pack.size))
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return object.Prefix{}, err
+	}
+	hdr, err := packfile.ReadHeader(offset, f)
+	if err != nil {
+		return object.Prefix{}, err
+	}
+	if typ := hdr.Type.NonDelta(); typ != "" {
+		return object.Prefix{Type: typ, Size: hdr.Size}, nil
+	}
+
+	// The expanded size is stored at the beginning of the delta instructions.
+	// See https://git-scm.com/docs/pack-format#_deltified_representation
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return object.Prefix{}, err
+	}
+	defer zr.Close()
+	br := bufio.NewReaderSize(zr, 32)
+	if _, err := binary.ReadUvarint(br); err != nil {
+		return object.Prefix{}, fmt.Errorf("read delta header: %w", err)
+	}
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return object.Prefix{}, fmt.Errorf("read delta header: %w", err)
+	}
+	typ, err := packfile.ResolveType(f, offset, &packfile.UndeltifyOptions{Index: pack.idx})
+	if err != nil {
+		return object.Prefix{}, err
+	}
+	return object.Prefix{Type: typ, Size: int64(size)}, nil
+}
+
+// unquoteCString parses a double-quoted string that uses the C-style escapes
+// Git uses for quoting paths.
+func unquoteCString(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("unquote %s: missing quotes", s)
+	}
+	s = s[1 : len(s)-1]
+	sb := new(strings.Builder)
+	sb.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return "", fmt.Errorf("unquote %q: trailing backslash", s)
+		}
+		switch c = s[i]; c {
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'v':
+			sb.WriteByte('\v')
+		case '\\', '"':
+			sb.WriteByte(c)
+		case '0', '1', '2', '3':
+			if i+2 >= len(s) {
+				return "", fmt.Errorf("unquote %q: short octal escape", s)
+			}
+			var x byte
+			for _, d := range []byte(s[i : i+3]) {
+				if d < '0' || d > '7' {
+					return "", fmt.Errorf("unquote %q: invalid octal escape", s)
+				}
+				x = x<<3 | (d - '0')
+			}
+			sb.WriteByte(x)
+			i += 2
+		default:
+			return "", fmt.Errorf("unquote %q: unknown escape \\%c", s, c)
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"gg-scm.io/pkg/git/object"
+)
+
+func TestObjectStore(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+
+	// Content long enough that Git will store the second version as a delta
+	// of the first when packing.
+	content1 := strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 100)
+	content2 := content1 + "And then it took a nap.\n"
+
+	setup := func(t *testing.T, env *testEnv) (commit1, commit2 Hash) {
+		t.Helper()
+		if err := env.g.Init(ctx, "."); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.root.Apply(filesystem.Write("foo.txt", content1)); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.Commit(ctx, "first", CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		rev1, err := env.g.Head(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := env.root.Apply(filesystem.Write("foo.txt", content2)); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.CommitAll(ctx, "second", CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		rev2, err := env.g.Head(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rev1.Commit, rev2.Commit
+	}
+
+	check := func(t *testing.T, store *ObjectStore, commit1, commit2 Hash) {
+		t.Helper()
+		c := readCommitFromStore(t, store, commit2)
+		if len(c.Parents) != 1 || c.Parents[0] != commit1 {
+			t.Errorf("commit %v parents = %v; want [%v]", commit2, c.Parents, commit1)
+		}
+		if c.Message != "second" {
+			t.Errorf("commit %v message = %q; want \"second\"", commit2, c.Message)
+		}
+		tree := readTreeFromStore(t, store, c.Tree)
+		ent := tree.Search("foo.txt")
+		if ent == nil {
+			t.Fatalf("tree %v does not contain foo.txt", c.Tree)
+		}
+		if got := readBlobFromStore(t, store, ent.ObjectID); got != content2 {
+			t.Errorf("foo.txt @ %v = %q; want %q", commit2, got, content2)
+		}
+		if prefix, err := store.Stat(ent.ObjectID); err != nil {
+			t.Error("Stat:", err)
+		} else if want := (object.Prefix{Type: object.TypeBlob, Size: int64(len(content2))}); prefix != want {
+			t.Errorf("Stat(%v) = %v; want %v", ent.ObjectID, prefix, want)
+		}
+
+		c = readCommitFromStore(t, store, commit1)
+		tree = readTreeFromStore(t, store, c.Tree)
+		ent = tree.Search("foo.txt")
+		if ent == nil {
+			t.Fatalf("tree %v does not contain foo.txt", c.Tree)
+		}
+		if got := readBlobFromStore(t, store, ent.ObjectID); got != content1 {
+			t.Errorf("foo.txt @ %v = %q; want %q", commit1, got, content1)
+		}
+
+		missing := Hash{0xde, 0xad, 0xbe, 0xef}
+		if _, _, err := store.Open(missing); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Open(%v) error = %v; want %v", missing, err, os.ErrNotExist)
+		}
+		if store.Has(missing) {
+			t.Errorf("Has(%v) = true; want false", missing)
+		}
+		if !store.Has(commit1) {
+			t.Errorf("Has(%v) = false; want true", commit1)
+		}
+	}
+
+	t.Run("Loose", func(t *testing.T) {
+		env, err := newTestEnv(ctx, gitPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer env.cleanup()
+		commit1, commit2 := setup(t, env)
+
+		store, err := env.g.OpenObjectStore(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		check(t, store, commit1, commit2)
+	})
+
+	t.Run("Packed", func(t *testing.T) {
+		env, err := newTestEnv(ctx, gitPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer env.cleanup()
+		commit1, commit2 := setup(t, env)
+		if err := env.g.Run(ctx, "repack", "-a", "-d", "-f", "-q"); err != nil {
+			t.Fatal(err)
+		}
+
+		store, err := env.g.OpenObjectStore(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		check(t, store, commit1, commit2)
+	})
+
+	t.Run("PackedAfterOpen", func(t *testing.T) {
+		env, err := newTestEnv(ctx, gitPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer env.cleanup()
+		commit1, commit2 := setup(t, env)
+
+		store, err := env.g.OpenObjectStore(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		if err := env.g.Run(ctx, "repack", "-a", "-d", "-f", "-q"); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.Run(ctx, "prune-packed"); err != nil {
+			t.Fatal(err)
+		}
+		check(t, store, commit1, commit2)
+	})
+
+	t.Run("Alternates", func(t *testing.T) {
+		env, err := newTestEnv(ctx, gitPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer env.cleanup()
+		commit1, commit2 := setup(t, env)
+		if err := env.g.Run(ctx, "clone", "--quiet", "--shared", ".", "shared"); err != nil {
+			t.Fatal(err)
+		}
+
+		store, err := env.g.WithDir("shared").OpenObjectStore(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		check(t, store, commit1, commit2)
+	})
+}
+
+func readCommitFromStore(t *testing.T, store *ObjectStore, id Hash) *object.Commit {
+	t.Helper()
+	data := readObjectFromStore(t, store, id, object.TypeCommit)
+	c, err := object.ParseCommit(data)
+	if err != nil {
+		t.Fatalf("commit %v: %v", id, err)
+	}
+	return c
+}
+
+func readTreeFromStore(t *testing.T, store *ObjectStore, id Hash) object.Tree {
+	t.Helper()
+	data := readObjectFromStore(t, store, id, object.TypeTree)
+	tree, err := object.ParseTree(data)
+	if err != nil {
+		t.Fatalf("tree %v: %v", id, err)
+	}
+	return tree
+}
+
+func readBlobFromStore(t *testing.T, store *ObjectStore, id Hash) string {
+	t.Helper()
+	return string(readObjectFromStore(t, store, id, object.TypeBlob))
+}
+
+func readObjectFromStore(t *testing.T, store *ObjectStore, id Hash, want object.Type) []byte {
+	t.Helper()
+	prefix, r, err := store.Open(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if prefix.Type != want {
+		t.Fatalf("object %v is a %v; want %v", id, prefix.Type, want)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read object %v: %v", id, err)
+	}
+	if int64(len(data)) != prefix.Size {
+		t.Fatalf("object %v has %d bytes; prefix says %d", id, len(data), prefix.Size)
+	}
+	return data
+}
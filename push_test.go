@@ -0,0 +1,240 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePushPorcelain(t *testing.T) {
+	const (
+		hash1 = "0123456789abcdef0123456789abcdef01234567"
+		hash2 = "89abcdef0123456789abcdef0123456789abcdef"
+	)
+	tests := []struct {
+		name    string
+		out     string
+		want    []*RefUpdate
+		wantErr bool
+	}{
+		{name: "Empty", out: ""},
+		{
+			name: "Mixed",
+			out: "To /path/to/repo.git\n" +
+				" \trefs/heads/main:refs/heads/main\t" + hash1 + ".." + hash2 + "\n" +
+				"+\trefs/heads/feature:refs/heads/feature\t" + hash2 + "..." + hash1 + " (forced update)\n" +
+				"*\trefs/heads/new:refs/heads/new\t[new branch]\n" +
+				"-\t:refs/heads/old\t[deleted]\n" +
+				"=\trefs/tags/v1:refs/tags/v1\t[up to date]\n" +
+				"!\trefs/heads/stale:refs/heads/stale\t[rejected] (non-fast-forward)\n" +
+				"!\trefs/heads/hooked:refs/heads/hooked\t[remote rejected] (pre-receive hook declined)\n" +
+				"Done\n",
+			want: []*RefUpdate{
+				{Src: "refs/heads/main", Ref: "refs/heads/main", OldHash: hashLiteral(hash1), NewHash: hashLiteral(hash2), Status: RefFastForward},
+				{Src: "refs/heads/feature", Ref: "refs/heads/feature", OldHash: hashLiteral(hash2), NewHash: hashLiteral(hash1), Status: RefForcedUpdate, Reason: "forced update"},
+				{Src: "refs/heads/new", Ref: "refs/heads/new", Status: RefNew},
+				{Ref: "refs/heads/old", Status: RefDeleted},
+				{Src: "refs/tags/v1", Ref: "refs/tags/v1", Status: RefUpToDate},
+				{Src: "refs/heads/stale", Ref: "refs/heads/stale", Status: RefRejected, Reason: "non-fast-forward"},
+				{Src: "refs/heads/hooked", Ref: "refs/heads/hooked", Status: RefRejected, Reason: "pre-receive hook declined"},
+			},
+		},
+		{
+			name: "AbbreviatedHashes",
+			out:  " \trefs/heads/main:refs/heads/main\t0123456..89abcde\n",
+			want: []*RefUpdate{
+				{Src: "refs/heads/main", Ref: "refs/heads/main", Status: RefFastForward},
+			},
+		},
+		{
+			name:    "BadFlag",
+			out:     "?\trefs/heads/main:refs/heads/main\t[new branch]\n",
+			wantErr: true,
+		},
+		{
+			name:    "MissingRefs",
+			out:     "*\trefs/heads/main\t[new branch]\n",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parsePushPorcelain(test.out)
+			if err != nil {
+				if !test.wantErr {
+					t.Fatal(err)
+				}
+				return
+			}
+			if test.wantErr {
+				t.Fatal("parsePushPorcelain did not return an error")
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("parsePushPorcelain(...) (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPush(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	// Create repository A with a commit and clone it to a bare repository B.
+	if err := env.g.Init(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	gitA := env.g.WithDir("a")
+	if err := env.root.Apply(filesystem.Write("a/foo.txt", dummyContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitA.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitA.Commit(ctx, "First commit", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	rev1, err := gitA.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CloneBare(ctx, URLFromPath("a"), CloneOptions{Dir: "b.git"}); err != nil {
+		t.Fatal(err)
+	}
+	gitB := env.g.WithDir("b.git")
+
+	// Make a new commit in A and push it with a new branch.
+	if err := env.root.Apply(filesystem.Write("a/foo.txt", "Goodbye, World!\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitA.CommitAll(ctx, "Second commit", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	rev2, err := gitA.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := gitA.Push(ctx, "../b.git", PushOptions{
+		Refspecs: []string{
+			rev2.Ref.String() + ":" + rev2.Ref.String(),
+			rev2.Ref.String() + ":refs/heads/feature",
+		},
+		Atomic: true,
+	})
+	if err != nil {
+		t.Fatal("Push:", err)
+	}
+	want := []*RefUpdate{
+		{
+			Src:     rev2.Ref.String(),
+			Ref:     rev2.Ref,
+			OldHash: rev1.Commit,
+			NewHash: rev2.Commit,
+			Status:  RefFastForward,
+		},
+		{
+			Src:     rev2.Ref.String(),
+			Ref:     "refs/heads/feature",
+			NewHash: rev2.Commit,
+			Status:  RefNew,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("first Push (-want +got):\n%s", diff)
+	}
+	if r, err := gitB.ParseRev(ctx, "refs/heads/feature"); err != nil {
+		t.Error(err)
+	} else if r.Commit != rev2.Commit {
+		t.Errorf("b.git feature = %v; want %v", r.Commit, rev2.Commit)
+	}
+
+	// Force-push with a stale lease. It should be rejected.
+	got, err = gitA.Push(ctx, "../b.git", PushOptions{
+		Refspecs:       []string{rev1.Commit.String() + ":refs/heads/feature"},
+		ForceWithLease: map[Ref]Hash{"refs/heads/feature": rev1.Commit},
+	})
+	if err == nil {
+		t.Error("Push with stale lease did not return an error")
+	}
+	if len(got) != 1 || got[0].Status != RefRejected || got[0].Ref != "refs/heads/feature" {
+		t.Errorf("Push with stale lease = %+v; want single rejection of refs/heads/feature", got)
+	}
+
+	// Force-push with the correct lease.
+	got, err = gitA.Push(ctx, "../b.git", PushOptions{
+		Refspecs:       []string{rev1.Commit.String() + ":refs/heads/feature"},
+		ForceWithLease: map[Ref]Hash{"refs/heads/feature": rev2.Commit},
+	})
+	if err != nil {
+		t.Fatal("Push with lease:", err)
+	}
+	want = []*RefUpdate{
+		{
+			Src:     rev1.Commit.String(),
+			Ref:     "refs/heads/feature",
+			OldHash: rev2.Commit,
+			NewHash: rev1.Commit,
+			Status:  RefForcedUpdate,
+			Reason:  "forced update",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Push with lease (-want +got):\n%s", diff)
+	}
+
+	// Push an annotated tag. The remote ref should point to the tag object,
+	// not the tagged commit.
+	if err := gitA.Run(ctx, "tag", "-a", "-m", "Release", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	tagHex, err := gitA.Output(ctx, "rev-parse", "refs/tags/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagHash, err := ParseHash(strings.TrimSuffix(tagHex, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = gitA.Push(ctx, "../b.git", PushOptions{
+		Refspecs: []string{"refs/tags/v1:refs/tags/v1"},
+	})
+	if err != nil {
+		t.Fatal("Push tag:", err)
+	}
+	want = []*RefUpdate{
+		{
+			Src:     "refs/tags/v1",
+			Ref:     "refs/tags/v1",
+			NewHash: tagHash,
+			Status:  RefNew,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Push tag (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// RebaseOptions specifies the command-line options for `git rebase`.
+type RebaseOptions struct {
+	// Upstream is the revision to compare against. Commits reachable from
+	// HEAD but not from Upstream are rebased. If empty, the current branch's
+	// configured upstream is used.
+	Upstream string
+	// Onto is the revision to rebase the commits onto.
+	// If empty, Upstream is used.
+	Onto string
+
+	// If Autosquash is true, then commits whose summaries begin with
+	// "squash! " or "fixup! " are moved after and combined with the commit
+	// they name. Autosquash cannot be combined with Todo.
+	Autosquash bool
+
+	// Todo replaces the list of commits Git would rebase. If Todo is nil,
+	// then all the commits between Upstream and HEAD are picked in order.
+	Todo []RebaseStep
+}
+
+// A RebaseStep is a single instruction in a rebase todo list.
+type RebaseStep struct {
+	Action RebaseAction
+	Commit Hash
+	// Message is the new commit message for RebaseReword.
+	// A trailing newline is added if it does not have one.
+	// It is ignored for other actions.
+	Message string
+}
+
+// RebaseAction specifies how a commit in a rebase todo list is applied.
+type RebaseAction int
+
+// Rebase actions.
+const (
+	// RebasePick applies the commit as-is.
+	RebasePick RebaseAction = iota
+	// RebaseDrop removes the commit.
+	RebaseDrop
+	// RebaseSquash melds the commit into the previous commit, combining
+	// their messages.
+	RebaseSquash
+	// RebaseFixup melds the commit into the previous commit, keeping only
+	// the previous commit's message.
+	RebaseFixup
+	// RebaseReword applies the commit with the step's Message.
+	RebaseReword
+)
+
+// String returns the Go constant name of the action.
+func (a RebaseAction) String() string {
+	switch a {
+	case RebasePick:
+		return "RebasePick"
+	case RebaseDrop:
+		return "RebaseDrop"
+	case RebaseSquash:
+		return "RebaseSquash"
+	case RebaseFixup:
+		return "RebaseFixup"
+	case RebaseReword:
+		return "RebaseReword"
+	default:
+		return fmt.Sprintf("RebaseAction(%d)", int(a))
+	}
+}
+
+// Rebase reapplies the current branch's commits on top of another commit.
+// If a commit cannot be applied cleanly, Rebase returns a *ConflictError
+// and leaves the rebase in progress. The caller can then resolve the
+// conflicts and call ContinueRebase, or call SkipRebase or AbortRebase.
+func (g *Git) Rebase(ctx context.Context, opts RebaseOptions) error {
+	errPrefix := "git rebase"
+	if opts.Upstream != "" {
+		errPrefix += " " + opts.Upstream
+		if err := validateRev(opts.Upstream); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	if opts.Onto != "" {
+		if err := validateRev(opts.Onto); err != nil {
+			return fmt.Errorf("%s: onto: %w", errPrefix, err)
+		}
+	}
+	if opts.Autosquash && opts.Todo != nil {
+		return fmt.Errorf("%s: Autosquash cannot be used with Todo", errPrefix)
+	}
+	args := []string{"rebase", "--quiet"}
+	var env []string
+	switch {
+	case opts.Todo != nil:
+		todo, err := formatRebaseTodo(opts.Todo)
+		if err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		// Git invokes the sequence editor through the shell with the
+		// todo file path as the argument. Overwrite it with our list.
+		// The list can be too long for a command-line argument,
+		// so copy it from a file.
+		todoPath, err := g.writeRebaseTodo(ctx, todo)
+		if err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		defer os.Remove(todoPath)
+		args = append(args, "--interactive")
+		env = append(env, "GIT_SEQUENCE_EDITOR=cp "+shellQuote(todoPath))
+	case opts.Autosquash:
+		// Autosquash only takes effect for interactive rebases.
+		args = append(args, "--interactive", "--autosquash")
+		env = append(env, "GIT_SEQUENCE_EDITOR=:")
+	}
+	if opts.Onto != "" {
+		args = append(args, "--onto="+opts.Onto)
+	}
+	if opts.Upstream != "" {
+		args = append(args, opts.Upstream)
+	}
+	return g.runSequencer(ctx, errPrefix, args, env, "REBASE_HEAD")
+}
+
+// ContinueRebase continues a rebase that stopped because of conflicts
+// after the caller has resolved them and staged the result. Like Rebase,
+// it returns a *ConflictError if a later commit cannot be applied cleanly.
+func (g *Git) ContinueRebase(ctx context.Context) error {
+	return g.runSequencer(ctx, "git rebase --continue", []string{"rebase", "--continue"}, nil, "REBASE_HEAD")
+}
+
+// SkipRebase skips the commit that a rebase stopped on and continues
+// with the rest of the commits. Like Rebase, it returns a *ConflictError
+// if a later commit cannot be applied cleanly.
+func (g *Git) SkipRebase(ctx context.Context) error {
+	return g.runSequencer(ctx, "git rebase --skip", []string{"rebase", "--skip"}, nil, "REBASE_HEAD")
+}
+
+// AbortRebase stops the rebase in progress and restores the branch to
+// its state before the rebase started.
+func (g *Git) AbortRebase(ctx context.Context) error {
+	return g.run(ctx, "git rebase --abort", []string{"rebase", "--abort"})
+}
+
+// writeRebaseTodo writes a rebase todo list to a new temporary file in the
+// Git directory and returns its path.
+func (g *Git) writeRebaseTodo(ctx context.Context, todo string) (string, error) {
+	gitDir, err := g.GitDir(ctx)
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(gitDir, "gg-rebase-todo")
+	if err != nil {
+		return "", err
+	}
+	_, writeErr := io.WriteString(f, todo)
+	closeErr := f.Close()
+	if writeErr != nil {
+		os.Remove(f.Name())
+		return "", writeErr
+	}
+	if closeErr != nil {
+		os.Remove(f.Name())
+		return "", closeErr
+	}
+	return f.Name(), nil
+}
+
+// formatRebaseTodo formats steps in the format of a rebase todo file.
+func formatRebaseTodo(steps []RebaseStep) (string, error) {
+	if len(steps) == 0 {
+		// An empty todo list would abort the rebase.
+		return "noop\n", nil
+	}
+	sb := new(strings.Builder)
+	for _, step := range steps {
+		if step.Commit == (Hash{}) {
+			return "", errors.New("todo step has zero commit")
+		}
+		switch step.Action {
+		case RebasePick:
+			fmt.Fprintf(sb, "pick %v\n", step.Commit)
+		case RebaseDrop:
+			fmt.Fprintf(sb, "drop %v\n", step.Commit)
+		case RebaseSquash:
+			fmt.Fprintf(sb, "squash %v\n", step.Commit)
+		case RebaseFixup:
+			fmt.Fprintf(sb, "fixup %v\n", step.Commit)
+		case RebaseReword:
+			if step.Message == "" {
+				return "", fmt.Errorf("reword %v: empty message", step.Commit)
+			}
+			// A "reword" line would open an editor, so pick the commit and
+			// amend its message. Todo lines cannot span multiple lines,
+			// so each message line is a separate printf argument.
+			fmt.Fprintf(sb, "pick %v\nexec printf '%%s\\n'", step.Commit)
+			for _, line := range strings.Split(strings.TrimSuffix(step.Message, "\n"), "\n") {
+				sb.WriteString(" ")
+				sb.WriteString(shellQuote(line))
+			}
+			sb.WriteString(" | git commit --amend --quiet --no-verify --cleanup=verbatim --file=-\n")
+		default:
+			return "", fmt.Errorf("unknown action %v for %v", step.Action, step.Commit)
+		}
+	}
+	return sb.String(), nil
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
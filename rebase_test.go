@@ -0,0 +1,243 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRebase(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	// Create a repository with a base commit, a "main" branch with one
+	// more commit, and a "feature" branch with three commits on top of base.
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	commitFile := func(name, content, message string) Hash {
+		t.Helper()
+		if err := env.root.Apply(filesystem.Write(name, content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.Add(ctx, []Pathspec{Pathspec(name)}, AddOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.Commit(ctx, message, CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		rev, err := env.g.Head(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rev.Commit
+	}
+	commitFile("base.txt", "base\n", "base")
+	if err := env.g.NewBranch(ctx, "feature", BranchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	mainCommit := commitFile("main.txt", "main\n", "main change")
+	if err := env.g.CheckoutBranch(ctx, "feature", CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	a := commitFile("a.txt", "a\n", "add a")
+	b := commitFile("b.txt", "b\n", "add b")
+	c := commitFile("a.txt", "a\nmore a\n", "fixup! add a")
+	if err := env.g.Run(ctx, "tag", "feature-start"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Todo", func(t *testing.T) {
+		if err := env.g.Run(ctx, "reset", "--quiet", "--hard", "feature-start"); err != nil {
+			t.Fatal(err)
+		}
+		err := env.g.Rebase(ctx, RebaseOptions{
+			Upstream: "main",
+			Todo: []RebaseStep{
+				{Action: RebaseReword, Commit: a, Message: "add a\n\nWith 'quotes'."},
+				{Action: RebaseFixup, Commit: c},
+				{Action: RebaseDrop, Commit: b},
+			},
+		})
+		if err != nil {
+			t.Fatal("Rebase:", err)
+		}
+		head, err := env.g.CommitInfo(ctx, "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "add a\n\nWith 'quotes'.\n"; head.Message != want {
+			t.Errorf("HEAD message = %q; want %q", head.Message, want)
+		}
+		if len(head.Parents) != 1 || head.Parents[0] != mainCommit {
+			t.Errorf("HEAD parents = %v; want [%v]", head.Parents, mainCommit)
+		}
+		if got, err := env.root.ReadFile("a.txt"); err != nil {
+			t.Error(err)
+		} else if got != "a\nmore a\n" {
+			t.Errorf("a.txt = %q; want \"a\\nmore a\\n\"", got)
+		}
+		if exists, err := env.root.Exists("b.txt"); err != nil {
+			t.Error(err)
+		} else if exists {
+			t.Error("b.txt exists after dropping its commit")
+		}
+	})
+
+	t.Run("LongTodo", func(t *testing.T) {
+		if err := env.g.Run(ctx, "reset", "--quiet", "--hard", "feature-start"); err != nil {
+			t.Fatal(err)
+		}
+		// Write a todo list longer than the maximum size of a single
+		// command-line argument on Linux (128 KiB).
+		todo := []RebaseStep{{Action: RebasePick, Commit: a}}
+		for len(todo) < 3000 {
+			todo = append(todo, RebaseStep{Action: RebaseDrop, Commit: b})
+		}
+		if err := env.g.Rebase(ctx, RebaseOptions{Upstream: "main", Todo: todo}); err != nil {
+			t.Fatal("Rebase:", err)
+		}
+		head, err := env.g.CommitInfo(ctx, "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if head.Message != "add a" {
+			t.Errorf("HEAD message = %q; want \"add a\"", head.Message)
+		}
+		if len(head.Parents) != 1 || head.Parents[0] != mainCommit {
+			t.Errorf("HEAD parents = %v; want [%v]", head.Parents, mainCommit)
+		}
+	})
+
+	t.Run("Autosquash", func(t *testing.T) {
+		if err := env.g.Run(ctx, "reset", "--quiet", "--hard", "feature-start"); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.Rebase(ctx, RebaseOptions{Upstream: "main", Autosquash: true}); err != nil {
+			t.Fatal("Rebase:", err)
+		}
+		head, err := env.g.CommitInfo(ctx, "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if head.Message != "add b" {
+			t.Errorf("HEAD message = %q; want \"add b\"", head.Message)
+		}
+		parent, err := env.g.CommitInfo(ctx, "HEAD~")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parent.Message != "add a" {
+			t.Errorf("HEAD~ message = %q; want \"add a\"", parent.Message)
+		}
+		if len(parent.Parents) != 1 || parent.Parents[0] != mainCommit {
+			t.Errorf("HEAD~ parents = %v; want [%v]", parent.Parents, mainCommit)
+		}
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		if err := env.g.Run(ctx, "reset", "--quiet", "--hard", "feature-start"); err != nil {
+			t.Fatal(err)
+		}
+		// Move b.txt's commit onto a commit that also adds b.txt.
+		if err := env.g.NewBranch(ctx, "conflict", BranchOptions{StartPoint: "main", Checkout: true}); err != nil {
+			t.Fatal(err)
+		}
+		commitFile("b.txt", "conflict\n", "conflicting b")
+		if err := env.g.CheckoutBranch(ctx, "feature", CheckoutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		err := env.g.Rebase(ctx, RebaseOptions{Upstream: "main", Onto: "conflict"})
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("Rebase(...) = %v; want *ConflictError", err)
+		}
+		if conflict.Commit != b {
+			t.Errorf("conflict.Commit = %v; want %v", conflict.Commit, b)
+		}
+		if diff := cmp.Diff([]TopPath{"b.txt"}, conflict.Paths); diff != "" {
+			t.Errorf("conflict.Paths (-want +got):\n%s", diff)
+		}
+
+		if err := env.g.SkipRebase(ctx); err != nil {
+			t.Fatal("SkipRebase:", err)
+		}
+		head, err := env.g.CommitInfo(ctx, "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if head.Message != "fixup! add a" {
+			t.Errorf("HEAD message = %q; want \"fixup! add a\"", head.Message)
+		}
+	})
+
+	t.Run("ContinueAndAbort", func(t *testing.T) {
+		if err := env.g.Run(ctx, "reset", "--quiet", "--hard", "feature-start"); err != nil {
+			t.Fatal(err)
+		}
+		err := env.g.Rebase(ctx, RebaseOptions{Upstream: "main", Onto: "conflict"})
+		if !errors.As(err, new(*ConflictError)) {
+			t.Fatalf("Rebase(...) = %v; want *ConflictError", err)
+		}
+		if err := env.root.Apply(filesystem.Write("b.txt", "resolved\n")); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.Add(ctx, []Pathspec{"b.txt"}, AddOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.ContinueRebase(ctx); err != nil {
+			t.Fatal("ContinueRebase:", err)
+		}
+		if got, err := env.root.ReadFile("b.txt"); err != nil {
+			t.Error(err)
+		} else if got != "resolved\n" {
+			t.Errorf("b.txt = %q; want \"resolved\\n\"", got)
+		}
+
+		if err := env.g.Run(ctx, "reset", "--quiet", "--hard", "feature-start"); err != nil {
+			t.Fatal(err)
+		}
+		err = env.g.Rebase(ctx, RebaseOptions{Upstream: "main", Onto: "conflict"})
+		if !errors.As(err, new(*ConflictError)) {
+			t.Fatalf("Rebase(...) = %v; want *ConflictError", err)
+		}
+		if err := env.g.AbortRebase(ctx); err != nil {
+			t.Fatal("AbortRebase:", err)
+		}
+		head, err := env.g.Head(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if head.Commit != c {
+			t.Errorf("after AbortRebase, HEAD = %v; want %v", head.Commit, c)
+		}
+	})
+}
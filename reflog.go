@@ -0,0 +1,355 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gg-scm.io/pkg/git/object"
+)
+
+// A ReflogEntry is a single change to a ref recorded in its reflog.
+type ReflogEntry struct {
+	// OldHash is the value of the ref before the change.
+	// It is zero if the ref was created.
+	OldHash Hash
+	// NewHash is the value of the ref after the change.
+	// It is zero if the ref was deleted.
+	NewHash Hash
+	// Committer is the user that made the change.
+	Committer object.User
+	// Time is the time of the change.
+	Time time.Time
+	// Message describes the change, like "commit: Fix bug".
+	Message string
+}
+
+// ReflogOptions specifies filters and ordering on a reflog listing.
+type ReflogOptions struct {
+	// Limit specifies the upper bound on the number of entries to return
+	// from Reflog. Zero means no limit.
+	Limit int
+	// If Reverse is true, then entries are returned oldest first.
+	// Otherwise, entries are returned newest first, like `git reflog`.
+	Reverse bool
+}
+
+// Reflog starts reading the reflog of the given ref. The ref must be HEAD or
+// a full ref name like "refs/heads/main". If the ref does not have a reflog,
+// then the Reflog has no entries. It is the caller's responsibility to call
+// Close on the returned Reflog.
+//
+// Reflog reads the reflog files from the Git directory, so it does not
+// support repositories that use the reftable ref storage format.
+func (g *Git) Reflog(ctx context.Context, ref Ref, opts ReflogOptions) (*Reflog, error) {
+	errPrefix := fmt.Sprintf("read reflog %q", ref)
+	if ref != Head && !(strings.HasPrefix(ref.String(), "refs/") && ref.IsValid()) {
+		return nil, fmt.Errorf("%s: not HEAD or a full ref name", errPrefix)
+	}
+	var dir string
+	var err error
+	if isPerWorktreeRef(ref) {
+		dir, err = g.GitDir(ctx)
+	} else {
+		dir, err = g.CommonDir(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	f, err := os.Open(g.fs.Join(dir, "logs", ref.String()))
+	if os.IsNotExist(err) {
+		return &Reflog{errPrefix: errPrefix, scanDone: true}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	rl, err := newReflog(errPrefix, f, opts)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return rl, nil
+}
+
+// newReflog returns a Reflog that reads from the given file.
+func newReflog(errPrefix string, f *os.File, opts ReflogOptions) (*Reflog, error) {
+	rl := &Reflog{
+		errPrefix: errPrefix,
+		f:         f,
+		limit:     opts.Limit,
+		reverse:   opts.Reverse,
+	}
+	if opts.Reverse {
+		rl.r = bufio.NewReader(f)
+	} else {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		rl.off = info.Size()
+	}
+	return rl, nil
+}
+
+// isPerWorktreeRef reports whether the ref is stored in a worktree's
+// Git directory rather than the repository's common directory.
+func isPerWorktreeRef(ref Ref) bool {
+	return ref == Head ||
+		strings.HasPrefix(ref.String(), "refs/worktree/") ||
+		strings.HasPrefix(ref.String(), "refs/bisect/") ||
+		strings.HasPrefix(ref.String(), "refs/rewritten/")
+}
+
+// Reflog is an open handle to a reflog file.
+type Reflog struct {
+	errPrefix string
+	f         *os.File
+	limit     int
+	reverse   bool
+
+	// r is used to read the file forward when reverse is true.
+	r *bufio.Reader
+	// buf and off are used to read the file backward when reverse is false.
+	// buf holds the unread data that starts at file offset off.
+	buf []byte
+	off int64
+
+	scanErr  error
+	scanDone bool
+	n        int
+	entry    *ReflogEntry
+}
+
+// reflogChunkSize is the number of bytes read at a time when reading a
+// reflog file backward.
+const reflogChunkSize = 32 << 10 // 32 KiB
+
+// Next attempts to scan the next reflog entry and returns whether there is
+// a new entry.
+func (rl *Reflog) Next() bool {
+	if rl.scanDone {
+		return false
+	}
+	if rl.limit > 0 && rl.n >= rl.limit {
+		rl.scanDone = true
+		rl.entry = nil
+		return false
+	}
+	err := rl.next()
+	if err != nil {
+		rl.scanErr = err
+		if errors.Is(err, io.EOF) {
+			rl.scanErr = nil
+		}
+		rl.scanDone = true
+		rl.entry = nil
+		return false
+	}
+	rl.n++
+	return true
+}
+
+func (rl *Reflog) next() error {
+	for {
+		var line []byte
+		var err error
+		if rl.reverse {
+			line, err = rl.r.ReadBytes('\n')
+			if len(line) > 0 && errors.Is(err, io.EOF) {
+				err = nil
+			}
+		} else {
+			line, err = rl.prevLine()
+		}
+		if err != nil {
+			return err
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if len(line) == 0 {
+			continue
+		}
+		rl.entry, err = parseReflogLine(line)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rl.errPrefix, err)
+		}
+		return nil
+	}
+}
+
+// prevLine returns the last line in the unread portion of the file,
+// without its trailing newline.
+func (rl *Reflog) prevLine() ([]byte, error) {
+	for {
+		if i := bytes.LastIndexByte(rl.buf, '\n'); i != -1 {
+			line := rl.buf[i+1:]
+			rl.buf = rl.buf[:i]
+			return line, nil
+		}
+		if rl.off == 0 {
+			if len(rl.buf) == 0 {
+				return nil, io.EOF
+			}
+			line := rl.buf
+			rl.buf = nil
+			return line, nil
+		}
+		n := int64(reflogChunkSize)
+		if n > rl.off {
+			n = rl.off
+		}
+		rl.off -= n
+		chunk := make([]byte, int(n)+len(rl.buf))
+		if _, err := rl.f.ReadAt(chunk[:n], rl.off); err != nil {
+			return nil, fmt.Errorf("%s: %w", rl.errPrefix, err)
+		}
+		copy(chunk[n:], rl.buf)
+		rl.buf = chunk
+	}
+}
+
+// parseReflogLine parses a single line of a reflog file.
+//
+// Reference: https://git-scm.com/docs/git-update-ref#_logging_updates
+func parseReflogLine(line []byte) (*ReflogEntry, error) {
+	ent := new(ReflogEntry)
+	if i := bytes.IndexByte(line, '\t'); i != -1 {
+		ent.Message = string(line[i+1:])
+		line = line[:i]
+	}
+	if len(line) < hashHexSize*2+2 || line[hashHexSize] != ' ' || line[hashHexSize*2+1] != ' ' {
+		return nil, fmt.Errorf("invalid entry %q", line)
+	}
+	var err error
+	ent.OldHash, err = ParseHash(string(line[:hashHexSize]))
+	if err != nil {
+		return nil, fmt.Errorf("old hash: %w", err)
+	}
+	ent.NewHash, err = ParseHash(string(line[hashHexSize+1 : hashHexSize*2+1]))
+	if err != nil {
+		return nil, fmt.Errorf("new hash: %w", err)
+	}
+	ident := line[hashHexSize*2+2:]
+	tzStart := bytes.LastIndexByte(ident, ' ')
+	if tzStart == -1 {
+		return nil, fmt.Errorf("invalid identity %q", ident)
+	}
+	timestampStart := bytes.LastIndexByte(ident[:tzStart], ' ')
+	if timestampStart == -1 {
+		return nil, fmt.Errorf("invalid identity %q", ident)
+	}
+	unix, err := strconv.ParseInt(string(ident[timestampStart+1:tzStart]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp: %w", err)
+	}
+	ent.Time, err = blameTime(unix, string(ident[tzStart+1:]))
+	if err != nil {
+		return nil, err
+	}
+	ent.Committer = object.User(ident[:timestampStart])
+	return ent, nil
+}
+
+// Entry returns the most recently scanned reflog entry.
+// Next must be called at least once before calling Entry.
+func (rl *Reflog) Entry() *ReflogEntry {
+	return rl.entry
+}
+
+// Close closes the reflog file.
+// Close returns an error if Next returned false due to a parse failure.
+func (rl *Reflog) Close() error {
+	rl.scanDone = true // Bail early for future calls to Next.
+	if rl.f != nil {
+		rl.f.Close()
+		rl.f = nil
+	}
+	return rl.scanErr
+}
+
+// ResolveReflogIndex returns the value of the ref n changes ago,
+// like the revision "ref@{n}". ResolveReflogIndex(ctx, ref, 0) returns the
+// ref's most recently logged value.
+func (g *Git) ResolveReflogIndex(ctx context.Context, ref Ref, n int) (Hash, error) {
+	errPrefix := fmt.Sprintf("resolve %s@{%d}", ref, n)
+	if n < 0 {
+		return Hash{}, fmt.Errorf("%s: negative index", errPrefix)
+	}
+	rl, err := g.Reflog(ctx, ref, ReflogOptions{})
+	if err != nil {
+		return Hash{}, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	defer rl.Close()
+	var last *ReflogEntry
+	for i := 0; rl.Next(); i++ {
+		last = rl.Entry()
+		if i == n {
+			return last.NewHash, nil
+		}
+	}
+	if err := rl.Close(); err != nil {
+		return Hash{}, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if last == nil {
+		return Hash{}, fmt.Errorf("%s: reflog is empty", errPrefix)
+	}
+	if n == rl.n && last.OldHash != (Hash{}) {
+		// One past the oldest entry is the value before the oldest change.
+		return last.OldHash, nil
+	}
+	return Hash{}, fmt.Errorf("%s: reflog only has %d entries", errPrefix, rl.n)
+}
+
+// ResolveReflogTime returns the value of the ref at the given time,
+// like the revision "ref@{date}". If t is before the oldest entry in the
+// reflog, then ResolveReflogTime returns the value of the ref before the
+// oldest logged change (or after it, if the change created the ref),
+// as Git does.
+func (g *Git) ResolveReflogTime(ctx context.Context, ref Ref, t time.Time) (Hash, error) {
+	errPrefix := fmt.Sprintf("resolve %s@{%s}", ref, t.Format(time.RFC3339))
+	rl, err := g.Reflog(ctx, ref, ReflogOptions{})
+	if err != nil {
+		return Hash{}, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	defer rl.Close()
+	var last *ReflogEntry
+	for rl.Next() {
+		last = rl.Entry()
+		if !last.Time.After(t) {
+			return last.NewHash, nil
+		}
+	}
+	if err := rl.Close(); err != nil {
+		return Hash{}, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if last == nil {
+		return Hash{}, fmt.Errorf("%s: reflog is empty", errPrefix)
+	}
+	if last.OldHash == (Hash{}) {
+		// The ref was created by the oldest change.
+		return last.NewHash, nil
+	}
+	return last.OldHash, nil
+}
@@ -0,0 +1,270 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"gg-scm.io/pkg/git/object"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReflog(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "symbolic-ref", "HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	const committer object.User = "Octo Cat <noreply@github.com>"
+	baseTime := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.FixedZone("-0800", -8*60*60))
+	var revs []Hash
+	for i, content := range []string{"v1\n", "v2\n", "v3\n"} {
+		if err := env.root.Apply(filesystem.Write("foo.txt", content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		err := env.g.Commit(ctx, fmt.Sprintf("commit %d", i+1), CommitOptions{
+			Committer:  committer,
+			CommitTime: baseTime.Add(time.Duration(i) * time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rev, err := env.g.Head(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs = append(revs, rev.Commit)
+	}
+	want := []*ReflogEntry{
+		{
+			OldHash:   revs[1],
+			NewHash:   revs[2],
+			Committer: committer,
+			Time:      baseTime.Add(2 * time.Hour),
+			Message:   "commit: commit 3",
+		},
+		{
+			OldHash:   revs[0],
+			NewHash:   revs[1],
+			Committer: committer,
+			Time:      baseTime.Add(1 * time.Hour),
+			Message:   "commit: commit 2",
+		},
+		{
+			NewHash:   revs[0],
+			Committer: committer,
+			Time:      baseTime,
+			Message:   "commit (initial): commit 1",
+		},
+	}
+	readAll := func(ref Ref, opts ReflogOptions) []*ReflogEntry {
+		t.Helper()
+		rl, err := env.g.Reflog(ctx, ref, opts)
+		if err != nil {
+			t.Fatal("Reflog:", err)
+		}
+		var got []*ReflogEntry
+		for rl.Next() {
+			got = append(got, rl.Entry())
+		}
+		if err := rl.Close(); err != nil {
+			t.Error("Reflog:", err)
+		}
+		return got
+	}
+	timeEqual := cmp.Comparer(func(t1, t2 time.Time) bool { return t1.Equal(t2) })
+
+	for _, ref := range []Ref{Head, "refs/heads/main"} {
+		if diff := cmp.Diff(want, readAll(ref, ReflogOptions{}), timeEqual); diff != "" {
+			t.Errorf("Reflog(ctx, %q, {}) (-want +got):\n%s", ref, diff)
+		}
+	}
+	wantReversed := []*ReflogEntry{want[2], want[1], want[0]}
+	if diff := cmp.Diff(wantReversed, readAll(Head, ReflogOptions{Reverse: true}), timeEqual); diff != "" {
+		t.Errorf("Reflog(ctx, \"HEAD\", {Reverse: true}) (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want[:2], readAll(Head, ReflogOptions{Limit: 2}), timeEqual); diff != "" {
+		t.Errorf("Reflog(ctx, \"HEAD\", {Limit: 2}) (-want +got):\n%s", diff)
+	}
+	if got := readAll("refs/heads/nonexistent", ReflogOptions{}); len(got) > 0 {
+		t.Errorf("Reflog(ctx, \"refs/heads/nonexistent\", {}) = %v; want empty", got)
+	}
+	if _, err := env.g.Reflog(ctx, "main", ReflogOptions{}); err == nil {
+		t.Error("Reflog(ctx, \"main\", {}) did not return an error")
+	}
+
+	t.Run("ResolveReflogIndex", func(t *testing.T) {
+		for n := 0; n < 3; n++ {
+			got, err := env.g.ResolveReflogIndex(ctx, "refs/heads/main", n)
+			if err != nil {
+				t.Errorf("ResolveReflogIndex(ctx, \"refs/heads/main\", %d): %v", n, err)
+				continue
+			}
+			if want := revs[2-n]; got != want {
+				t.Errorf("ResolveReflogIndex(ctx, \"refs/heads/main\", %d) = %v; want %v", n, got, want)
+			}
+		}
+		if got, err := env.g.ResolveReflogIndex(ctx, "refs/heads/main", 3); err == nil {
+			t.Errorf("ResolveReflogIndex(ctx, \"refs/heads/main\", 3) = %v, <nil>; want error", got)
+		}
+	})
+	t.Run("ResolveReflogTime", func(t *testing.T) {
+		tests := []struct {
+			t    time.Time
+			want Hash
+		}{
+			{t: baseTime.Add(-time.Hour), want: revs[0]},
+			{t: baseTime, want: revs[0]},
+			{t: baseTime.Add(90 * time.Minute), want: revs[1]},
+			{t: baseTime.Add(24 * time.Hour), want: revs[2]},
+		}
+		for _, test := range tests {
+			got, err := env.g.ResolveReflogTime(ctx, "refs/heads/main", test.t)
+			if err != nil {
+				t.Errorf("ResolveReflogTime(ctx, \"refs/heads/main\", %v): %v", test.t, err)
+				continue
+			}
+			if got != test.want {
+				t.Errorf("ResolveReflogTime(ctx, \"refs/heads/main\", %v) = %v; want %v", test.t, got, test.want)
+			}
+		}
+	})
+}
+
+func TestReflogLargeFile(t *testing.T) {
+	// Write a reflog larger than reflogChunkSize to exercise reading
+	// the file backward across chunk boundaries.
+	const n = 1000
+	sb := new(strings.Builder)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(sb, "%040x %040x User <user@example.com> %d +0000\tentry %d\n", i, i+1, 1600000000+i, i)
+	}
+	if sb.Len() <= reflogChunkSize {
+		t.Fatalf("reflog is %d bytes; want > %d", sb.Len(), reflogChunkSize)
+	}
+	f, err := ioutil.TempFile("", "gg_git_reflog_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := io.WriteString(f, sb.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, reverse := range []bool{false, true} {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		rl, err := newReflog("test", f, ReflogOptions{Reverse: reverse})
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for rl.Next() {
+			i := n - 1 - count
+			if reverse {
+				i = count
+			}
+			if want := fmt.Sprintf("entry %d", i); rl.Entry().Message != want {
+				t.Errorf("reverse=%t: entry %d message = %q; want %q", reverse, count, rl.Entry().Message, want)
+			}
+			count++
+		}
+		if rl.scanErr != nil {
+			t.Errorf("reverse=%t: %v", reverse, rl.scanErr)
+		}
+		if count != n {
+			t.Errorf("reverse=%t: read %d entries; want %d", reverse, count, n)
+		}
+	}
+}
+
+func TestParseReflogLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    *ReflogEntry
+		wantErr bool
+	}{
+		{
+			line: "0000000000000000000000000000000000000000 1bec116a955de777a9abffc914ea579b49dc1157 A U Thor <a@example.com> 1614628800 -0800\tcommit (initial): first",
+			want: &ReflogEntry{
+				NewHash:   hashLiteral("1bec116a955de777a9abffc914ea579b49dc1157"),
+				Committer: "A U Thor <a@example.com>",
+				Time:      time.Unix(1614628800, 0),
+				Message:   "commit (initial): first",
+			},
+		},
+		{
+			line: "1bec116a955de777a9abffc914ea579b49dc1157 6cb2dae4f132337019b3999c77a0bf21279a6673 A U Thor <a@example.com> 1614628800 +0000",
+			want: &ReflogEntry{
+				OldHash:   hashLiteral("1bec116a955de777a9abffc914ea579b49dc1157"),
+				NewHash:   hashLiteral("6cb2dae4f132337019b3999c77a0bf21279a6673"),
+				Committer: "A U Thor <a@example.com>",
+				Time:      time.Unix(1614628800, 0),
+			},
+		},
+		{
+			line:    "1bec116a955de777a9abffc914ea579b49dc1157 A U Thor <a@example.com> 1614628800 +0000\tfoo",
+			wantErr: true,
+		},
+		{
+			line:    "1bec116a955de777a9abffc914ea579b49dc1157 6cb2dae4f132337019b3999c77a0bf21279a6673 A U Thor <a@example.com> yesterday +0000\tfoo",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		got, err := parseReflogLine([]byte(test.line))
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("parseReflogLine(%q): %v", test.line, err)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("parseReflogLine(%q) = %+v, <nil>; want error", test.line, got)
+			continue
+		}
+		diff := cmp.Diff(test.want, got, cmp.Comparer(func(t1, t2 time.Time) bool { return t1.Equal(t2) }))
+		if diff != "" {
+			t.Errorf("parseReflogLine(%q) (-want +got):\n%s", test.line, diff)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AddRemoteOptions specifies the command-line options for `git remote add`.
+type AddRemoteOptions struct {
+	// PushURL is the URL to push to. If empty, pushes go to the fetch URL.
+	PushURL string
+	// Fetch is the set of refspecs used when fetching from the remote.
+	// If empty, Git's default of "+refs/heads/*:refs/remotes/<name>/*" is
+	// used. It is mutually exclusive with MirrorFetch.
+	Fetch []FetchRefspec
+	// Mirror configures the remote as a mirror.
+	Mirror RemoteMirror
+}
+
+// RemoteMirror specifies how a remote mirrors the local repository.
+type RemoteMirror int
+
+// Remote mirror modes.
+const (
+	// NoMirror is the default mode: the remote is not a mirror.
+	NoMirror RemoteMirror = iota
+	// MirrorFetch fetches all of the remote's refs directly into the
+	// local repository's refs.
+	MirrorFetch
+	// MirrorPush pushes all local refs to the remote and deletes any remote
+	// refs that don't exist locally.
+	MirrorPush
+)
+
+// AddRemote adds a remote with the given name and URL to the repository's
+// configuration.
+func (g *Git) AddRemote(ctx context.Context, name, url string, opts AddRemoteOptions) error {
+	errPrefix := fmt.Sprintf("git remote add %q", name)
+	if err := validateRemoteName(name); err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if url == "" {
+		return fmt.Errorf("%s: empty URL", errPrefix)
+	}
+	args := []string{"remote", "add"}
+	switch opts.Mirror {
+	case NoMirror:
+	case MirrorFetch:
+		if len(opts.Fetch) > 0 {
+			return fmt.Errorf("%s: cannot set fetch refspecs on a fetch mirror", errPrefix)
+		}
+		args = append(args, "--mirror=fetch")
+	case MirrorPush:
+		args = append(args, "--mirror=push")
+	default:
+		return fmt.Errorf("%s: unknown mirror mode %d", errPrefix, int(opts.Mirror))
+	}
+	args = append(args, "--", name, url)
+	if err := g.run(ctx, errPrefix, args); err != nil {
+		return err
+	}
+	if opts.PushURL != "" {
+		if err := g.SetRemoteURL(ctx, name, opts.PushURL, SetRemoteURLOptions{Push: true}); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	if len(opts.Fetch) > 0 {
+		if err := g.setRemoteFetchRefspecs(ctx, name, opts.Fetch); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	return nil
+}
+
+// RenameRemote renames a remote, updating its remote-tracking branches and
+// configuration settings.
+func (g *Git) RenameRemote(ctx context.Context, oldName, newName string) error {
+	errPrefix := fmt.Sprintf("git remote rename %q %q", oldName, newName)
+	if err := validateRemoteName(oldName); err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if err := validateRemoteName(newName); err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return g.run(ctx, errPrefix, []string{"remote", "rename", "--", oldName, newName})
+}
+
+// RemoveRemote removes a remote along with its remote-tracking branches and
+// configuration settings.
+func (g *Git) RemoveRemote(ctx context.Context, name string) error {
+	errPrefix := fmt.Sprintf("git remote remove %q", name)
+	if err := validateRemoteName(name); err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return g.run(ctx, errPrefix, []string{"remote", "remove", "--", name})
+}
+
+// SetRemoteURLOptions specifies the command-line options for
+// `git remote set-url`.
+type SetRemoteURLOptions struct {
+	// If Push is true, the remote's push URL is set instead of its fetch URL.
+	Push bool
+}
+
+// SetRemoteURL changes the URL of an existing remote.
+func (g *Git) SetRemoteURL(ctx context.Context, name, url string, opts SetRemoteURLOptions) error {
+	errPrefix := fmt.Sprintf("git remote set-url %q", name)
+	if opts.Push {
+		errPrefix = fmt.Sprintf("git remote set-url --push %q", name)
+	}
+	if err := validateRemoteName(name); err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if url == "" {
+		return fmt.Errorf("%s: empty URL", errPrefix)
+	}
+	args := []string{"remote", "set-url"}
+	if opts.Push {
+		args = append(args, "--push")
+	}
+	args = append(args, "--", name, url)
+	return g.run(ctx, errPrefix, args)
+}
+
+// SetRemoteFetchRefspecs replaces the fetch refspecs of an existing remote.
+// The remote may be defined in any configuration scope, but the new refspecs
+// are written to the repository's local configuration.
+func (g *Git) SetRemoteFetchRefspecs(ctx context.Context, name string, specs []FetchRefspec) error {
+	errPrefix := fmt.Sprintf("set fetch refspecs for remote %q", name)
+	if err := validateRemoteName(name); err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	cfg, err := g.ReadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if cfg.ListRemotes()[name] == nil {
+		return fmt.Errorf("%s: no such remote", errPrefix)
+	}
+	if err := g.setRemoteFetchRefspecs(ctx, name, specs); err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return nil
+}
+
+func (g *Git) setRemoteFetchRefspecs(ctx context.Context, name string, specs []FetchRefspec) error {
+	key := "remote." + name + ".fetch"
+	if err := g.UnsetConfig(ctx, LocalConfig, key); err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		if err := g.AddConfigValue(ctx, LocalConfig, key, spec.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateRemoteName(name string) error {
+	if name == "" {
+		return errors.New("empty remote name")
+	}
+	if strings.HasPrefix(name, "-") {
+		return fmt.Errorf("remote name %q starts with dash", name)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestRemoteManagement(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	listRemotes := func() map[string]*Remote {
+		t.Helper()
+		cfg, err := env.g.ReadConfig(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg.ListRemotes()
+	}
+
+	if err := env.g.AddRemote(ctx, "origin", "https://example.com/foo.git", AddRemoteOptions{}); err != nil {
+		t.Fatal("AddRemote(origin):", err)
+	}
+	err = env.g.AddRemote(ctx, "Upstream", "https://example.com/upstream.git", AddRemoteOptions{
+		PushURL: "https://example.com/upstream-push.git",
+		Fetch: []FetchRefspec{
+			"+refs/heads/main:refs/remotes/Upstream/main",
+			"+refs/tags/*:refs/remotes/Upstream/tags/*",
+		},
+	})
+	if err != nil {
+		t.Fatal("AddRemote(Upstream):", err)
+	}
+	if err := env.g.AddRemote(ctx, "backup", "https://example.com/backup.git", AddRemoteOptions{Mirror: MirrorFetch}); err != nil {
+		t.Fatal("AddRemote(backup):", err)
+	}
+	want := map[string]*Remote{
+		"origin": {
+			Name:     "origin",
+			FetchURL: "https://example.com/foo.git",
+			PushURL:  "https://example.com/foo.git",
+			Fetch:    []FetchRefspec{"+refs/heads/*:refs/remotes/origin/*"},
+		},
+		"Upstream": {
+			Name:     "Upstream",
+			FetchURL: "https://example.com/upstream.git",
+			PushURL:  "https://example.com/upstream-push.git",
+			Fetch: []FetchRefspec{
+				"+refs/heads/main:refs/remotes/Upstream/main",
+				"+refs/tags/*:refs/remotes/Upstream/tags/*",
+			},
+		},
+		"backup": {
+			Name:     "backup",
+			FetchURL: "https://example.com/backup.git",
+			PushURL:  "https://example.com/backup.git",
+			Fetch:    []FetchRefspec{"+refs/*:refs/*"},
+		},
+	}
+	if diff := cmp.Diff(want, listRemotes()); diff != "" {
+		t.Errorf("remotes after AddRemote (-want +got):\n%s", diff)
+	}
+
+	if err := env.g.RenameRemote(ctx, "origin", "fork"); err != nil {
+		t.Fatal("RenameRemote:", err)
+	}
+	if err := env.g.SetRemoteURL(ctx, "fork", "https://example.com/fork.git", SetRemoteURLOptions{}); err != nil {
+		t.Fatal("SetRemoteURL:", err)
+	}
+	if err := env.g.SetRemoteURL(ctx, "fork", "https://example.com/fork-push.git", SetRemoteURLOptions{Push: true}); err != nil {
+		t.Fatal("SetRemoteURL(Push):", err)
+	}
+	if err := env.g.SetRemoteFetchRefspecs(ctx, "fork", []FetchRefspec{"+refs/heads/dev:refs/remotes/fork/dev"}); err != nil {
+		t.Fatal("SetRemoteFetchRefspecs:", err)
+	}
+	if err := env.g.SetRemoteFetchRefspecs(ctx, "Upstream", nil); err != nil {
+		t.Fatal("SetRemoteFetchRefspecs(nil):", err)
+	}
+	if err := env.g.RemoveRemote(ctx, "backup"); err != nil {
+		t.Fatal("RemoveRemote:", err)
+	}
+	want = map[string]*Remote{
+		"fork": {
+			Name:     "fork",
+			FetchURL: "https://example.com/fork.git",
+			PushURL:  "https://example.com/fork-push.git",
+			Fetch:    []FetchRefspec{"+refs/heads/dev:refs/remotes/fork/dev"},
+		},
+		"Upstream": {
+			Name:     "Upstream",
+			FetchURL: "https://example.com/upstream.git",
+			PushURL:  "https://example.com/upstream-push.git",
+		},
+	}
+	if diff := cmp.Diff(want, listRemotes(), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("remotes after modifications (-want +got):\n%s", diff)
+	}
+
+	if err := env.g.AddConfigValue(ctx, GlobalConfig, "remote.Shared.url", "https://example.com/shared.git"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.SetRemoteFetchRefspecs(ctx, "Shared", []FetchRefspec{"+refs/heads/main:refs/remotes/Shared/main"}); err != nil {
+		t.Error("SetRemoteFetchRefspecs on remote in global config:", err)
+	}
+	if err := env.g.SetRemoteFetchRefspecs(ctx, "nonexistent", nil); err == nil {
+		t.Error("SetRemoteFetchRefspecs on nonexistent remote did not return an error")
+	}
+	if err := env.g.AddRemote(ctx, "-bad", "https://example.com/bad.git", AddRemoteOptions{}); err == nil {
+		t.Error("AddRemote with dash-prefixed name did not return an error")
+	}
+	if err := env.g.AddRemote(ctx, "mirror", "https://example.com/mirror.git", AddRemoteOptions{
+		Mirror: MirrorFetch,
+		Fetch:  []FetchRefspec{"+refs/heads/*:refs/heads/*"},
+	}); err == nil {
+		t.Error("AddRemote with MirrorFetch and Fetch did not return an error")
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"fmt"
+)
+
+// ResetMode specifies how `git reset` treats the index and working copy.
+type ResetMode int
+
+// Reset modes. See git-reset(1) for details.
+const (
+	// ResetMixed resets the index but not the working copy.
+	// This is the default mode.
+	ResetMixed ResetMode = iota
+	// ResetSoft only moves HEAD, leaving the index and working copy as-is.
+	ResetSoft
+	// ResetHard resets the index and working copy, discarding any local
+	// changes to tracked files.
+	ResetHard
+	// ResetKeep resets the index and updates files in the working copy that
+	// differ between HEAD and the target commit. It aborts if any of those
+	// files have local changes.
+	ResetKeep
+)
+
+// String returns the Go constant name of the mode.
+func (mode ResetMode) String() string {
+	switch mode {
+	case ResetMixed:
+		return "ResetMixed"
+	case ResetSoft:
+		return "ResetSoft"
+	case ResetHard:
+		return "ResetHard"
+	case ResetKeep:
+		return "ResetKeep"
+	default:
+		return fmt.Sprintf("ResetMode(%d)", int(mode))
+	}
+}
+
+func (mode ResetMode) flag() string {
+	switch mode {
+	case ResetMixed:
+		return "--mixed"
+	case ResetSoft:
+		return "--soft"
+	case ResetHard:
+		return "--hard"
+	case ResetKeep:
+		return "--keep"
+	default:
+		return ""
+	}
+}
+
+// ResetOptions specifies the command-line options for `git reset`.
+type ResetOptions struct {
+	Mode ResetMode
+	// If AbandonMerge is true, then a hard reset is permitted while a merge
+	// is in progress, discarding the merge. Otherwise, Reset returns an error
+	// if Mode is ResetHard and IsMerging reports true.
+	AbandonMerge bool
+}
+
+// Reset sets the current branch head (or HEAD if detached) to the given
+// revision and updates the index and working copy as specified by the mode.
+// If rev is empty, then HEAD is used.
+func (g *Git) Reset(ctx context.Context, rev string, opts ResetOptions) error {
+	flag := opts.Mode.flag()
+	errPrefix := fmt.Sprintf("git reset %s", flag)
+	if rev != "" {
+		errPrefix += fmt.Sprintf(" %q", rev)
+		if err := validateRev(rev); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	if flag == "" {
+		return fmt.Errorf("%s: unknown mode %v", errPrefix, opts.Mode)
+	}
+	if opts.Mode == ResetHard && !opts.AbandonMerge {
+		merging, err := g.IsMerging(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		if merging {
+			return fmt.Errorf("%s: merge in progress", errPrefix)
+		}
+	}
+	args := []string{"reset", "--quiet", flag}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	args = append(args, "--")
+	return g.run(ctx, errPrefix, args)
+}
+
+// ResetPaths sets the index entries for the files matched by the pathspecs
+// to their state in the given revision, leaving the working copy and HEAD
+// unchanged. This is commonly used to unstage changes. If rev is empty,
+// then HEAD is used. If len(pathspecs) == 0, then ResetPaths returns nil.
+func (g *Git) ResetPaths(ctx context.Context, rev string, pathspecs []Pathspec) error {
+	errPrefix := "git reset"
+	if rev != "" {
+		errPrefix += fmt.Sprintf(" %q", rev)
+		if err := validateRev(rev); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	if len(pathspecs) == 0 {
+		return nil
+	}
+	args := []string{"reset", "--quiet"}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	args = append(args, "--")
+	for _, p := range pathspecs {
+		args = append(args, p.String())
+	}
+	return g.run(ctx, errPrefix, args)
+}
@@ -0,0 +1,212 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+)
+
+func TestReset(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		mode        ResetMode
+		wantStaged  string
+		wantContent string
+	}{
+		{mode: ResetSoft, wantStaged: "foo.txt\n", wantContent: "v2\n"},
+		{mode: ResetMixed, wantStaged: "", wantContent: "v2\n"},
+		{mode: ResetHard, wantStaged: "", wantContent: "v1\n"},
+		{mode: ResetKeep, wantStaged: "", wantContent: "v1\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.mode.String(), func(t *testing.T) {
+			env, err := newTestEnv(ctx, gitPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer env.cleanup()
+			rev1, rev2 := setupResetRepo(ctx, t, env)
+
+			if err := env.g.Reset(ctx, rev1.String(), ResetOptions{Mode: test.mode}); err != nil {
+				t.Fatal("Reset:", err)
+			}
+			head, err := env.g.Head(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if head.Commit != rev1 {
+				t.Errorf("HEAD = %v; want %v (was %v)", head.Commit, rev1, rev2)
+			}
+			if head.Ref != "refs/heads/main" {
+				t.Errorf("HEAD ref = %q; want refs/heads/main", head.Ref)
+			}
+			staged, err := env.g.Output(ctx, "diff", "--cached", "--name-only")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if staged != test.wantStaged {
+				t.Errorf("staged files = %q; want %q", staged, test.wantStaged)
+			}
+			content, err := env.root.ReadFile("foo.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content != test.wantContent {
+				t.Errorf("foo.txt = %q; want %q", content, test.wantContent)
+			}
+		})
+	}
+
+	t.Run("HardWhileMerging", func(t *testing.T) {
+		env, err := newTestEnv(ctx, gitPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer env.cleanup()
+		rev1, _ := setupResetRepo(ctx, t, env)
+		if err := env.g.NewBranch(ctx, "feature", BranchOptions{StartPoint: rev1.String(), Checkout: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.root.Apply(filesystem.Write("foo.txt", "feature\n")); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.CommitAll(ctx, "feature", CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.CheckoutBranch(ctx, "main", CheckoutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.g.Merge(ctx, []string{"feature"}); err == nil {
+			t.Fatal("Merge did not conflict")
+		}
+
+		if err := env.g.Reset(ctx, "", ResetOptions{Mode: ResetHard}); err == nil {
+			t.Error("Reset(ResetHard) while merging did not return an error")
+		}
+		if merging, err := env.g.IsMerging(ctx); err != nil {
+			t.Fatal(err)
+		} else if !merging {
+			t.Fatal("merge no longer in progress after refused Reset")
+		}
+		if err := env.g.Reset(ctx, "", ResetOptions{Mode: ResetHard, AbandonMerge: true}); err != nil {
+			t.Fatal("Reset(ResetHard, AbandonMerge):", err)
+		}
+		if merging, err := env.g.IsMerging(ctx); err != nil {
+			t.Fatal(err)
+		} else if merging {
+			t.Error("merge still in progress after Reset(ResetHard, AbandonMerge)")
+		}
+	})
+}
+
+func TestResetPaths(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	rev1, _ := setupResetRepo(ctx, t, env)
+
+	err = env.root.Apply(
+		filesystem.Write("foo.txt", "v3\n"),
+		filesystem.Write("bar.txt", "new\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt", "bar.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.g.ResetPaths(ctx, "", []Pathspec{"bar.txt"}); err != nil {
+		t.Fatal("ResetPaths:", err)
+	}
+	staged, err := env.g.Output(ctx, "diff", "--cached", "--name-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "foo.txt\n"; staged != want {
+		t.Errorf("after ResetPaths(HEAD, bar.txt), staged files = %q; want %q", staged, want)
+	}
+
+	if err := env.g.ResetPaths(ctx, rev1.String(), []Pathspec{"foo.txt"}); err != nil {
+		t.Fatal("ResetPaths:", err)
+	}
+	indexContent, err := env.g.Output(ctx, "show", ":foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "v1\n"; indexContent != want {
+		t.Errorf("after ResetPaths(rev1, foo.txt), index foo.txt = %q; want %q", indexContent, want)
+	}
+	content, err := env.root.ReadFile("foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "v3\n"; content != want {
+		t.Errorf("after ResetPaths, working copy foo.txt = %q; want %q", content, want)
+	}
+}
+
+// setupResetRepo creates a repository on the main branch with two commits
+// that change foo.txt from "v1\n" to "v2\n".
+func setupResetRepo(ctx context.Context, t *testing.T, env *testEnv) (rev1, rev2 Hash) {
+	t.Helper()
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "symbolic-ref", "HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "v1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	r1, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "v2\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CommitAll(ctx, "second", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	r2, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r1.Commit, r2.Commit
+}
@@ -0,0 +1,161 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SparseCheckoutInitOptions specifies the command-line options for
+// `git sparse-checkout init`.
+type SparseCheckoutInitOptions struct {
+	// If Cone is true, then the sparse checkout patterns are restricted to
+	// directories. Cone mode is faster than the full pattern syntax and
+	// always includes files at the top of the working copy.
+	Cone bool
+}
+
+// SparseCheckoutInit enables sparse checkout in the working copy. Initially,
+// only files at the top of the working copy are checked out.
+func (g *Git) SparseCheckoutInit(ctx context.Context, opts SparseCheckoutInitOptions) error {
+	args := []string{"sparse-checkout", "init"}
+	if opts.Cone {
+		args = append(args, "--cone")
+	} else if version, err := g.getVersion(ctx); err == nil && versionAtLeast(version, 2, 35) {
+		// Newer versions of Git may default to cone mode.
+		args = append(args, "--no-cone")
+	}
+	return g.run(ctx, "git sparse-checkout init", args)
+}
+
+// SparseCheckoutSet replaces the sparse checkout patterns and updates the
+// working copy to match. In cone mode, each pattern must name a directory
+// relative to the top of the working copy. Otherwise, the patterns use the
+// same syntax as .gitignore files. The patterns are not pathspecs, so
+// pathspec magic like ":(glob)" is not recognized. If sparse checkout has not
+// been enabled, SparseCheckoutSet enables it using Git's default mode.
+func (g *Git) SparseCheckoutSet(ctx context.Context, patterns []string) error {
+	return g.sparseCheckoutPatterns(ctx, "set", patterns)
+}
+
+// SparseCheckoutAdd adds to the sparse checkout patterns and updates the
+// working copy to match. The patterns are interpreted the same as in
+// SparseCheckoutSet.
+func (g *Git) SparseCheckoutAdd(ctx context.Context, patterns []string) error {
+	return g.sparseCheckoutPatterns(ctx, "add", patterns)
+}
+
+func (g *Git) sparseCheckoutPatterns(ctx context.Context, subcmd string, patterns []string) error {
+	errPrefix := "git sparse-checkout " + subcmd
+	stdin := new(strings.Builder)
+	for _, p := range patterns {
+		if p == "" {
+			return fmt.Errorf("%s: empty pattern", errPrefix)
+		}
+		if strings.ContainsAny(p, "\n\x00") {
+			return fmt.Errorf("%s: pattern %q contains a newline or NUL", errPrefix, p)
+		}
+		stdin.WriteString(p)
+		stdin.WriteString("\n")
+	}
+	output := new(bytes.Buffer)
+	w := &limitWriter{w: output, n: errorOutputLimit}
+	err := g.runner.RunGit(ctx, &Invocation{
+		Args:   []string{"sparse-checkout", subcmd, "--stdin"},
+		Dir:    g.dir,
+		Stdin:  strings.NewReader(stdin.String()),
+		Stdout: w,
+		Stderr: w,
+	})
+	if err != nil {
+		return commandError(errPrefix, err, output.Bytes())
+	}
+	return nil
+}
+
+// SparseCheckoutList returns the working copy's sparse checkout patterns.
+// In cone mode, the patterns are the directories passed to SparseCheckoutSet
+// and SparseCheckoutAdd. SparseCheckoutList returns an error if sparse
+// checkout is not enabled.
+func (g *Git) SparseCheckoutList(ctx context.Context) ([]string, error) {
+	out, err := g.output(ctx, "git sparse-checkout list", []string{"sparse-checkout", "list"})
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, line := range strings.Split(out, "\n") {
+		if line != "" {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, nil
+}
+
+// SparseCheckoutDisable disables sparse checkout and restores all files
+// to the working copy.
+func (g *Git) SparseCheckoutDisable(ctx context.Context) error {
+	return g.run(ctx, "git sparse-checkout disable", []string{"sparse-checkout", "disable"})
+}
+
+// listSkipWorktree returns the paths in the index that have the
+// skip-worktree bit set, which includes files outside the sparse checkout
+// patterns. If len(pathspecs) > 0, then only paths matching the pathspecs
+// are considered.
+func (g *Git) listSkipWorktree(ctx context.Context, pathspecs []Pathspec) (map[TopPath]struct{}, error) {
+	const errPrefix = "git ls-files"
+	args := []string{"ls-files", "-z", "-t", "--full-name", "--"}
+	if len(pathspecs) == 0 {
+		args = append(args, ":/")
+	}
+	for _, p := range pathspecs {
+		args = append(args, p.String())
+	}
+	out, err := g.output(ctx, errPrefix, args)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := parseSkipWorktree(out)
+	if err != nil {
+		return paths, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return paths, nil
+}
+
+// parseSkipWorktree parses the output of `git ls-files -z -t`,
+// returning the paths tagged with 'S'.
+func parseSkipWorktree(out string) (map[TopPath]struct{}, error) {
+	paths := make(map[TopPath]struct{})
+	for len(out) > 0 {
+		i := strings.IndexByte(out, 0)
+		if i == -1 {
+			return paths, io.ErrUnexpectedEOF
+		}
+		ent := out[:i]
+		out = out[i+1:]
+		if len(ent) < 3 || ent[1] != ' ' {
+			return paths, fmt.Errorf("malformed entry %q", ent)
+		}
+		if ent[0] == 'S' {
+			paths[TopPath(ent[2:])] = struct{}{}
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSparseCheckout(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if version, err := env.g.getVersion(ctx); err != nil {
+		t.Fatal(err)
+	} else if !versionAtLeast(version, 2, 26) {
+		t.Skipf("%s does not support sparse-checkout add", version)
+	}
+
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	err = env.root.Apply(
+		filesystem.Write("top.txt", dummyContent),
+		filesystem.Write("a/foo.txt", dummyContent),
+		filesystem.Write("b/bar.txt", dummyContent),
+		filesystem.Write("c/baz.txt", dummyContent),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"."}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkFiles := func(t *testing.T, want map[string]bool) {
+		t.Helper()
+		for path, wantExists := range want {
+			exists, err := env.root.Exists(path)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			if exists != wantExists {
+				t.Errorf("%s exists = %t; want %t", path, exists, wantExists)
+			}
+		}
+	}
+
+	if err := env.g.SparseCheckoutInit(ctx, SparseCheckoutInitOptions{Cone: true}); err != nil {
+		t.Fatal("SparseCheckoutInit:", err)
+	}
+	checkFiles(t, map[string]bool{
+		"top.txt":   true,
+		"a/foo.txt": false,
+		"b/bar.txt": false,
+		"c/baz.txt": false,
+	})
+
+	if err := env.g.SparseCheckoutSet(ctx, []string{"a"}); err != nil {
+		t.Fatal("SparseCheckoutSet:", err)
+	}
+	if err := env.g.SparseCheckoutAdd(ctx, []string{"b"}); err != nil {
+		t.Fatal("SparseCheckoutAdd:", err)
+	}
+	checkFiles(t, map[string]bool{
+		"top.txt":   true,
+		"a/foo.txt": true,
+		"b/bar.txt": true,
+		"c/baz.txt": false,
+	})
+	patterns, err := env.g.SparseCheckoutList(ctx)
+	if err != nil {
+		t.Fatal("SparseCheckoutList:", err)
+	}
+	if diff := cmp.Diff([]string{"a", "b"}, patterns); diff != "" {
+		t.Errorf("SparseCheckoutList(...) (-want +got):\n%s", diff)
+	}
+	tree, err := env.g.ListTree(ctx, "HEAD", ListTreeOptions{Recursive: true, CheckSkipWorktree: true})
+	if err != nil {
+		t.Fatal("ListTree:", err)
+	}
+	checkSkipWorktree(t, tree, map[TopPath]bool{
+		"top.txt":   false,
+		"a/foo.txt": false,
+		"b/bar.txt": false,
+		"c/baz.txt": true,
+	})
+	status, err := env.g.Status(ctx, StatusOptions{CheckSkipWorktree: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) > 0 {
+		t.Errorf("Status(...) = %v; want []", status)
+	}
+
+	if err := env.g.SparseCheckoutDisable(ctx); err != nil {
+		t.Fatal("SparseCheckoutDisable:", err)
+	}
+	checkFiles(t, map[string]bool{
+		"top.txt":   true,
+		"a/foo.txt": true,
+		"b/bar.txt": true,
+		"c/baz.txt": true,
+	})
+	tree, err = env.g.ListTree(ctx, "HEAD", ListTreeOptions{Recursive: true, CheckSkipWorktree: true})
+	if err != nil {
+		t.Fatal("ListTree:", err)
+	}
+	checkSkipWorktree(t, tree, map[TopPath]bool{
+		"top.txt":   false,
+		"a/foo.txt": false,
+		"b/bar.txt": false,
+		"c/baz.txt": false,
+	})
+
+	// Staged changes to skip-worktree files still show up in Status.
+	if err := env.root.Apply(filesystem.Write("top.txt", "changed\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"top.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "update-index", "--skip-worktree", "top.txt"); err != nil {
+		t.Fatal(err)
+	}
+	status, err = env.g.Status(ctx, StatusOptions{CheckSkipWorktree: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStatus := []StatusEntry{{Code: StatusCode{'M', ' '}, Name: "top.txt", SkipWorktree: true}}
+	if diff := cmp.Diff(wantStatus, status); diff != "" {
+		t.Errorf("Status(...) (-want +got):\n%s", diff)
+	}
+}
+
+func checkSkipWorktree(t *testing.T, tree map[TopPath]*TreeEntry, want map[TopPath]bool) {
+	t.Helper()
+	for path, wantSkip := range want {
+		ent := tree[path]
+		if ent == nil {
+			t.Errorf("ListTree(...) missing %s", path)
+			continue
+		}
+		if got := ent.SkipWorktree(); got != wantSkip {
+			t.Errorf("ListTree(...)[%q].SkipWorktree() = %t; want %t", path, got, wantSkip)
+		}
+	}
+}
+
+func TestParseSkipWorktree(t *testing.T) {
+	tests := []struct {
+		out     string
+		want    map[TopPath]struct{}
+		wantErr bool
+	}{
+		{
+			out:  "",
+			want: map[TopPath]struct{}{},
+		},
+		{
+			out: "H foo.txt\x00S bar/baz.txt\x00S with space.txt\x00M qux.txt\x00",
+			want: map[TopPath]struct{}{
+				"bar/baz.txt":    {},
+				"with space.txt": {},
+			},
+		},
+		{
+			out:     "S foo.txt",
+			wantErr: true,
+		},
+		{
+			out:     "Sfoo.txt\x00",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		got, err := parseSkipWorktree(test.out)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("parseSkipWorktree(%q): %v", test.out, err)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("parseSkipWorktree(%q) = %v, <nil>; want error", test.out, got)
+			continue
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("parseSkipWorktree(%q) (-want +got):\n%s", test.out, diff)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gg-scm.io/pkg/git/object"
+)
+
+// stashRef is the ref whose reflog holds the stash entries.
+const stashRef Ref = "refs/stash"
+
+// StashPushOptions specifies the command-line options for `git stash push`.
+type StashPushOptions struct {
+	// Message is the description of the stash entry.
+	// If empty, Git generates one from the current HEAD.
+	Message string
+	// Pathspecs limits the stash to the matching files.
+	// If empty, all local changes are stashed.
+	Pathspecs []Pathspec
+	// If KeepIndex is true, then changes already added to the index are
+	// left intact in the index and working copy.
+	KeepIndex bool
+	// If IncludeUntracked is true, then untracked files are stashed and
+	// removed from the working copy too.
+	IncludeUntracked bool
+}
+
+// StashPush saves the local modifications to a new stash entry and
+// reverts the working copy to match HEAD. If there are no local
+// modifications, StashPush does not create an entry.
+func (g *Git) StashPush(ctx context.Context, opts StashPushOptions) error {
+	const errPrefix = "git stash push"
+	args := []string{"stash", "push", "--quiet"}
+	if opts.KeepIndex {
+		args = append(args, "--keep-index")
+	}
+	if opts.IncludeUntracked {
+		args = append(args, "--include-untracked")
+	}
+	if opts.Message != "" {
+		args = append(args, "--message="+opts.Message)
+	}
+	if len(opts.Pathspecs) > 0 {
+		args = append(args, "--")
+		for _, spec := range opts.Pathspecs {
+			args = append(args, spec.String())
+		}
+	}
+	return g.run(ctx, errPrefix, args)
+}
+
+// ListStashes returns the stash entries, most recent first. The entry
+// at index i can be referred to as "stash@{i}". Each stash entry is a
+// merge commit whose first parent is the commit HEAD pointed to when the
+// entry was created.
+func (g *Git) ListStashes(ctx context.Context) ([]*object.Commit, error) {
+	const errPrefix = "git stash list"
+	err := g.run(ctx, errPrefix, []string{"rev-parse", "-q", "--verify", "--revs-only", stashRef.String()})
+	if err != nil {
+		if exitCode(err) == 1 {
+			// No stash entries.
+			return nil, nil
+		}
+		return nil, err
+	}
+	out, err := g.output(ctx, errPrefix, []string{"rev-list", "--walk-reflogs", stashRef.String(), "--"})
+	if err != nil {
+		return nil, err
+	}
+	r, err := g.OpenObjectReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	defer r.Close()
+	var stashes []*object.Commit
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		h, err := ParseHash(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		c, err := r.Commit(ctx, h.String())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		stashes = append(stashes, c)
+	}
+	return stashes, nil
+}
+
+// StashShow returns the changes recorded in a stash entry relative to
+// the commit it was created on. If stash is empty, the latest entry is
+// used. Untracked files saved in the entry are not included.
+func (g *Git) StashShow(ctx context.Context, stash string) ([]*FileDiff, error) {
+	stash, err := stashArg(stash)
+	if err != nil {
+		return nil, fmt.Errorf("git stash show: %w", err)
+	}
+	diff, err := g.Diff(ctx, DiffOptions{Commit1: stash + "^1", Commit2: stash})
+	if err != nil {
+		return nil, fmt.Errorf("git stash show %q: %w", stash, err)
+	}
+	return diff, nil
+}
+
+// StashApplyOptions specifies the command-line options for
+// `git stash apply` and `git stash pop`.
+type StashApplyOptions struct {
+	// If RestoreIndex is true, then changes that were staged when the
+	// entry was created are staged again.
+	RestoreIndex bool
+}
+
+// StashApply applies the changes in a stash entry to the working copy.
+// If stash is empty, the latest entry is used. The entry is kept in the
+// stash list. If applying the entry produces merge conflicts, then
+// StashApply returns a *ConflictError.
+func (g *Git) StashApply(ctx context.Context, stash string, opts StashApplyOptions) error {
+	return g.stashApply(ctx, "apply", stash, opts)
+}
+
+// StashPop applies the changes in a stash entry to the working copy and
+// removes the entry from the stash list. If stash is empty, the latest
+// entry is used. If applying the entry produces merge conflicts, then
+// StashPop returns a *ConflictError and the entry is kept.
+func (g *Git) StashPop(ctx context.Context, stash string, opts StashApplyOptions) error {
+	return g.stashApply(ctx, "pop", stash, opts)
+}
+
+func (g *Git) stashApply(ctx context.Context, subcmd string, stash string, opts StashApplyOptions) error {
+	errPrefix := "git stash " + subcmd
+	stash, err := stashArg(stash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	errPrefix += fmt.Sprintf(" %q", stash)
+	args := []string{"stash", subcmd, "--quiet"}
+	if opts.RestoreIndex {
+		args = append(args, "--index")
+	}
+	args = append(args, stash)
+	if err := g.run(ctx, errPrefix, args); err != nil {
+		return g.conflictError(ctx, Hash{}, err)
+	}
+	return nil
+}
+
+// StashDrop removes a stash entry from the stash list.
+// If stash is empty, the latest entry is removed.
+func (g *Git) StashDrop(ctx context.Context, stash string) error {
+	stash, err := stashArg(stash)
+	if err != nil {
+		return fmt.Errorf("git stash drop: %w", err)
+	}
+	return g.run(ctx, fmt.Sprintf("git stash drop %q", stash), []string{"stash", "drop", "--quiet", stash})
+}
+
+// stashArg validates a stash entry argument, defaulting to the latest entry.
+func stashArg(stash string) (string, error) {
+	if stash == "" {
+		return "stash@{0}", nil
+	}
+	if err := validateRev(stash); err != nil {
+		return "", err
+	}
+	return stash, nil
+}
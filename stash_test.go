@@ -0,0 +1,160 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStash(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if _, err := env.g.ListStashes(ctx); err == nil {
+		t.Error("ListStashes outside a repository did not return an error")
+	}
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", "original\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	head, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := env.g.ListStashes(ctx); err != nil {
+		t.Error("ListStashes on empty stash:", err)
+	} else if len(got) > 0 {
+		t.Errorf("ListStashes on empty stash = %d entries; want 0", len(got))
+	}
+
+	err = env.root.Apply(
+		filesystem.Write("foo.txt", "changed\n"),
+		filesystem.Write("untracked.txt", "untracked\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.g.StashPush(ctx, StashPushOptions{
+		Message:          "my changes",
+		IncludeUntracked: true,
+	})
+	if err != nil {
+		t.Fatal("StashPush:", err)
+	}
+	if got, err := env.root.ReadFile("foo.txt"); err != nil {
+		t.Error(err)
+	} else if got != "original\n" {
+		t.Errorf("after StashPush, foo.txt = %q; want \"original\\n\"", got)
+	}
+	if exists, err := env.root.Exists("untracked.txt"); err != nil {
+		t.Error(err)
+	} else if exists {
+		t.Error("after StashPush, untracked.txt exists")
+	}
+
+	stashes, err := env.g.ListStashes(ctx)
+	if err != nil {
+		t.Fatal("ListStashes:", err)
+	}
+	if len(stashes) != 1 {
+		t.Fatalf("len(ListStashes(ctx)) = %d; want 1", len(stashes))
+	}
+	if len(stashes[0].Parents) == 0 || stashes[0].Parents[0] != head.Commit {
+		t.Errorf("stash parents = %v; want first parent %v", stashes[0].Parents, head.Commit)
+	}
+	if want := ": my changes"; !strings.HasSuffix(stashes[0].Message, want) {
+		t.Errorf("stash message = %q; want to end with %q", stashes[0].Message, want)
+	}
+
+	diff, err := env.g.StashShow(ctx, "")
+	if err != nil {
+		t.Fatal("StashShow:", err)
+	}
+	if len(diff) != 1 || diff[0].NewName != "foo.txt" {
+		t.Errorf("StashShow(ctx, \"\") = %+v; want single change to foo.txt", diff)
+	}
+
+	if err := env.g.StashApply(ctx, "stash@{0}", StashApplyOptions{}); err != nil {
+		t.Fatal("StashApply:", err)
+	}
+	if got, err := env.root.ReadFile("foo.txt"); err != nil {
+		t.Error(err)
+	} else if got != "changed\n" {
+		t.Errorf("after StashApply, foo.txt = %q; want \"changed\\n\"", got)
+	}
+	if got, err := env.root.ReadFile("untracked.txt"); err != nil {
+		t.Error(err)
+	} else if got != "untracked\n" {
+		t.Errorf("after StashApply, untracked.txt = %q; want \"untracked\\n\"", got)
+	}
+
+	// Commit a conflicting change and pop the stash on top of it.
+	if err := env.root.Apply(filesystem.Write("foo.txt", "conflict\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Run(ctx, "clean", "--force", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.CommitAll(ctx, "second", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err = env.g.StashPop(ctx, "", StashApplyOptions{})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("StashPop(...) = %v; want *ConflictError", err)
+	}
+	if diff := cmp.Diff([]TopPath{"foo.txt"}, conflict.Paths); diff != "" {
+		t.Errorf("conflict paths (-want +got):\n%s", diff)
+	}
+	if stashes, err := env.g.ListStashes(ctx); err != nil {
+		t.Error("ListStashes:", err)
+	} else if len(stashes) != 1 {
+		t.Errorf("after conflicting StashPop, len(ListStashes(ctx)) = %d; want 1", len(stashes))
+	}
+
+	if err := env.g.StashDrop(ctx, ""); err != nil {
+		t.Fatal("StashDrop:", err)
+	}
+	if stashes, err := env.g.ListStashes(ctx); err != nil {
+		t.Error("ListStashes:", err)
+	} else if len(stashes) != 0 {
+		t.Errorf("after StashDrop, len(ListStashes(ctx)) = %d; want 0", len(stashes))
+	}
+}
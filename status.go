@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -32,6 +33,9 @@ type StatusOptions struct {
 	DisableRenames bool
 	// Pathspecs filters the output to the given pathspecs.
 	Pathspecs []Pathspec
+	// If CheckSkipWorktree is true, then Status reads the index to fill in
+	// each entry's SkipWorktree field.
+	CheckSkipWorktree bool
 }
 
 // Status returns any differences the working copy has from the files at HEAD.
@@ -68,6 +72,15 @@ func (g *Git) Status(ctx context.Context, opts StatusOptions) ([]StatusEntry, er
 			return entries, err
 		}
 	}
+	if opts.CheckSkipWorktree && len(entries) > 0 {
+		skipped, err := g.listSkipWorktree(ctx, opts.Pathspecs)
+		if err != nil {
+			return entries, err
+		}
+		for i := range entries {
+			_, entries[i].SkipWorktree = skipped[entries[i].Name]
+		}
+	}
 	return entries, nil
 }
 
@@ -103,6 +116,10 @@ type StatusEntry struct {
 	// From is the path of the file that this file was renamed or
 	// copied from, otherwise an empty string.
 	From TopPath
+	// SkipWorktree is true if the file's index entry has the skip-worktree
+	// bit set, as it does for files outside the sparse checkout patterns.
+	// It is only populated if StatusOptions.CheckSkipWorktree was set.
+	SkipWorktree bool
 }
 
 // Rename behaviors.
@@ -345,6 +362,11 @@ func (g *Git) DiffStatus(ctx context.Context, opts DiffStatusOptions) ([]DiffSta
 type DiffStatusEntry struct {
 	Code DiffStatusCode
 	Name TopPath
+	// From is the path of the file that this file was renamed or
+	// copied from, otherwise an empty string.
+	From TopPath
+	// Similarity is the similarity index percentage for renames and copies.
+	Similarity int
 }
 
 func readDiffStatusEntry(data string) (DiffStatusEntry, string, error) {
@@ -359,12 +381,13 @@ func readDiffStatusEntry(data string) (DiffStatusEntry, string, error) {
 	ent.Code = DiffStatusCode(data[0])
 	hasFrom := ent.Code == DiffStatusRenamed || ent.Code == DiffStatusCopied
 
-	// Read NUL.
+	// Read similarity score and NUL.
 	if hasFrom {
 		foundNul := false
 		for i := 1; i < 5 && i < len(data); i++ {
 			if data[i] == 0 {
 				foundNul = true
+				ent.Similarity, _ = strconv.Atoi(data[1:i])
 				data = data[i+1:]
 				break
 			}
@@ -385,7 +408,7 @@ func readDiffStatusEntry(data string) (DiffStatusEntry, string, error) {
 		if i == -1 {
 			return DiffStatusEntry{}, "", errors.New("read diff entry: unexpected EOF")
 		}
-		// TODO(someday): Persist this value. Until then, just skip.
+		ent.From = TopPath(data[:i])
 		data = data[i+1:]
 	}
 	i := strings.IndexByte(data, 0)
@@ -246,16 +246,20 @@ func TestReadDiffStatusEntry(t *testing.T) {
 			name: "Renamed",
 			data: "R100\x00foo.txt\x00bar.txt\x00",
 			want: DiffStatusEntry{
-				Code: 'R',
-				Name: "bar.txt",
+				Code:       'R',
+				Name:       "bar.txt",
+				From:       "foo.txt",
+				Similarity: 100,
 			},
 		},
 		{
 			name: "RenamedPartial",
 			data: "R045\x00foo.txt\x00bar.txt\x00",
 			want: DiffStatusEntry{
-				Code: 'R',
-				Name: "bar.txt",
+				Code:       'R',
+				Name:       "bar.txt",
+				From:       "foo.txt",
+				Similarity: 45,
 			},
 		},
 		{
@@ -0,0 +1,470 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// InitSubmodules copies the URLs of the submodules matched by the pathspecs
+// from .gitmodules into the repository's configuration. If
+// len(pathspecs) == 0, then all submodules are initialized.
+func (g *Git) InitSubmodules(ctx context.Context, pathspecs []Pathspec) error {
+	args := []string{"submodule", "--quiet", "init", "--"}
+	for _, p := range pathspecs {
+		args = append(args, p.String())
+	}
+	return g.run(ctx, "git submodule init", args)
+}
+
+// SubmoduleUpdateStrategy specifies how `git submodule update` brings a
+// submodule to the commit recorded in the superproject.
+type SubmoduleUpdateStrategy int
+
+// Submodule update strategies.
+const (
+	// SubmoduleUpdateDefault uses the strategy in the submodule's
+	// configuration, which defaults to SubmoduleCheckout.
+	SubmoduleUpdateDefault SubmoduleUpdateStrategy = iota
+	// SubmoduleCheckout checks out the recorded commit on a detached HEAD.
+	SubmoduleCheckout
+	// SubmoduleRebase rebases the submodule's current branch onto the
+	// recorded commit.
+	SubmoduleRebase
+	// SubmoduleMerge merges the recorded commit into the submodule's
+	// current branch.
+	SubmoduleMerge
+)
+
+// String returns the Go constant name of the strategy.
+func (strategy SubmoduleUpdateStrategy) String() string {
+	switch strategy {
+	case SubmoduleUpdateDefault:
+		return "SubmoduleUpdateDefault"
+	case SubmoduleCheckout:
+		return "SubmoduleCheckout"
+	case SubmoduleRebase:
+		return "SubmoduleRebase"
+	case SubmoduleMerge:
+		return "SubmoduleMerge"
+	default:
+		return fmt.Sprintf("SubmoduleUpdateStrategy(%d)", int(strategy))
+	}
+}
+
+// UpdateSubmodulesOptions specifies the command-line options for
+// `git submodule update`.
+type UpdateSubmodulesOptions struct {
+	// If Init is true, then uninitialized submodules are initialized
+	// before updating.
+	Init bool
+	// If Recursive is true, then submodules of submodules are updated too.
+	Recursive bool
+	// If Depth is greater than zero, then new submodule clones are shallow
+	// clones with the given number of commits.
+	Depth int
+	// Jobs is the number of submodules fetched in parallel.
+	// If zero, Git's submodule.fetchJobs setting is used.
+	Jobs int
+	// Strategy specifies how each submodule is updated.
+	Strategy SubmoduleUpdateStrategy
+}
+
+// UpdateSubmodules clones missing submodules and updates the working copies
+// of the submodules matched by the pathspecs to the commits recorded in
+// the superproject. If len(pathspecs) == 0, then all initialized submodules
+// are updated.
+//
+// This function may block on user input if a submodule's remote requires
+// credentials.
+func (g *Git) UpdateSubmodules(ctx context.Context, pathspecs []Pathspec, opts UpdateSubmodulesOptions) error {
+	const errPrefix = "git submodule update"
+	args := []string{"submodule", "--quiet", "update"}
+	if opts.Init {
+		args = append(args, "--init")
+	}
+	if opts.Recursive {
+		args = append(args, "--recursive")
+	}
+	if opts.Depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", opts.Depth))
+	}
+	if opts.Jobs > 0 {
+		args = append(args, fmt.Sprintf("--jobs=%d", opts.Jobs))
+	}
+	switch opts.Strategy {
+	case SubmoduleUpdateDefault:
+	case SubmoduleCheckout:
+		args = append(args, "--checkout")
+	case SubmoduleRebase:
+		args = append(args, "--rebase")
+	case SubmoduleMerge:
+		args = append(args, "--merge")
+	default:
+		return fmt.Errorf("%s: unknown strategy %v", errPrefix, opts.Strategy)
+	}
+	args = append(args, "--")
+	for _, p := range pathspecs {
+		args = append(args, p.String())
+	}
+	return g.run(ctx, errPrefix, args)
+}
+
+// SyncSubmodulesOptions specifies the command-line options for
+// `git submodule sync`.
+type SyncSubmodulesOptions struct {
+	// If Recursive is true, then submodules of submodules are synchronized too.
+	Recursive bool
+}
+
+// SyncSubmodules updates the remote URLs of the submodules matched by the
+// pathspecs to the URLs in .gitmodules. If len(pathspecs) == 0, then all
+// submodules are synchronized.
+func (g *Git) SyncSubmodules(ctx context.Context, pathspecs []Pathspec, opts SyncSubmodulesOptions) error {
+	args := []string{"submodule", "--quiet", "sync"}
+	if opts.Recursive {
+		args = append(args, "--recursive")
+	}
+	args = append(args, "--")
+	for _, p := range pathspecs {
+		args = append(args, p.String())
+	}
+	return g.run(ctx, "git submodule sync", args)
+}
+
+// AddSubmoduleOptions specifies the command-line options for
+// `git submodule add`.
+type AddSubmoduleOptions struct {
+	// Name is the logical name of the submodule. If empty, the path is used.
+	Name string
+	// Branch is the branch of the submodule's remote to check out.
+	// If empty, the remote's HEAD is used.
+	Branch string
+	// If Depth is greater than zero, then the submodule is cloned with
+	// the given number of commits.
+	Depth int
+	// If Force is true, then the submodule is added even if its path
+	// is ignored.
+	Force bool
+}
+
+// AddSubmodule clones the repository at the given URL into path and stages
+// it as a submodule, along with an updated .gitmodules file. url may be
+// relative to the superproject's default remote, like "../other.git".
+//
+// This function may block on user input if the remote requires
+// credentials.
+func (g *Git) AddSubmodule(ctx context.Context, url string, path string, opts AddSubmoduleOptions) error {
+	errPrefix := fmt.Sprintf("git submodule add %q", url)
+	if url == "" {
+		return fmt.Errorf("%s: empty URL", errPrefix)
+	}
+	if strings.HasPrefix(url, "-") {
+		return fmt.Errorf("%s: URL cannot begin with dash", errPrefix)
+	}
+	if path == "" {
+		return fmt.Errorf("%s: empty path", errPrefix)
+	}
+	args := []string{"submodule", "--quiet", "add"}
+	if opts.Name != "" {
+		args = append(args, "--name="+opts.Name)
+	}
+	if opts.Branch != "" {
+		if err := validateBranch(opts.Branch); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		args = append(args, "-b", opts.Branch)
+	}
+	if opts.Depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", opts.Depth))
+	}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	args = append(args, "--", url, path)
+	return g.run(ctx, errPrefix, args)
+}
+
+// DeinitSubmoduleOptions specifies the command-line options for
+// `git submodule deinit`.
+type DeinitSubmoduleOptions struct {
+	// If Force is true, then submodule working copies are removed even if
+	// they have local modifications.
+	Force bool
+}
+
+// DeinitSubmodule unregisters the submodules matched by the pathspecs and
+// removes their working copies. The submodules remain in .gitmodules and
+// the index. If len(pathspecs) == 0, then DeinitSubmodule returns nil.
+func (g *Git) DeinitSubmodule(ctx context.Context, pathspecs []Pathspec, opts DeinitSubmoduleOptions) error {
+	if len(pathspecs) == 0 {
+		return nil
+	}
+	args := []string{"submodule", "--quiet", "deinit"}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	args = append(args, "--")
+	for _, p := range pathspecs {
+		args = append(args, p.String())
+	}
+	return g.run(ctx, "git submodule deinit", args)
+}
+
+// SubmoduleStatusOptions specifies the command-line options for
+// `git submodule status`.
+type SubmoduleStatusOptions struct {
+	// Pathspecs filters the submodules reported. If empty, all submodules
+	// are reported.
+	Pathspecs []Pathspec
+	// If Recursive is true, then submodules of submodules are reported too.
+	Recursive bool
+}
+
+// SubmoduleStatusEntry is the state of a single submodule.
+type SubmoduleStatusEntry struct {
+	// Path is the path of the submodule relative to the top of the
+	// superproject's working copy.
+	Path TopPath
+	// Recorded is the commit recorded in the superproject's index.
+	// It is zero if the submodule has merge conflicts.
+	Recorded Hash
+	// CheckedOut is the commit checked out in the submodule's working copy.
+	// It is zero if the submodule is uninitialized or has merge conflicts.
+	CheckedOut Hash
+	State      SubmoduleState
+}
+
+// SubmoduleState is a single-character flag from `git submodule status`.
+type SubmoduleState byte
+
+// Submodule states.
+const (
+	// SubmoduleUpToDate indicates that the submodule has the recorded
+	// commit checked out.
+	SubmoduleUpToDate SubmoduleState = ' '
+	// SubmoduleUninitialized indicates that the submodule has not been
+	// initialized or updated.
+	SubmoduleUninitialized SubmoduleState = '-'
+	// SubmoduleModified indicates that the submodule has a different commit
+	// checked out than the recorded commit.
+	SubmoduleModified SubmoduleState = '+'
+	// SubmoduleConflicted indicates that the submodule has merge conflicts
+	// in the superproject.
+	SubmoduleConflicted SubmoduleState = 'U'
+)
+
+// String returns the state flag as a string.
+func (state SubmoduleState) String() string {
+	return string(state)
+}
+
+// SubmoduleStatus reports the state of the repository's submodules in the
+// order Git lists them.
+func (g *Git) SubmoduleStatus(ctx context.Context, opts SubmoduleStatusOptions) ([]*SubmoduleStatusEntry, error) {
+	const errPrefix = "git submodule status"
+	top, err := g.WorkTree(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	// Run from the top of the working copy so that paths are top-relative.
+	topGit := g.WithDir(top)
+	statusArgs := func(cached bool) []string {
+		args := []string{"submodule", "status"}
+		if opts.Recursive {
+			args = append(args, "--recursive")
+		}
+		if cached {
+			// --cached reports the recorded commits instead of the
+			// checked out ones.
+			args = append(args, "--cached")
+		}
+		args = append(args, "--")
+		for _, p := range opts.Pathspecs {
+			args = append(args, p.String())
+		}
+		return args
+	}
+
+	// Status lines end with an optional " (<describe>)" that can't be
+	// distinguished from a path without knowing the submodules' paths.
+	paths := newSubmodulePaths(topGit)
+	isSubmodule := func(path TopPath) (bool, error) {
+		return paths.contains(ctx, path)
+	}
+	out, err := topGit.output(ctx, errPrefix, statusArgs(false))
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseSubmoduleStatus(out, isSubmodule)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	cachedOut, err := topGit.output(ctx, errPrefix, statusArgs(true))
+	if err != nil {
+		return nil, err
+	}
+	cached, err := parseSubmoduleStatus(cachedOut, isSubmodule)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if len(cached) != len(entries) {
+		return nil, fmt.Errorf("%s: submodules changed while reading status", errPrefix)
+	}
+	for i, ent := range entries {
+		if cached[i].Path != ent.Path {
+			return nil, fmt.Errorf("%s: submodules changed while reading status", errPrefix)
+		}
+		ent.Recorded = cached[i].CheckedOut
+		if ent.State == SubmoduleUninitialized {
+			ent.CheckedOut = Hash{}
+		}
+	}
+	return entries, nil
+}
+
+// submodulePaths is the set of submodule paths in a superproject.
+// Indexes of submodules are read as needed to find nested submodules.
+type submodulePaths struct {
+	top   *Git
+	paths map[TopPath]struct{}
+	// read is the set of submodules whose index has been read.
+	// The superproject is stored as ".".
+	read map[TopPath]struct{}
+}
+
+func newSubmodulePaths(top *Git) *submodulePaths {
+	return &submodulePaths{
+		top:   top,
+		paths: make(map[TopPath]struct{}),
+		read:  make(map[TopPath]struct{}),
+	}
+}
+
+// contains reports whether path is the path of a submodule.
+func (sp *submodulePaths) contains(ctx context.Context, path TopPath) (bool, error) {
+	if err := sp.readIndex(ctx, "."); err != nil {
+		return false, err
+	}
+	// Nested submodules are only listed if their parents are initialized,
+	// so read the index of every submodule that contains path.
+	for i := 0; i < len(path); i++ {
+		if path[i] != '/' {
+			continue
+		}
+		if _, ok := sp.paths[path[:i]]; !ok {
+			continue
+		}
+		if err := sp.readIndex(ctx, path[:i]); err != nil {
+			return false, err
+		}
+	}
+	_, ok := sp.paths[path]
+	return ok, nil
+}
+
+// readIndex adds the paths of the submodules in the index of the
+// given submodule, if it has not been read yet.
+func (sp *submodulePaths) readIndex(ctx context.Context, dir TopPath) error {
+	if _, ok := sp.read[dir]; ok {
+		return nil
+	}
+	sp.read[dir] = struct{}{}
+	out, err := sp.top.WithDir(dir.String()).output(ctx, "git ls-files", []string{"ls-files", "--stage", "-z"})
+	if err != nil {
+		return err
+	}
+	for _, rec := range strings.Split(out, "\x00") {
+		// Each record has the form "<mode> <hash> <stage>\t<path>".
+		const gitlinkPrefix = "160000 "
+		if !strings.HasPrefix(rec, gitlinkPrefix) {
+			continue
+		}
+		tab := strings.IndexByte(rec, '\t')
+		if tab == -1 {
+			return fmt.Errorf("git ls-files: invalid record %q", rec)
+		}
+		path := TopPath(rec[tab+1:])
+		if dir != "." {
+			path = dir + "/" + path
+		}
+		sp.paths[path] = struct{}{}
+	}
+	return nil
+}
+
+// parseSubmoduleStatus parses the output of `git submodule status`.
+// Each line has the form "<flag><hash> <path>[ (<describe>)]".
+// The hash is stored in the CheckedOut field. isSubmodule reports whether
+// a path is the path of a submodule, which is used to find where the path ends.
+func parseSubmoduleStatus(out string, isSubmodule func(TopPath) (bool, error)) ([]*SubmoduleStatusEntry, error) {
+	var entries []*SubmoduleStatusEntry
+	for len(out) > 0 {
+		eol := strings.IndexByte(out, '\n')
+		if eol == -1 {
+			return entries, errors.New("unexpected EOF")
+		}
+		line := out[:eol]
+		out = out[eol+1:]
+
+		const hashEnd = 1 + len(Hash{})*2
+		if len(line) < hashEnd+2 || line[hashEnd] != ' ' {
+			return entries, fmt.Errorf("invalid line %q", line)
+		}
+		ent := &SubmoduleStatusEntry{State: SubmoduleState(line[0])}
+		switch ent.State {
+		case SubmoduleUpToDate, SubmoduleUninitialized, SubmoduleModified, SubmoduleConflicted:
+		default:
+			return entries, fmt.Errorf("invalid line %q", line)
+		}
+		var err error
+		ent.CheckedOut, err = ParseHash(line[1:hashEnd])
+		if err != nil {
+			return entries, fmt.Errorf("invalid line %q: %w", line, err)
+		}
+		path, err := trimSubmoduleDescribe(line[hashEnd+1:], isSubmodule)
+		if err != nil {
+			return entries, fmt.Errorf("invalid line %q: %w", line, err)
+		}
+		ent.Path = path
+		entries = append(entries, ent)
+	}
+	return entries, nil
+}
+
+// trimSubmoduleDescribe removes the optional " (<describe>)" suffix from the
+// end of a `git submodule status` line, leaving the submodule's path.
+func trimSubmoduleDescribe(s string, isSubmodule func(TopPath) (bool, error)) (TopPath, error) {
+	if ok, err := isSubmodule(TopPath(s)); err != nil {
+		return "", err
+	} else if ok {
+		return TopPath(s), nil
+	}
+	if strings.HasSuffix(s, ")") {
+		for i := strings.LastIndex(s, " ("); i != -1; i = strings.LastIndex(s[:i], " (") {
+			if ok, err := isSubmodule(TopPath(s[:i])); err != nil {
+				return "", err
+			} else if ok {
+				return TopPath(s[:i]), nil
+			}
+		}
+	}
+	return "", errors.New("unknown submodule")
+}
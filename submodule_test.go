@@ -0,0 +1,264 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSubmoduleStatus(t *testing.T) {
+	const (
+		hash1 = "0123456789abcdef0123456789abcdef01234567"
+		zero  = "0000000000000000000000000000000000000000"
+	)
+	paths := map[TopPath]struct{}{
+		"lib":              {},
+		"vendor/foo":       {},
+		"path with spaces": {},
+		"conflicted":       {},
+		"weird (name)":     {},
+	}
+	tests := []struct {
+		name    string
+		out     string
+		want    []*SubmoduleStatusEntry
+		wantErr bool
+	}{
+		{name: "Empty", out: ""},
+		{
+			name: "States",
+			out: " " + hash1 + " lib (heads/main)\n" +
+				"-" + hash1 + " vendor/foo\n" +
+				"+" + hash1 + " path with spaces (v1.0-2-g0123456)\n" +
+				"U" + zero + " conflicted\n",
+			want: []*SubmoduleStatusEntry{
+				{Path: "lib", CheckedOut: hashLiteral(hash1), State: SubmoduleUpToDate},
+				{Path: "vendor/foo", CheckedOut: hashLiteral(hash1), State: SubmoduleUninitialized},
+				{Path: "path with spaces", CheckedOut: hashLiteral(hash1), State: SubmoduleModified},
+				{Path: "conflicted", State: SubmoduleConflicted},
+			},
+		},
+		{
+			name: "ParenthesizedPath",
+			out: " " + hash1 + " weird (name) (heads/main)\n" +
+				"+" + hash1 + " weird (name)\n",
+			want: []*SubmoduleStatusEntry{
+				{Path: "weird (name)", CheckedOut: hashLiteral(hash1), State: SubmoduleUpToDate},
+				{Path: "weird (name)", CheckedOut: hashLiteral(hash1), State: SubmoduleModified},
+			},
+		},
+		{name: "UnknownPath", out: " " + hash1 + " other (heads/main)\n", wantErr: true},
+		{name: "BadFlag", out: "?" + hash1 + " lib\n", wantErr: true},
+		{name: "ShortHash", out: " 0123456 lib\n", wantErr: true},
+		{name: "MissingNewline", out: " " + hash1 + " lib", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseSubmoduleStatus(test.out, func(path TopPath) (bool, error) {
+				_, ok := paths[path]
+				return ok, nil
+			})
+			if err != nil {
+				if !test.wantErr {
+					t.Fatal(err)
+				}
+				return
+			}
+			if test.wantErr {
+				t.Fatal("parseSubmoduleStatus did not return an error")
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("parseSubmoduleStatus(...) (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSubmoduleLifecycle(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	// Newer versions of Git refuse to clone submodules from local paths
+	// by default.
+	const config = "[user]\nname = User\nemail = foo@example.com\n" +
+		"[protocol \"file\"]\nallow = always\n"
+	if err := env.top.Apply(filesystem.Write(".gitconfig", config)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a repository to use as a submodule.
+	if err := env.g.Init(ctx, "sub"); err != nil {
+		t.Fatal(err)
+	}
+	gitSub := env.g.WithDir("sub")
+	if err := env.root.Apply(filesystem.Write("sub/foo.txt", dummyContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitSub.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitSub.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	subRev1, err := gitSub.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the superproject and add the submodule.
+	if err := env.g.Init(ctx, "super"); err != nil {
+		t.Fatal(err)
+	}
+	gitSuper := env.g.WithDir("super")
+	subURL := URLFromPath(env.root.FromSlash("sub")).String()
+	if err := gitSuper.AddSubmodule(ctx, subURL, "lib", AddSubmoduleOptions{}); err != nil {
+		t.Fatal("AddSubmodule:", err)
+	}
+	if err := gitSuper.Commit(ctx, "add submodule", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	submodules, err := gitSuper.ListSubmodules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]*SubmoduleConfig{"lib": {Path: "lib", URL: subURL}}, submodules); diff != "" {
+		t.Errorf("ListSubmodules after AddSubmodule (-want +got):\n%s", diff)
+	}
+	status, err := gitSuper.SubmoduleStatus(ctx, SubmoduleStatusOptions{})
+	if err != nil {
+		t.Fatal("SubmoduleStatus:", err)
+	}
+	want := []*SubmoduleStatusEntry{{
+		Path:       "lib",
+		Recorded:   subRev1.Commit,
+		CheckedOut: subRev1.Commit,
+		State:      SubmoduleUpToDate,
+	}}
+	if diff := cmp.Diff(want, status); diff != "" {
+		t.Errorf("SubmoduleStatus after AddSubmodule (-want +got):\n%s", diff)
+	}
+
+	// Advance the submodule's upstream and check out the new commit in the
+	// submodule without updating the superproject.
+	if err := env.root.Apply(filesystem.Write("sub/foo.txt", "v2\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitSub.CommitAll(ctx, "second", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	subRev2, err := gitSub.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitLib := env.g.WithDir("super/lib")
+	if err := gitLib.Run(ctx, "fetch", "--quiet", "origin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitLib.CheckoutRev(ctx, subRev2.Commit.String(), CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	status, err = gitSuper.SubmoduleStatus(ctx, SubmoduleStatusOptions{})
+	if err != nil {
+		t.Fatal("SubmoduleStatus:", err)
+	}
+	want = []*SubmoduleStatusEntry{{
+		Path:       "lib",
+		Recorded:   subRev1.Commit,
+		CheckedOut: subRev2.Commit,
+		State:      SubmoduleModified,
+	}}
+	if diff := cmp.Diff(want, status); diff != "" {
+		t.Errorf("SubmoduleStatus after checkout in submodule (-want +got):\n%s", diff)
+	}
+
+	// UpdateSubmodules should bring it back to the recorded commit.
+	if err := gitSuper.UpdateSubmodules(ctx, nil, UpdateSubmodulesOptions{Strategy: SubmoduleCheckout, Jobs: 2}); err != nil {
+		t.Fatal("UpdateSubmodules:", err)
+	}
+	if head, err := gitLib.Head(ctx); err != nil {
+		t.Fatal(err)
+	} else if head.Commit != subRev1.Commit {
+		t.Errorf("after UpdateSubmodules, lib HEAD = %v; want %v", head.Commit, subRev1.Commit)
+	}
+
+	// Deinit the submodule.
+	if err := gitSuper.DeinitSubmodule(ctx, []Pathspec{"lib"}, DeinitSubmoduleOptions{}); err != nil {
+		t.Fatal("DeinitSubmodule:", err)
+	}
+	status, err = gitSuper.SubmoduleStatus(ctx, SubmoduleStatusOptions{})
+	if err != nil {
+		t.Fatal("SubmoduleStatus:", err)
+	}
+	want = []*SubmoduleStatusEntry{{
+		Path:     "lib",
+		Recorded: subRev1.Commit,
+		State:    SubmoduleUninitialized,
+	}}
+	if diff := cmp.Diff(want, status); diff != "" {
+		t.Errorf("SubmoduleStatus after DeinitSubmodule (-want +got):\n%s", diff)
+	}
+
+	// Change the URL in .gitmodules, then init and update.
+	if err := gitSuper.SetConfig(ctx, ConfigFile(env.root.FromSlash("super/.gitmodules")), "submodule.lib.url", subURL+"/."); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitSuper.InitSubmodules(ctx, nil); err != nil {
+		t.Fatal("InitSubmodules:", err)
+	}
+	if err := gitSuper.UpdateSubmodules(ctx, []Pathspec{"lib"}, UpdateSubmodulesOptions{}); err != nil {
+		t.Fatal("UpdateSubmodules:", err)
+	}
+	status, err = gitSuper.SubmoduleStatus(ctx, SubmoduleStatusOptions{Pathspecs: []Pathspec{"lib"}})
+	if err != nil {
+		t.Fatal("SubmoduleStatus:", err)
+	}
+	want = []*SubmoduleStatusEntry{{
+		Path:       "lib",
+		Recorded:   subRev1.Commit,
+		CheckedOut: subRev1.Commit,
+		State:      SubmoduleUpToDate,
+	}}
+	if diff := cmp.Diff(want, status); diff != "" {
+		t.Errorf("SubmoduleStatus after update (-want +got):\n%s", diff)
+	}
+
+	// Change the URL in .gitmodules back and sync.
+	if err := gitSuper.SetConfig(ctx, ConfigFile(env.root.FromSlash("super/.gitmodules")), "submodule.lib.url", subURL); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitSuper.SyncSubmodules(ctx, nil, SyncSubmodulesOptions{Recursive: true}); err != nil {
+		t.Fatal("SyncSubmodules:", err)
+	}
+	libCfg, err := gitLib.ReadConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := libCfg.Value("remote.origin.url"); got != subURL {
+		t.Errorf("after SyncSubmodules, lib remote.origin.url = %q; want %q", got, subURL)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gg-scm.io/pkg/git/object"
+)
+
+// TagOptions specifies the command-line options for `git tag`.
+type TagOptions struct {
+	// Message is the annotated tag's message. It will be used exactly as
+	// given. If Message is empty and Sign is false, then a lightweight tag
+	// is created.
+	Message string
+
+	// Tagger and Time override the default tagger identity and timestamp
+	// for annotated tags. Any fields with zero values will use the value
+	// inferred from Git's environment.
+	Tagger object.User
+	Time   time.Time
+
+	// If Force is true, then an existing tag with the same name is replaced.
+	Force bool
+
+	// If Sign is true, then an annotated tag is created and signed with
+	// the default key or the key named by SigningKey.
+	Sign       bool
+	SigningKey string
+}
+
+func (opts TagOptions) addToEnv(env []string) []string {
+	// Git uses the committer identity for the tagger.
+	return CommitOptions{Committer: opts.Tagger, CommitTime: opts.Time}.addToEnv(env)
+}
+
+// CreateTag creates a new tag, a ref of the form "refs/tags/NAME", where
+// NAME is the name argument. If rev is empty, then the tag points to HEAD.
+func (g *Git) CreateTag(ctx context.Context, name string, rev string, opts TagOptions) error {
+	errPrefix := fmt.Sprintf("git tag %q", name)
+	if err := validateTag(name); err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	if rev != "" {
+		if err := validateRev(rev); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	args := []string{"tag"}
+	annotated := opts.Message != "" || opts.Sign
+	switch {
+	case opts.SigningKey != "":
+		if !opts.Sign {
+			return fmt.Errorf("%s: SigningKey set without Sign", errPrefix)
+		}
+		args = append(args, "--local-user="+opts.SigningKey)
+	case opts.Sign:
+		args = append(args, "--sign")
+	case annotated:
+		args = append(args, "--annotate")
+	}
+	if annotated {
+		args = append(args, "--file=-", "--cleanup=verbatim")
+	}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	args = append(args, "--", name)
+	if rev != "" {
+		args = append(args, rev)
+	}
+	out := new(bytes.Buffer)
+	w := &limitWriter{w: out, n: errorOutputLimit}
+	invoke := &Invocation{
+		Args:   args,
+		Dir:    g.dir,
+		Env:    opts.addToEnv(nil),
+		Stdout: w,
+		Stderr: w,
+	}
+	if annotated {
+		invoke.Stdin = strings.NewReader(opts.Message)
+	}
+	if err := g.runner.RunGit(ctx, invoke); err != nil {
+		return commandError(errPrefix, err, out.Bytes())
+	}
+	return nil
+}
+
+// DeleteTag deletes the tag with the given name.
+func (g *Git) DeleteTag(ctx context.Context, name string) error {
+	errPrefix := fmt.Sprintf("git tag --delete %q", name)
+	if err := validateTag(name); err != nil {
+		return fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return g.run(ctx, errPrefix, []string{"tag", "--delete", "--", name})
+}
+
+// TagInfo describes a tag in the repository.
+type TagInfo struct {
+	// Ref is the tag's full ref name, like "refs/tags/v1.0.0".
+	Ref Ref
+	// Target is the object the ref points to. For annotated tags, this is
+	// the hash of the tag object.
+	Target Hash
+	// Commit is the commit the tag refers to after following any
+	// annotated tags. It is zero if the tag does not refer to a commit.
+	Commit Hash
+	// Annotation is the parsed tag object for annotated tags.
+	// It is nil for lightweight tags.
+	Annotation *object.Tag
+}
+
+// Name returns the tag's name without the "refs/tags/" prefix.
+func (info *TagInfo) Name() string {
+	return info.Ref.Tag()
+}
+
+// ListTags returns the tags in the repository, sorted by name.
+func (g *Git) ListTags(ctx context.Context) ([]*TagInfo, error) {
+	const errPrefix = "git tag --list"
+	out, err := g.output(ctx, errPrefix, []string{
+		"for-each-ref",
+		"--format=%(objectname) %(objecttype) %(refname)",
+		"refs/tags/",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out == "" {
+		return nil, nil
+	}
+	r, err := g.OpenObjectReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	defer r.Close()
+	var tags []*TagInfo
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%s: parse %q: too few fields", errPrefix, line)
+		}
+		info := &TagInfo{Ref: Ref(parts[2])}
+		info.Target, err = ParseHash(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: parse %q: %w", errPrefix, line, err)
+		}
+		switch object.Type(parts[1]) {
+		case object.TypeCommit:
+			info.Commit = info.Target
+		case object.TypeTag:
+			info.Annotation, err = r.Tag(ctx, info.Target.String())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v: %w", errPrefix, info.Ref, err)
+			}
+			peeled, err := r.Stat(ctx, info.Target.String()+"^{}")
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v: %w", errPrefix, info.Ref, err)
+			}
+			if peeled.Type == object.TypeCommit {
+				info.Commit = peeled.ID
+			}
+		}
+		tags = append(tags, info)
+	}
+	return tags, nil
+}
+
+func validateTag(tag string) error {
+	if tag == "" {
+		return errors.New("empty tag")
+	}
+	if strings.HasPrefix(tag, "-") {
+		return errors.New("tag cannot begin with dash")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"gg-scm.io/pkg/git/object"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTags(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.g.Init(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.root.Apply(filesystem.Write("foo.txt", dummyContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.g.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	head, err := env.g.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tags, err := env.g.ListTags(ctx); err != nil {
+		t.Error("ListTags on empty repository:", err)
+	} else if len(tags) > 0 {
+		t.Errorf("ListTags on empty repository = %d tags; want 0", len(tags))
+	}
+
+	if err := env.g.CreateTag(ctx, "light", "", TagOptions{}); err != nil {
+		t.Fatal("CreateTag lightweight:", err)
+	}
+	const tagger object.User = "Lisbeth Salander <lisbeth@example.com>"
+	tagTime := time.Date(2018, time.February, 20, 15, 47, 42, 0, time.FixedZone("-0800", -8*60*60))
+	err = env.g.CreateTag(ctx, "v1.0.0", "HEAD", TagOptions{
+		Message: "Release 1.0.0\n",
+		Tagger:  tagger,
+		Time:    tagTime,
+	})
+	if err != nil {
+		t.Fatal("CreateTag annotated:", err)
+	}
+	if err := env.g.CreateTag(ctx, "light", "HEAD", TagOptions{}); err == nil {
+		t.Error("CreateTag for existing tag without Force did not return an error")
+	}
+	if err := env.g.CreateTag(ctx, "light", "HEAD", TagOptions{Force: true}); err != nil {
+		t.Error("CreateTag with Force:", err)
+	}
+
+	tags, err := env.g.ListTags(ctx)
+	if err != nil {
+		t.Fatal("ListTags:", err)
+	}
+	if len(tags) != 2 {
+		t.Fatalf("len(ListTags(ctx)) = %d; want 2", len(tags))
+	}
+	light := tags[0]
+	if light.Name() != "light" || light.Target != head.Commit || light.Commit != head.Commit || light.Annotation != nil {
+		t.Errorf("tags[0] = %+v; want lightweight tag \"light\" at %v", light, head.Commit)
+	}
+	annotated := tags[1]
+	if annotated.Ref != TagRef("v1.0.0") {
+		t.Errorf("tags[1].Ref = %v; want %v", annotated.Ref, TagRef("v1.0.0"))
+	}
+	if annotated.Commit != head.Commit {
+		t.Errorf("tags[1].Commit = %v; want %v", annotated.Commit, head.Commit)
+	}
+	want := &object.Tag{
+		ObjectID:   head.Commit,
+		ObjectType: object.TypeCommit,
+		Name:       "v1.0.0",
+		Tagger:     tagger,
+		Time:       tagTime,
+		Message:    "Release 1.0.0\n",
+	}
+	equateTime := cmp.Comparer(func(t1, t2 time.Time) bool {
+		return t1.Equal(t2)
+	})
+	if diff := cmp.Diff(want, annotated.Annotation, equateTime); diff != "" {
+		t.Errorf("tags[1].Annotation (-want +got):\n%s", diff)
+	}
+	if annotated.Target != annotated.Annotation.SHA1() {
+		t.Errorf("tags[1].Target = %v; want %v", annotated.Target, annotated.Annotation.SHA1())
+	}
+
+	if err := env.g.DeleteTag(ctx, "light"); err != nil {
+		t.Fatal("DeleteTag:", err)
+	}
+	if tags, err := env.g.ListTags(ctx); err != nil {
+		t.Error("ListTags:", err)
+	} else if len(tags) != 1 || tags[0].Name() != "v1.0.0" {
+		t.Errorf("after DeleteTag, ListTags(ctx) = %+v; want only v1.0.0", tags)
+	}
+}
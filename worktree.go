@@ -0,0 +1,222 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// AddWorktreeOptions specifies the command-line options for
+// `git worktree add`.
+type AddWorktreeOptions struct {
+	// Rev is the revision to check out in the new worktree. If Rev names a
+	// branch and neither NewBranch nor Detach is set, then the branch is
+	// checked out. If empty, HEAD is used.
+	Rev string
+	// NewBranch is the name of a branch to create at Rev and check out in
+	// the new worktree.
+	NewBranch string
+	// If Detach is true, then the new worktree's HEAD is detached at Rev.
+	Detach bool
+	// If Force is true, then the worktree is created even if the branch is
+	// already checked out in another worktree.
+	Force bool
+}
+
+// AddWorktree creates a new linked worktree at the given path. Any relative
+// paths are interpreted relative to the Git process's working directory.
+func (g *Git) AddWorktree(ctx context.Context, path string, opts AddWorktreeOptions) error {
+	errPrefix := fmt.Sprintf("git worktree add %q", path)
+	if path == "" {
+		return fmt.Errorf("%s: empty path", errPrefix)
+	}
+	if opts.Rev != "" {
+		if err := validateRev(opts.Rev); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+	}
+	if opts.NewBranch != "" {
+		if err := validateBranch(opts.NewBranch); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		if opts.Detach {
+			return fmt.Errorf("%s: cannot detach and create a branch", errPrefix)
+		}
+	}
+	args := []string{"worktree", "add", "--quiet"}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	if opts.NewBranch != "" {
+		args = append(args, "-b", opts.NewBranch)
+	}
+	if opts.Detach {
+		args = append(args, "--detach")
+	}
+	args = append(args, "--", path)
+	if opts.Rev != "" {
+		args = append(args, opts.Rev)
+	}
+	return g.run(ctx, errPrefix, args)
+}
+
+// Worktree describes a working tree attached to a repository.
+type Worktree struct {
+	// Path is the absolute path of the worktree's top directory.
+	Path string
+	// Head is the commit checked out in the worktree.
+	// It is zero for bare repositories and unborn branches.
+	Head Hash
+	// Branch is the branch checked out in the worktree.
+	// It is empty if the worktree is bare or has a detached HEAD.
+	Branch Ref
+
+	Bare     bool
+	Detached bool
+
+	// Locked is true if the worktree is locked against pruning.
+	// LockReason is the optional reason given for locking.
+	Locked     bool
+	LockReason string
+
+	// Prunable is true if the worktree can be pruned, typically because
+	// its directory was deleted. PruneReason explains why.
+	Prunable    bool
+	PruneReason string
+}
+
+// ListWorktrees returns the repository's worktrees. The main worktree is
+// always first.
+func (g *Git) ListWorktrees(ctx context.Context) ([]*Worktree, error) {
+	const errPrefix = "git worktree list"
+	args := []string{"worktree", "list", "--porcelain"}
+	sep := byte('\n')
+	if version, err := g.getVersion(ctx); err == nil && versionAtLeast(version, 2, 36) {
+		// -z keeps paths and lock reasons with newlines intact.
+		args = append(args, "-z")
+		sep = 0
+	}
+	out, err := g.output(ctx, errPrefix, args)
+	if err != nil {
+		return nil, err
+	}
+	worktrees, err := parseWorktreeList(out, sep)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefix, err)
+	}
+	return worktrees, nil
+}
+
+// parseWorktreeList parses the output of `git worktree list --porcelain`,
+// whose lines are terminated by sep: '\n' normally or NUL with -z.
+func parseWorktreeList(out string, sep byte) ([]*Worktree, error) {
+	var worktrees []*Worktree
+	var curr *Worktree
+	for _, line := range strings.Split(out, string(sep)) {
+		if line == "" {
+			curr = nil
+			continue
+		}
+		key, value := line, ""
+		if i := strings.IndexByte(line, ' '); i != -1 {
+			key, value = line[:i], line[i+1:]
+		}
+		if key == "worktree" {
+			curr = &Worktree{Path: value}
+			worktrees = append(worktrees, curr)
+			continue
+		}
+		if curr == nil {
+			return nil, fmt.Errorf("%q outside of worktree", line)
+		}
+		switch key {
+		case "HEAD":
+			var err error
+			curr.Head, err = ParseHash(value)
+			if err != nil {
+				return nil, fmt.Errorf("worktree %s: %w", curr.Path, err)
+			}
+		case "branch":
+			curr.Branch = Ref(value)
+		case "bare":
+			curr.Bare = true
+		case "detached":
+			curr.Detached = true
+		case "locked":
+			curr.Locked = true
+			curr.LockReason = value
+		case "prunable":
+			curr.Prunable = true
+			curr.PruneReason = value
+		}
+	}
+	return worktrees, nil
+}
+
+// RemoveWorktreeOptions specifies the command-line options for
+// `git worktree remove`.
+type RemoveWorktreeOptions struct {
+	// If Force is true, then the worktree is removed even if it has
+	// local modifications or untracked files.
+	Force bool
+}
+
+// RemoveWorktree deletes the linked worktree at the given path.
+func (g *Git) RemoveWorktree(ctx context.Context, path string, opts RemoveWorktreeOptions) error {
+	errPrefix := fmt.Sprintf("git worktree remove %q", path)
+	if path == "" {
+		return fmt.Errorf("%s: empty path", errPrefix)
+	}
+	args := []string{"worktree", "remove"}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	args = append(args, "--", path)
+	return g.run(ctx, errPrefix, args)
+}
+
+// LockWorktree prevents the linked worktree at the given path from being
+// pruned, moved, or removed. The reason may be empty.
+func (g *Git) LockWorktree(ctx context.Context, path string, reason string) error {
+	errPrefix := fmt.Sprintf("git worktree lock %q", path)
+	if path == "" {
+		return fmt.Errorf("%s: empty path", errPrefix)
+	}
+	args := []string{"worktree", "lock"}
+	if reason != "" {
+		args = append(args, "--reason="+reason)
+	}
+	args = append(args, "--", path)
+	return g.run(ctx, errPrefix, args)
+}
+
+// UnlockWorktree unlocks the linked worktree at the given path.
+func (g *Git) UnlockWorktree(ctx context.Context, path string) error {
+	errPrefix := fmt.Sprintf("git worktree unlock %q", path)
+	if path == "" {
+		return fmt.Errorf("%s: empty path", errPrefix)
+	}
+	return g.run(ctx, errPrefix, []string{"worktree", "unlock", "--", path})
+}
+
+// PruneWorktrees removes administrative data for linked worktrees whose
+// directories no longer exist.
+func (g *Git) PruneWorktrees(ctx context.Context) error {
+	return g.run(ctx, "git worktree prune", []string{"worktree", "prune"})
+}
@@ -0,0 +1,197 @@
+// Copyright 2021 The gg Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//		 https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"testing"
+
+	"gg-scm.io/pkg/git/internal/filesystem"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseWorktreeList(t *testing.T) {
+	const out = "worktree /src/repo\n" +
+		"HEAD 8ab686eafeb1f44702738c8b0f24f2567c36da6d\n" +
+		"branch refs/heads/main\n" +
+		"\n" +
+		"worktree /src/detached\n" +
+		"HEAD 3b18e512dba79e4c8300dd08aeb37f8e728b8dad\n" +
+		"detached\n" +
+		"locked on a USB drive\n" +
+		"\n" +
+		"worktree /src/gone\n" +
+		"HEAD 3b18e512dba79e4c8300dd08aeb37f8e728b8dad\n" +
+		"branch refs/heads/gone\n" +
+		"locked\n" +
+		"prunable gitdir file points to non-existent location\n" +
+		"\n"
+	got, err := parseWorktreeList(out, '\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Worktree{
+		{
+			Path:   "/src/repo",
+			Head:   hashLiteral("8ab686eafeb1f44702738c8b0f24f2567c36da6d"),
+			Branch: "refs/heads/main",
+		},
+		{
+			Path:       "/src/detached",
+			Head:       hashLiteral("3b18e512dba79e4c8300dd08aeb37f8e728b8dad"),
+			Detached:   true,
+			Locked:     true,
+			LockReason: "on a USB drive",
+		},
+		{
+			Path:        "/src/gone",
+			Head:        hashLiteral("3b18e512dba79e4c8300dd08aeb37f8e728b8dad"),
+			Branch:      "refs/heads/gone",
+			Locked:      true,
+			Prunable:    true,
+			PruneReason: "gitdir file points to non-existent location",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parseWorktreeList(...) (-want +got):\n%s", diff)
+	}
+
+	t.Run("NUL", func(t *testing.T) {
+		out := "worktree /src/new\nline\x00" +
+			"HEAD 8ab686eafeb1f44702738c8b0f24f2567c36da6d\x00" +
+			"detached\x00" +
+			"locked first\nsecond\x00" +
+			"\x00"
+		got, err := parseWorktreeList(out, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []*Worktree{{
+			Path:       "/src/new\nline",
+			Head:       hashLiteral("8ab686eafeb1f44702738c8b0f24f2567c36da6d"),
+			Detached:   true,
+			Locked:     true,
+			LockReason: "first\nsecond",
+		}}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("parseWorktreeList(..., 0) (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestWorktrees(t *testing.T) {
+	gitPath, err := findGit()
+	if err != nil {
+		t.Skip("git not found:", err)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, gitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.g.Init(ctx, "repo"); err != nil {
+		t.Fatal(err)
+	}
+	repoGit := env.g.WithDir("repo")
+	if err := env.root.Apply(filesystem.Write("repo/foo.txt", dummyContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := repoGit.Add(ctx, []Pathspec{"foo.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repoGit.Commit(ctx, "first", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	head, err := repoGit.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	featurePath := env.root.FromSlash("feature")
+	if err := repoGit.AddWorktree(ctx, featurePath, AddWorktreeOptions{NewBranch: "feature"}); err != nil {
+		t.Fatal("AddWorktree with NewBranch:", err)
+	}
+	detachedPath := env.root.FromSlash("detached")
+	if err := repoGit.AddWorktree(ctx, detachedPath, AddWorktreeOptions{Rev: "main", Detach: true}); err != nil {
+		t.Fatal("AddWorktree with Detach:", err)
+	}
+	lockReason := "in use"
+	if version, err := env.g.getVersion(ctx); err != nil {
+		t.Fatal(err)
+	} else if versionAtLeast(version, 2, 36) {
+		lockReason = "in use\nby tests"
+	}
+	if err := repoGit.LockWorktree(ctx, detachedPath, lockReason); err != nil {
+		t.Fatal("LockWorktree:", err)
+	}
+
+	got, err := repoGit.ListWorktrees(ctx)
+	if err != nil {
+		t.Fatal("ListWorktrees:", err)
+	}
+	want := []*Worktree{
+		{
+			Path:   env.root.FromSlash("repo"),
+			Head:   head.Commit,
+			Branch: "refs/heads/main",
+		},
+		{
+			Path:       detachedPath,
+			Head:       head.Commit,
+			Detached:   true,
+			Locked:     true,
+			LockReason: lockReason,
+		},
+		{
+			Path:   featurePath,
+			Head:   head.Commit,
+			Branch: "refs/heads/feature",
+		},
+	}
+	// Linked worktrees are listed in an unspecified order.
+	if len(got) == 3 && got[1].Path == featurePath {
+		got[1], got[2] = got[2], got[1]
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ListWorktrees (-want +got):\n%s", diff)
+	}
+
+	if err := repoGit.RemoveWorktree(ctx, detachedPath, RemoveWorktreeOptions{}); err == nil {
+		t.Error("RemoveWorktree on locked worktree did not return an error")
+	}
+	if err := repoGit.UnlockWorktree(ctx, detachedPath); err != nil {
+		t.Fatal("UnlockWorktree:", err)
+	}
+	if err := repoGit.RemoveWorktree(ctx, detachedPath, RemoveWorktreeOptions{}); err != nil {
+		t.Fatal("RemoveWorktree:", err)
+	}
+	if err := env.root.Apply(filesystem.Remove("feature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repoGit.PruneWorktrees(ctx); err != nil {
+		t.Fatal("PruneWorktrees:", err)
+	}
+	got, err = repoGit.ListWorktrees(ctx)
+	if err != nil {
+		t.Fatal("ListWorktrees:", err)
+	}
+	if len(got) != 1 || got[0].Path != env.root.FromSlash("repo") {
+		t.Errorf("after RemoveWorktree and PruneWorktrees, ListWorktrees(ctx) = %+v; want only main worktree", got)
+	}
+}